@@ -1,8 +1,11 @@
 package builder
 
 import (
+	"time"
+
 	"github.com/lertrel/goforit/impl"
 	"github.com/lertrel/goforit/model"
+	"github.com/lertrel/goforit/parse"
 	"github.com/lertrel/goforit/vm"
 )
 
@@ -18,26 +21,65 @@ func NewFormulaBuilder() FormulaBuilder {
 	return FormulaBuilder{
 		Debug:  false,
 		repos:  make(map[vm.CustomFunctionRepository]vm.CustomFunctionRepository),
+		funcs:  make(map[vm.BuiltInFunctions]vm.BuiltInFunctions),
 		Driver: nil,
 	}
 }
 
 //FormulaBuilder a formula builder
 type FormulaBuilder struct {
-	Debug  bool
-	repos  map[vm.CustomFunctionRepository]vm.CustomFunctionRepository
-	funcs  map[vm.BuiltInFunctions]vm.BuiltInFunctions
-	Driver vm.Driver
+	Debug         bool
+	repos         map[vm.CustomFunctionRepository]vm.CustomFunctionRepository
+	funcs         map[vm.BuiltInFunctions]vm.BuiltInFunctions
+	Driver        vm.Driver
+	limits        model.Limits
+	lenient       bool
+	template      bool
+	parser        parse.Parser
+	goFuncs       []goFunc
+	rounding      model.RoundingMode
+	clock         model.Clock
+	location      *time.Location
+	calendars     []calendar
+	tables        []vm.TableRepository
+	params        []vm.ParameterRepository
+	rates         []vm.RateProvider
+	deterministic bool
+}
+
+//calendar a calendar registered by AddCalendar
+type calendar struct {
+	name     string
+	calendar model.Calendar
+}
+
+//goFunc a Go function registered by RegisterGoFunc
+type goFunc struct {
+	name string
+	fn   interface{}
 }
 
 //SetDebug setting debug flag (if yes log wll be printed)
 func (b FormulaBuilder) SetDebug(debug bool) FormulaBuilder {
 
 	return FormulaBuilder{
-		Debug:  debug,
-		repos:  b.repos,
-		funcs:  b.funcs,
-		Driver: b.Driver,
+		Debug:         debug,
+		repos:         b.repos,
+		funcs:         b.funcs,
+		Driver:        b.Driver,
+		limits:        b.limits,
+		lenient:       b.lenient,
+		template:      b.template,
+		parser:        b.parser,
+		goFuncs:       b.goFuncs,
+		rounding:      b.rounding,
+		clock:         b.clock,
+		location:      b.location,
+		calendars:     b.calendars,
+		tables:        b.tables,
+		params:        b.params,
+		rates:         b.rates,
+		deterministic: b.deterministic,
 	}
 }
 
@@ -51,10 +93,23 @@ func (b FormulaBuilder) SetDebug(debug bool) FormulaBuilder {
 func (b FormulaBuilder) AddCustomFunctionRepository(repo vm.CustomFunctionRepository) FormulaBuilder {
 
 	b2 := FormulaBuilder{
-		Debug:  b.Debug,
-		repos:  b.repos,
-		funcs:  b.funcs,
-		Driver: b.Driver,
+		Debug:         b.Debug,
+		repos:         b.repos,
+		funcs:         b.funcs,
+		Driver:        b.Driver,
+		limits:        b.limits,
+		lenient:       b.lenient,
+		template:      b.template,
+		parser:        b.parser,
+		goFuncs:       b.goFuncs,
+		rounding:      b.rounding,
+		clock:         b.clock,
+		location:      b.location,
+		calendars:     b.calendars,
+		tables:        b.tables,
+		params:        b.params,
+		rates:         b.rates,
+		deterministic: b.deterministic,
 	}
 
 	_, found := b2.repos[repo]
@@ -81,10 +136,23 @@ func (b FormulaBuilder) AddCustomFunctionRepository(repo vm.CustomFunctionReposi
 func (b FormulaBuilder) AddBuiltInFunctions(funcs vm.BuiltInFunctions) FormulaBuilder {
 
 	b2 := FormulaBuilder{
-		Debug:  b.Debug,
-		repos:  b.repos,
-		funcs:  b.funcs,
-		Driver: b.Driver,
+		Debug:         b.Debug,
+		repos:         b.repos,
+		funcs:         b.funcs,
+		Driver:        b.Driver,
+		limits:        b.limits,
+		lenient:       b.lenient,
+		template:      b.template,
+		parser:        b.parser,
+		goFuncs:       b.goFuncs,
+		rounding:      b.rounding,
+		clock:         b.clock,
+		location:      b.location,
+		calendars:     b.calendars,
+		tables:        b.tables,
+		params:        b.params,
+		rates:         b.rates,
+		deterministic: b.deterministic,
 	}
 
 	_, found := b2.funcs[funcs]
@@ -96,17 +164,306 @@ func (b FormulaBuilder) AddBuiltInFunctions(funcs vm.BuiltInFunctions) FormulaBu
 	return b2
 }
 
+//RegisterGoFunc registering an ordinary Go function as a built-in function,
+//arguments and results are converted automatically (including slices, maps
+//and structs), and a returned error is reported as *model.FormulaError
+//
+//Go functions take precedence over other built-in functions of the same
+//name (e.g., $ABS), and a function which isn't supported (see
+//vm.GoFunctions.Register) fails NewContext, Compile and NewContextPool
+//of the Formula returned by Get
+//
+//Ex.
+//
+//		formula := NewFormulaBuilder().
+//			RegisterGoFunc("$INSTALLMENT", func(p float64, term int64, vat bool) (float64, error) {
+//				if term <= 0 {
+//					return 0, errors.New("term must be positive")
+//				}
+//				if vat {
+//					p *= 1.07
+//				}
+//				return p / float64(term), nil
+//			}).
+//			Get()
+//
+func (b FormulaBuilder) RegisterGoFunc(funcName string, fn interface{}) FormulaBuilder {
+
+	b.goFuncs = append(b.goFuncs[:len(b.goFuncs):len(b.goFuncs)], goFunc{funcName, fn})
+
+	return b
+}
+
 //SetDriver allow client to use another VM rather than the default one
 func (b FormulaBuilder) SetDriver(driver vm.Driver) FormulaBuilder {
 
 	return FormulaBuilder{
-		Debug:  b.Debug,
-		repos:  b.repos,
-		funcs:  b.funcs,
-		Driver: driver,
+		Debug:         b.Debug,
+		repos:         b.repos,
+		funcs:         b.funcs,
+		Driver:        driver,
+		limits:        b.limits,
+		lenient:       b.lenient,
+		template:      b.template,
+		parser:        b.parser,
+		goFuncs:       b.goFuncs,
+		rounding:      b.rounding,
+		clock:         b.clock,
+		location:      b.location,
+		calendars:     b.calendars,
+		tables:        b.tables,
+		params:        b.params,
+		rates:         b.rates,
+		deterministic: b.deterministic,
+	}
+}
+
+//SetLimits setting default resource budgets (e.g., steps, call depth)
+//of every FormulaContext created by the Formula, so a formula written
+//by users (e.g., accidentally infinite recursion) couldn't exhaust
+//the running program
+//
+//The limits can be overridden per context by FormulaContext.SetLimits()
+//
+//Ex.
+//
+//		formula := NewFormulaBuilder().
+//			SetLimits(model.Limits{MaxSteps: 100000, MaxCallDepth: 64}).
+//			Get()
+//
+func (b FormulaBuilder) SetLimits(limits model.Limits) FormulaBuilder {
+
+	return FormulaBuilder{
+		Debug:         b.Debug,
+		repos:         b.repos,
+		funcs:         b.funcs,
+		Driver:        b.Driver,
+		limits:        limits,
+		lenient:       b.lenient,
+		template:      b.template,
+		parser:        b.parser,
+		goFuncs:       b.goFuncs,
+		rounding:      b.rounding,
+		clock:         b.clock,
+		location:      b.location,
+		calendars:     b.calendars,
+		tables:        b.tables,
+		params:        b.params,
+		rates:         b.rates,
+		deterministic: b.deterministic,
 	}
 }
 
+//SetLenient by default, FormulaContext.Prepare (and Formula.NewContext)
+//fails with model.ErrUnknownFunction when a formula refers to a function
+//which is neither built-in nor custom function, so a typo is caught early
+//
+//Setting lenient to true leaves such functions unresolved instead,
+//for the callers defining functions at runtime (e.g., in the formula itself)
+func (b FormulaBuilder) SetLenient(lenient bool) FormulaBuilder {
+
+	b.lenient = lenient
+
+	return b
+}
+
+//SetPrewarmTemplate if enabled, the Formula builds a template VM having all
+//built-in functions and all custom functions (from every repository which
+//is able to list its functions) loaded, then every new FormulaContext will
+//be started from a copy of the template instead of re-parsing functions
+//
+//The template is rebuilt automatically when Formula.RegisterCustomFunction
+//is called
+//
+//*NOTE* the template is set into the driver, so a driver given by SetDriver
+//must not be shared with another Formula
+func (b FormulaBuilder) SetPrewarmTemplate(enabled bool) FormulaBuilder {
+
+	b.template = enabled
+
+	return b
+}
+
+//SetParser setting a parser extracting function names from formulas
+//(for being loaded before running), by default the VM driver's one
+//(regular expression based) is used, which is fast but could be fooled
+//by function names within string literals and comments (which fail
+//Prepare unless lenient, see SetLenient)
+//
+//Ex.
+//
+//		formula := NewFormulaBuilder().
+//			SetParser(parse.NewASTParser()).
+//			Get()
+//
+func (b FormulaBuilder) SetParser(parser parse.Parser) FormulaBuilder {
+
+	b.parser = parser
+
+	return b
+}
+
+//SetRoundingMode setting the default rounding mode of built-in functions
+//($RND, $MROUND, $DDIV and $DRND) used when a formula doesn't give one,
+//model.RoundHalfUp by default
+//
+//Ex.
+//
+//		formula := NewFormulaBuilder().
+//			SetRoundingMode(model.RoundHalfEven).
+//			Get()
+//
+func (b FormulaBuilder) SetRoundingMode(mode model.RoundingMode) FormulaBuilder {
+
+	b.rounding = mode
+
+	return b
+}
+
+//SetClock setting a clock providing the current time to date functions
+//(e.g., $NOW, $TODAY), model.SystemClock by default, so formulas can be
+//run deterministically in tests or back-dated recalculations
+//
+//Ex.
+//
+//		formula := NewFormulaBuilder().
+//			SetClock(model.FixedClock(time.Date(2020, 12, 31, 0, 0, 0, 0, time.UTC))).
+//			Get()
+//
+func (b FormulaBuilder) SetClock(clock model.Clock) FormulaBuilder {
+
+	b.clock = clock
+
+	return b
+}
+
+//SetLocation setting the time zone of date functions (UTC by default),
+//which is the time zone of dates given without time zone offset
+//(e.g., 2020-12-31), and of dates returned by the functions
+//(e.g., $TODAY)
+func (b FormulaBuilder) SetLocation(loc *time.Location) FormulaBuilder {
+
+	b.location = loc
+
+	return b
+}
+
+//AddCalendar registering a calendar under the given name for business-day
+//functions ($WORKDAY, $NETWORKDAYS and $ISBUSINESSDAY)
+//
+//Ex.
+//
+//		th, err := vm.LoadCalendarFile("calendars/th.csv")
+//		...
+//		formula := NewFormulaBuilder().
+//			AddCalendar("TH", th).
+//			Get()
+//
+//		// $WORKDAY(start, 3, "TH")
+//
+func (b FormulaBuilder) AddCalendar(name string, c model.Calendar) FormulaBuilder {
+
+	b.calendars = append(b.calendars[:len(b.calendars):len(b.calendars)], calendar{name, c})
+
+	return b
+}
+
+//AddTableRepository adding a repository of tables queried by lookup
+//functions ($VLOOKUP, $BRACKET, $INDEX, $MATCH and $TABLE), a table is
+//looked up in the repositories in the order they're added
+//
+//Tables are shared (read-only) by all contexts of the Formula,
+//rather than being copied into every VM
+//
+//Ex.
+//
+//		tables, err := vm.LoadTableRepository("tables")
+//		...
+//		formula := NewFormulaBuilder().
+//			AddTableRepository(tables).
+//			Get()
+//
+//		// $VLOOKUP(plan, "rates", "rate")
+//
+func (b FormulaBuilder) AddTableRepository(repo vm.TableRepository) FormulaBuilder {
+
+	b.tables = append(b.tables[:len(b.tables):len(b.tables)], repo)
+
+	return b
+}
+
+//AddParameterRepository adding a repository of global parameters resolved
+//by $PARAM, a parameter is looked up in the repositories in the order
+//they're added
+//
+//Parameters are resolved as of the date given by model.WithAsOf to
+//FormulaContext.RunContext, or the current date of the clock (see SetClock)
+//
+//Ex.
+//
+//		params, err := vm.LoadParameterFile("parameters.csv")
+//		...
+//		formula := NewFormulaBuilder().
+//			AddParameterRepository(params).
+//			Get()
+//
+//		// price * $PARAM("VAT_RATE")
+//
+func (b FormulaBuilder) AddParameterRepository(repo vm.ParameterRepository) FormulaBuilder {
+
+	b.params = append(b.params[:len(b.params):len(b.params)], repo)
+
+	return b
+}
+
+//AddRateProvider adding a provider of exchange rates of $FX, a rate is
+//looked up in the providers in the order they're added
+//
+//Ex.
+//
+//		rates, err := vm.LoadRateFile("rates.csv")
+//		...
+//		formula := NewFormulaBuilder().
+//			AddRateProvider(rates).
+//			Get()
+//
+//		// $FX(price, "USD", "THB", invoiceDate)
+//
+func (b FormulaBuilder) AddRateProvider(provider vm.RateProvider) FormulaBuilder {
+
+	b.rates = append(b.rates[:len(b.rates):len(b.rates)], provider)
+
+	return b
+}
+
+//SetDeterministic if enabled, runs of the Formula are reproducible,
+//Math.random, $RAND and $RANDBETWEEN are drawn from a PRNG seeded per run,
+//and Date.now and new Date() are reading the clock given by SetClock
+//(as $NOW and $TODAY do)
+//
+//The seed of a run is recorded by FormulaContext.Seed, and the run can
+//be replayed exactly by passing the seed back through model.WithSeed
+//(together with the same clock and inputs)
+//
+//Ex.
+//
+//		formula := NewFormulaBuilder().
+//			SetDeterministic(true).
+//			SetClock(model.FixedClock(time.Date(2020, 12, 31, 0, 0, 0, 0, time.UTC))).
+//			Get()
+//
+//		v, err := c.Run(`$RANDBETWEEN(1, 6)`)
+//		seed := c.Seed()
+//
+//		replayed, err := c.RunContext(model.WithSeed(context.Background(), seed), `$RANDBETWEEN(1, 6)`)
+//
+func (b FormulaBuilder) SetDeterministic(enabled bool) FormulaBuilder {
+
+	b.deterministic = enabled
+
+	return b
+}
+
 //Get to obtain a new Formula
 func (b FormulaBuilder) Get() model.Formula {
 
@@ -120,14 +477,46 @@ func (b FormulaBuilder) Get() model.Formula {
 		repos[i] = r
 	}
 
-	funcs := make([]vm.BuiltInFunctions, len(b.funcs)+1)
+	funcs := make([]vm.BuiltInFunctions, 0, len(b.funcs)+2)
 
-	i = 0
-	funcs[i] = vm.NewBuiltInFunctions()
+	var err error
+
+	if len(b.goFuncs) > 0 {
+		//Go functions first, so they take precedence
+		goFuncs := vm.NewGoFunctions()
+		for _, f := range b.goFuncs {
+			if e := goFuncs.Register(f.name, f.fn); e != nil && err == nil {
+				err = e
+			}
+		}
+		funcs = append(funcs, goFuncs)
+	}
+
+	builtIns := vm.DefaultBuiltInFunctions{}.
+		WithRounding(b.rounding).
+		WithClock(b.clock).
+		WithLocation(b.location)
+
+	for _, c := range b.calendars {
+		builtIns = builtIns.WithCalendar(c.name, c.calendar)
+	}
+
+	for _, t := range b.tables {
+		builtIns = builtIns.WithTables(t)
+	}
+
+	for _, p := range b.params {
+		builtIns = builtIns.WithParameters(p)
+	}
+
+	for _, p := range b.rates {
+		builtIns = builtIns.WithRates(p)
+	}
+
+	funcs = append(funcs, builtIns)
 
 	for r := range b.funcs {
-		i++
-		funcs[i] = r
+		funcs = append(funcs, r)
 	}
 
 	var driver vm.Driver
@@ -139,10 +528,22 @@ func (b FormulaBuilder) Get() model.Formula {
 		driver = vm.NewVMDriver()
 	}
 
-	return impl.DefaultFormula{
-		VM:           driver,
-		CustomFuncs:  repos,
-		BuiltInFuncs: funcs,
-		Debug:        b.Debug,
+	f := impl.DefaultFormula{
+		VM:            driver,
+		CustomFuncs:   repos,
+		BuiltInFuncs:  funcs,
+		Debug:         b.Debug,
+		Limits:        b.limits,
+		Lenient:       b.lenient,
+		Parser:        b.parser,
+		Deterministic: b.deterministic,
+		Clock:         b.clock,
+		Err:           err,
+	}
+
+	if b.template {
+		f = f.EnableTemplate()
 	}
+
+	return f
 }
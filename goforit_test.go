@@ -1,11 +1,21 @@
 package goforit
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/lertrel/goforit/parse"
 
 	"github.com/lertrel/goforit/model"
+	"github.com/lertrel/goforit/vm"
 )
 
 func Get() model.Formula {
@@ -750,3 +760,1189 @@ console.log("radius="+radius);
 	}
 
 }
+
+func TestRunContextTimeout(t *testing.T) {
+
+	f := Get()
+	c, err := f.NewContext("")
+	if err != nil {
+		t.Error(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, runtimeError := c.RunContext(ctx, "while(true){}")
+	if !errors.Is(runtimeError, model.ErrTimeout) {
+		t.Errorf("Expect %v but got %v\n", model.ErrTimeout, runtimeError)
+	}
+	if !errors.Is(runtimeError, context.DeadlineExceeded) {
+		t.Errorf("Expect %v but got %v\n", context.DeadlineExceeded, runtimeError)
+	}
+
+	//The context must still be usable after being interrupted
+	str := `$SUMI(1, 2)`
+	if err := c.Prepare(str); err != nil {
+		t.Error(err)
+	}
+
+	jsI, runtimeError := c.RunContext(context.Background(), str)
+	if runtimeError != nil {
+		t.Error(runtimeError)
+	}
+
+	var expected int64 = 3
+	goI, err3 := jsI.ToInteger()
+	if err3 != nil {
+		t.Error(err3)
+	} else if goI != expected {
+		t.Errorf("Expect %v but got %v\n", expected, goI)
+	}
+}
+
+func TestRunContextCanceled(t *testing.T) {
+
+	f := Get()
+	c, err := f.NewContext("")
+	if err != nil {
+		t.Error(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+	}()
+
+	_, runtimeError := c.RunContext(ctx, "i = 0; for(;;) { i++ }")
+	if !errors.Is(runtimeError, model.ErrCanceled) {
+		t.Errorf("Expect %v but got %v\n", model.ErrCanceled, runtimeError)
+	}
+
+	var interrupted *model.InterruptedError
+	if !errors.As(runtimeError, &interrupted) || interrupted.Timeout() {
+		t.Errorf("Expect a cancelled *model.InterruptedError but got %v\n", runtimeError)
+	}
+
+	jsI, _ := c.Get("i")
+	if goI, _ := jsI.ToInteger(); goI <= 0 {
+		t.Errorf("Expect i > 0 but got %v\n", goI)
+	}
+}
+
+func TestLimitsMaxSteps(t *testing.T) {
+
+	f := NewFormulaBuilder().SetLimits(model.Limits{MaxSteps: 1000}).Get()
+	c, err := f.NewContext("")
+	if err != nil {
+		t.Error(err)
+	}
+
+	_, runtimeError := c.Run("i = 0; while(true){ i++ }")
+	var limitError *model.LimitError
+	if !errors.As(runtimeError, &limitError) || limitError.Limit != model.LimitSteps {
+		t.Errorf("Expect steps *model.LimitError but got %v\n", runtimeError)
+	}
+
+	//Below the budget runs as usual
+	jsI, runtimeError := c.Run("1 + 2")
+	if runtimeError != nil {
+		t.Error(runtimeError)
+	}
+	if goI, _ := jsI.ToInteger(); goI != 3 {
+		t.Errorf("Expect %v but got %v\n", 3, goI)
+	}
+}
+
+func TestLimitsMaxCallDepth(t *testing.T) {
+
+	f := NewFormulaBuilder().SetLimits(model.Limits{MaxCallDepth: 10}).Get()
+	f.RegisterCustomFunction(
+		"$DEPTH",
+		`
+		function $DEPTH(n) {
+			return n <= 0 ? 0 : 1 + $DEPTH(n - 1);
+		}
+		`)
+
+	str := `$DEPTH(n)`
+	c, err := f.NewContext(str)
+	if err != nil {
+		t.Error(err)
+	}
+
+	c.Set("n", 9)
+	if _, runtimeError := c.Run(str); runtimeError != nil {
+		t.Error(runtimeError)
+	}
+
+	c.Set("n", 100)
+	_, runtimeError := c.Run(str)
+	var limitError *model.LimitError
+	if !errors.As(runtimeError, &limitError) || limitError.Limit != model.LimitCallDepth {
+		t.Errorf("Expect call depth *model.LimitError but got %v\n", runtimeError)
+	}
+
+	//Overriding per context
+	c.SetLimits(model.Limits{})
+	if _, runtimeError := c.Run(str); runtimeError != nil {
+		t.Error(runtimeError)
+	}
+}
+
+func TestLimitsConcurrentAllocation(t *testing.T) {
+
+	f := NewFormulaBuilder().SetLimits(model.Limits{MaxSteps: 100000, MaxCallDepth: 64}).Get()
+	c, err := f.NewContext("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//Another goroutine allocating doesn't count against the budget of a run
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		var garbage [][]byte
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			garbage = append(garbage, make([]byte, 64<<10))
+			if len(garbage) > 64 {
+				garbage = nil
+			}
+			//otto yields at every step while being monitored
+			runtime.Gosched()
+		}
+	}()
+
+	for i := 0; i < 10; i++ {
+		v, runtimeError := c.Run("var s = 0; for (var i = 0; i < 100; i++) { s += i }; s")
+		if runtimeError != nil {
+			t.Fatal(runtimeError)
+		}
+		if n, _ := v.ToInteger(); n != 4950 {
+			t.Fatalf("Expect %v but got %v\n", 4950, n)
+		}
+	}
+}
+
+func TestFormulaErrorRange(t *testing.T) {
+
+	str := `x = 1;
+y = $RND(1.5, 11);`
+
+	f := Get()
+	c, err := f.NewContext(str)
+	if err != nil {
+		t.Error(err)
+	}
+
+	_, runtimeError := c.Run(str)
+
+	var formulaErr *model.FormulaError
+	if !errors.As(runtimeError, &formulaErr) {
+		t.Fatalf("Expect *model.FormulaError but got %v\n", runtimeError)
+	}
+
+	if formulaErr.Function != "$RND" || formulaErr.ArgIndex != 1 || formulaErr.Kind != model.ErrorKindRange {
+		t.Errorf("Unexpected %#v\n", formulaErr)
+	}
+
+	if formulaErr.Line != 2 || formulaErr.Column != 5 {
+		t.Errorf("Expect line 2, column 5 but got line %v, column %v\n", formulaErr.Line, formulaErr.Column)
+	}
+}
+
+func TestFormulaErrorArityAndType(t *testing.T) {
+
+	f := Get()
+	c, err := f.NewContext("$ABS(1, 2) + $FLOOR('abc', 1)")
+	if err != nil {
+		t.Error(err)
+	}
+
+	_, runtimeError := c.Run("$ABS(1, 2)")
+
+	var formulaErr *model.FormulaError
+	if !errors.As(runtimeError, &formulaErr) || formulaErr.Kind != model.ErrorKindArity || formulaErr.ArgIndex != -1 {
+		t.Errorf("Expect arity *model.FormulaError but got %v\n", runtimeError)
+	}
+
+	_, runtimeError = c.Run("$FLOOR('abc', 1)")
+	if !errors.As(runtimeError, &formulaErr) || formulaErr.Kind != model.ErrorKindType || formulaErr.ArgIndex != 0 {
+		t.Errorf("Expect type *model.FormulaError but got %v\n", runtimeError)
+	}
+	if formulaErr.Function != "$FLOOR" {
+		t.Errorf("Expect %v but got %v\n", "$FLOOR", formulaErr.Function)
+	}
+
+	//The context must still be usable
+	if _, runtimeError = c.Run("$ABS(-1)"); runtimeError != nil {
+		t.Error(runtimeError)
+	}
+}
+
+func TestUnknownFunction(t *testing.T) {
+
+	f := Get()
+	f.RegisterCustomFunction(
+		"$TYPO",
+		`
+		function $TYPO(x) {
+			return $SUMF(x, $MISSING2(x));
+		}
+		`)
+
+	str := `$IF(x > 0, $TYPO(x), $MISSING1(x))`
+
+	_, err := f.NewContext(str)
+	if !errors.Is(err, model.ErrUnknownFunction) {
+		t.Fatalf("Expect %v but got %v\n", model.ErrUnknownFunction, err)
+	}
+
+	var unknownErr *model.UnknownFunctionError
+	errors.As(err, &unknownErr)
+	if len(unknownErr.Names) != 2 || unknownErr.Names[0] != "$MISSING1" || unknownErr.Names[1] != "$MISSING2" {
+		t.Errorf("Expect [$MISSING1 $MISSING2] but got %v\n", unknownErr.Names)
+	}
+}
+
+func TestUnknownFunctionLenient(t *testing.T) {
+
+	str := `
+	function $LOCAL(x) { return x * 2; }
+	$LOCAL(21)
+	`
+
+	f := NewFormulaBuilder().SetLenient(true).Get()
+	c, err := f.NewContext(str)
+	if err != nil {
+		t.Error(err)
+	}
+
+	jsI, runtimeError := c.Run(str)
+	if runtimeError != nil {
+		t.Error(runtimeError)
+	}
+
+	if goI, _ := jsI.ToInteger(); goI != 42 {
+		t.Errorf("Expect %v but got %v\n", 42, goI)
+	}
+}
+
+func TestContextPool(t *testing.T) {
+
+	f := Get()
+	f.RegisterCustomFunction(
+		"$CIRCLE",
+		`
+		function $CIRCLE(radius) {
+			return $RND(Math.PI * Math.pow(radius, 2), 2);
+		}
+		`)
+
+	pool, err := f.NewContextPool(model.PoolConfig{
+		InitialSize: 2,
+		MaxIdle:     4,
+		Functions:   []string{"$CIRCLE"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := pool.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.Set("r", 5)
+	if _, err := c.Run("var declared = 1; area = $CIRCLE(r)"); err != nil {
+		t.Error(err)
+	}
+
+	pool.Put(c)
+
+	//User variables are gone, but functions are kept
+	c, _ = pool.Get()
+	for _, name := range []string{"r", "area", "declared"} {
+		if jsV, _ := c.Get(name); jsV.IsDefined() {
+			t.Errorf("Expect %v to be undefined after being given back to the pool\n", name)
+		}
+	}
+
+	jsArea, runtimeError := c.Run("$CIRCLE(1)")
+	if runtimeError != nil {
+		t.Error(runtimeError)
+	}
+	if area, _ := jsArea.ToFloat(); area != 3.14 {
+		t.Errorf("Expect %v but got %v\n", 3.14, area)
+	}
+
+	pool.Put(c)
+
+	stats := pool.Stats()
+	if stats.Created != 2 || stats.Gets != 2 || stats.Hits != 2 || stats.Puts != 2 || stats.Idle != 2 || stats.InUse != 0 {
+		t.Errorf("Unexpected %+v\n", stats)
+	}
+
+	//Changes to functions and built-in objects are gone too
+	c, _ = pool.Get()
+	if _, err := c.Run("$CIRCLE = function() { return 666 }; Math.round = function() { return -1 }"); err != nil {
+		t.Error(err)
+	}
+	pool.Put(c)
+
+	c, _ = pool.Get()
+	if v, err := c.Run("$CIRCLE(1) + ',' + Math.round(1.6)"); err != nil {
+		t.Error(err)
+	} else if s, _ := v.ToString(); s != "3.14,2" {
+		t.Errorf("Expect 3.14,2 but got %v\n", s)
+	}
+
+	//Giving back twice (or a context of another pool) is ignored
+	pool.Put(c)
+	pool.Put(c)
+	other, _ := f.NewContext("")
+	pool.Put(other)
+
+	if stats := pool.Stats(); stats.Idle != 2 || stats.InUse != 0 {
+		t.Errorf("Unexpected %+v\n", stats)
+	}
+
+	c1, _ := pool.Get()
+	c2, _ := pool.Get()
+	c1.Set("owner", 1)
+	if v, _ := c2.Get("owner"); v.IsDefined() {
+		t.Error("Expect contexts not to be shared")
+	}
+	pool.Put(c1)
+	pool.Put(c2)
+
+	//Idle contexts are evicted once custom functions are changed
+	f.RegisterCustomFunction(
+		"$CIRCLE",
+		`
+		function $CIRCLE(radius) {
+			return 3 * radius * radius;
+		}
+		`)
+
+	c, _ = pool.Get()
+	if v, err := c.Run("$CIRCLE(1)"); err != nil {
+		t.Error(err)
+	} else if n, _ := v.ToInteger(); n != 3 {
+		t.Errorf("Expect 3 but got %v\n", n)
+	}
+	pool.Put(c)
+}
+
+func TestContextPoolConcurrent(t *testing.T) {
+
+	f := Get()
+	pool, err := f.NewContextPool(model.PoolConfig{Functions: []string{"$SUMI"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errs := make(chan error, 50)
+
+	for i := 0; i < 50; i++ {
+		go func(i int) {
+			c, err := pool.Get()
+			if err != nil {
+				errs <- err
+				return
+			}
+			defer pool.Put(c)
+
+			c.Set("i", i)
+			jsI, err := c.Run("$SUMI(i, 1)")
+			if err != nil {
+				errs <- err
+				return
+			}
+
+			if goI, _ := jsI.ToInteger(); goI != int64(i+1) {
+				errs <- fmt.Errorf("Expect %v but got %v", i+1, goI)
+				return
+			}
+
+			errs <- nil
+		}(i)
+	}
+
+	for i := 0; i < 50; i++ {
+		if err := <-errs; err != nil {
+			t.Error(err)
+		}
+	}
+
+	if stats := pool.Stats(); stats.Gets != 50 || stats.InUse != 0 || stats.Created != stats.Misses {
+		t.Errorf("Unexpected %+v\n", stats)
+	}
+}
+
+func TestContextPoolUnknownFunction(t *testing.T) {
+
+	_, err := Get().NewContextPool(model.PoolConfig{InitialSize: 1, Functions: []string{"$NOPE"}})
+	if !errors.Is(err, model.ErrUnknownFunction) {
+		t.Errorf("Expect %v but got %v\n", model.ErrUnknownFunction, err)
+	}
+}
+
+func TestPrewarmTemplate(t *testing.T) {
+
+	f := NewFormulaBuilder().SetPrewarmTemplate(true).Get()
+	f.RegisterCustomFunction(
+		"$CIRCLE",
+		`
+		function $CIRCLE(radius) {
+			return $RND(Math.PI * Math.pow(radius, 2), 2);
+		}
+		`)
+	f.RegisterCustomFunction(
+		"$BROKEN",
+		`
+		function $BROKEN(x) {
+			return $MISSING(x);
+		}
+		`)
+
+	//Functions are already there without being prepared
+	c, err := f.NewContext("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jsArea, runtimeError := c.Run("$CIRCLE($ABS(-1))")
+	if runtimeError != nil {
+		t.Error(runtimeError)
+	}
+	if area, _ := jsArea.ToFloat(); area != 3.14 {
+		t.Errorf("Expect %v but got %v\n", 3.14, area)
+	}
+
+	//Unknown functions are still reported
+	if _, err = f.NewContext("$BROKEN(1)"); !errors.Is(err, model.ErrUnknownFunction) {
+		t.Errorf("Expect %v but got %v\n", model.ErrUnknownFunction, err)
+	}
+
+	//The template is rebuilt once the function is changed
+	f.RegisterCustomFunction(
+		"$CIRCLE",
+		`
+		function $CIRCLE(radius) {
+			return $FLOOR(Math.PI * Math.pow(radius, 2), 1);
+		}
+		`)
+
+	c, err = f.NewContext("$CIRCLE(1)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jsArea, runtimeError = c.Run("$CIRCLE(1)")
+	if runtimeError != nil {
+		t.Error(runtimeError)
+	}
+	if area, _ := jsArea.ToFloat(); area != 3.1 {
+		t.Errorf("Expect %v but got %v\n", 3.1, area)
+	}
+
+	//A function failing to be loaded is loaded again by the next Prepare
+	f = NewFormulaBuilder().Get()
+	f.RegisterCustomFunction(
+		"$FLAKY",
+		`
+		if (failing) {
+			throw new Error("failing");
+		}
+		var $FLAKY = function() {
+			return 1;
+		};
+		`)
+
+	c, err = f.NewContext("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.Set("failing", true)
+	if err = c.Prepare("$FLAKY()"); err == nil {
+		t.Errorf("Expect $FLAKY to fail")
+	}
+
+	c.Set("failing", false)
+	if err = c.Prepare("$FLAKY()"); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := c.Run("$FLAKY()"); err != nil {
+		t.Error(err)
+	} else if i, _ := v.ToInteger(); i != 1 {
+		t.Errorf("Expect %v but got %v\n", 1, i)
+	}
+}
+
+func TestCompiledFormula(t *testing.T) {
+
+	f := NewFormulaBuilder().Get()
+	f.RegisterCustomFunction(
+		"$CIRCLE",
+		`
+		function $CIRCLE(radius) {
+			return $RND(Math.PI * Math.pow(radius, 2), 2);
+		}
+		`)
+
+	cf, err := f.Compile("$CIRCLE(r)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if names := cf.Functions(); len(names) != 1 || names[0] != "$CIRCLE" {
+		t.Errorf("Unexpected functions %v\n", names)
+	}
+
+	//The same compiled formula can be run many times with different variables
+	for r, expected := range map[int]float64{1: 3.14, 2: 12.57} {
+
+		c, err := f.NewContext("")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		c.Set("r", r)
+		jsArea, runtimeError := c.RunCompiled(cf)
+		if runtimeError != nil {
+			t.Fatal(runtimeError)
+		}
+		if area, _ := jsArea.ToFloat(); area != expected {
+			t.Errorf("Expect %v but got %v\n", expected, area)
+		}
+	}
+
+	if _, err = f.Compile("$MISSING(1)"); !errors.Is(err, model.ErrUnknownFunction) {
+		t.Errorf("Expect %v but got %v\n", model.ErrUnknownFunction, err)
+	}
+
+	if _, err = f.Compile("$CIRCLE(1"); err == nil {
+		t.Error("Expect syntax error")
+	}
+}
+
+func TestASTParser(t *testing.T) {
+
+	src := `// $COMMENTED(1)
+var s = "$QUOTED(1)";
+var f = $REF;
+x = $DIRECT (1) + $APPLY.call(null, 2);
+obj.$METHOD(3);`
+
+	p := parse.NewASTParser()
+
+	sites, err := p.CallSites(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []parse.CallSite{
+		{Name: "$REF", Kind: parse.CallReference, Line: 3, Column: 9, Offset: 47, Args: -1},
+		{Name: "$DIRECT", Kind: parse.CallDirect, Line: 4, Column: 5, Offset: 57, Args: 1},
+		{Name: "$APPLY", Kind: parse.CallIndirect, Line: 4, Column: 19, Offset: 71, Args: 1},
+		{Name: "$METHOD", Kind: parse.CallMember, Line: 5, Column: 5, Offset: 97, Args: 1},
+	}
+
+	if fmt.Sprint(sites) != fmt.Sprint(expected) {
+		t.Errorf("Expect %v but got %v\n", expected, sites)
+	}
+
+	names := p.ExtractFunctionNames(src)
+	if fmt.Sprint(names) != "[$REF $DIRECT $APPLY]" {
+		t.Errorf("Unexpected %v\n", names)
+	}
+
+	//Invalid script falls back to the default parser
+	if names = p.ExtractFunctionNames("$ABS(1"); fmt.Sprint(names) != "[$ABS]" {
+		t.Errorf("Unexpected %v\n", names)
+	}
+
+	//Names declared by the script are not functions to be loaded
+	src = `var $total = 1;
+function $twice($n) { var $m = $n * 2; return $m }
+try { $twice($total) } catch ($e) { $e }
+$total + $twice($total) + $ABS(-1) + $m`
+
+	if names = p.ExtractFunctionNames(src); fmt.Sprint(names) != "[$ABS $m]" {
+		t.Errorf("Unexpected %v\n", names)
+	}
+}
+
+func TestDollarVariables(t *testing.T) {
+
+	script := "var $total = 1; $total + 1"
+
+	for _, f := range []model.Formula{
+		NewFormulaBuilder().Get(),
+		NewFormulaBuilder().SetParser(parse.NewASTParser()).Get(),
+	} {
+		if diagnostics := f.Validate(script); len(diagnostics) != 0 {
+			t.Errorf("%s - %v\n", script, diagnostics)
+		}
+
+		c, err := f.NewContext(script)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		v, err := c.Run(script)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i, _ := v.ToInteger(); i != 2 {
+			t.Errorf("Expect %v but got %v\n", 2, i)
+		}
+	}
+}
+
+func TestSetParser(t *testing.T) {
+
+	script := `$ABS(-1) + "$MISSING(".length`
+
+	//Fooled by $MISSING( within the string literal
+	if _, err := NewFormulaBuilder().Get().NewContext(script); !errors.Is(err, model.ErrUnknownFunction) {
+		t.Errorf("Expect %v but got %v\n", model.ErrUnknownFunction, err)
+	}
+
+	f := NewFormulaBuilder().SetParser(parse.NewASTParser()).Get()
+
+	c, err := f.NewContext(script)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := c.Run(script)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if i, _ := v.ToInteger(); i != 10 {
+		t.Errorf("Expect %v but got %v\n", 10, i)
+	}
+}
+
+func TestAnalyzer(t *testing.T) {
+
+	f := NewFormulaBuilder().Get()
+	f.RegisterCustomFunction(
+		"$PREMIUM",
+		`
+		function $PREMIUM(sa) {
+			var r = rates[age];
+			premium = $RND(sa / 1000 * r, 2);
+			return premium;
+		}
+		`)
+
+	script := `
+	// $IGNORED(x)
+	var label = "$QUOTED(y)";
+	total = $PREMIUM(sa) + fee;
+	count++;
+	`
+
+	analysis, err := parse.NewAnalyzer().Analyze(script, f.GetCustomFunctionBody)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fmt.Sprint(analysis.Reads) != "[sa fee count rates age premium]" {
+		t.Errorf("Unexpected reads %v\n", analysis.Reads)
+	}
+	if fmt.Sprint(analysis.Writes) != "[label total count premium]" {
+		t.Errorf("Unexpected writes %v\n", analysis.Writes)
+	}
+	if fmt.Sprint(analysis.Functions) != "[$PREMIUM $RND]" {
+		t.Errorf("Unexpected functions %v\n", analysis.Functions)
+	}
+	if fmt.Sprint(analysis.Inputs()) != "[sa fee rates age]" {
+		t.Errorf("Unexpected inputs %v\n", analysis.Inputs())
+	}
+}
+
+func TestValidate(t *testing.T) {
+
+	f := NewFormulaBuilder().Get()
+	f.RegisterCustomFunction(
+		"$LOAN",
+		`
+		function $LOAN(principal, rate) {
+			initial_loan = principal
+			var i1 = $RND(initial_loan * rate)
+			return i1
+			console.log(i1)
+		}
+		`)
+
+	if diagnostics := f.Validate("$ABS(-1) + $RND(2.5, 0)"); len(diagnostics) != 0 {
+		t.Errorf("Unexpected %v\n", diagnostics)
+	}
+
+	diagnostics := f.Validate("x = $LOAN(p, r) +\n  $MISSING(1) + $ABS(1, 2)")
+
+	expected := []string{
+		"2:3: error: $MISSING is neither built-in nor custom function (unknown-function)",
+		"2:17: error: $ABS expects 1 argument(s) but got 2 (arity)",
+		"$LOAN:3:4: warning: 'initial_loan' is assigned without being declared (by var), so it's leaked as a global variable (undeclared-global)",
+		"$LOAN:6:4: warning: unreachable code (unreachable-code)",
+		"$LOAN:4:13: error: $RND expects 2 to 3 arguments but got 1 (arity)",
+	}
+
+	if len(diagnostics) != len(expected) {
+		t.Fatalf("Expect %v but got %v\n", expected, diagnostics)
+	}
+
+	for i, d := range diagnostics {
+		if d.String() != expected[i] {
+			t.Errorf("Expect %v but got %v\n", expected[i], d)
+		}
+	}
+
+	diagnostics = f.Validate("$ABS(1")
+	if len(diagnostics) != 1 || diagnostics[0].Code != model.DiagnosticSyntaxError || diagnostics[0].Line != 1 {
+		t.Errorf("Unexpected %v\n", diagnostics)
+	}
+}
+
+func TestDescribeBuiltInFunctions(t *testing.T) {
+
+	f := NewFormulaBuilder().Get()
+
+	signature, found := f.DescribeBuiltInFunction("$FLR")
+	if !found || signature.Name != "$FLOOR" {
+		t.Fatalf("Unexpected %v\n", signature)
+	}
+	if s := signature.String(); s != "$FLOOR(value number, precision integer) number" {
+		t.Errorf("Unexpected %v\n", s)
+	}
+
+	if _, found = f.DescribeBuiltInFunction("$MISSING"); found {
+		t.Error("Expect $MISSING not to be found")
+	}
+
+	names := make(map[string]bool)
+	for _, signature := range f.ListBuiltInFunctions() {
+		names[signature.Name] = true
+		if signature.Description == "" || len(signature.Examples) == 0 {
+			t.Errorf("Expect %v to be documented\n", signature.Name)
+		}
+	}
+	if !names["$RND"] || !names["$MAX"] || names["$FLR"] {
+		t.Errorf("Unexpected %v\n", names)
+	}
+
+	//Arity comes from signatures
+	signature, _ = f.DescribeBuiltInFunction("$AVG")
+	if min, max := signature.Arity(); min != 1 || max != -1 {
+		t.Errorf("Unexpected arity %v, %v\n", min, max)
+	}
+
+	c, _ := f.NewContext("$AVG()")
+	_, err := c.Run("$AVG()")
+
+	var formulaErr *model.FormulaError
+	if !errors.As(err, &formulaErr) || formulaErr.Kind != model.ErrorKindArity || formulaErr.Function != "$AVG" {
+		t.Errorf("Unexpected %v\n", err)
+	}
+}
+
+type testLoan struct {
+	Principal float64 `json:"principal"`
+	Term      int64
+	Rates     []float64 `json:"rates"`
+}
+
+func TestRegisterGoFunc(t *testing.T) {
+
+	f := NewFormulaBuilder().
+		RegisterGoFunc("$INSTALLMENT", func(p float64, term int64, vat bool) (float64, error) {
+			if term <= 0 {
+				return 0, errors.New("term must be positive")
+			}
+			if vat {
+				p *= 1.07
+			}
+			return p / float64(term), nil
+		}).
+		RegisterGoFunc("$TOTAL", func(loan testLoan, extra map[string]float64) map[string]interface{} {
+			total := loan.Principal
+			for _, rate := range loan.Rates {
+				total += loan.Principal * rate
+			}
+			return map[string]interface{}{
+				"total": total + extra["fee"],
+				"terms": []int64{loan.Term, loan.Term * 2},
+			}
+		}).
+		RegisterGoFunc("$JOIN", func(sep string, values ...string) string {
+			return strings.Join(values, sep)
+		}).
+		Get()
+
+	script := `
+	installment = $INSTALLMENT(1000, 10, true);
+	result = $TOTAL({principal: 100, term: 12, rates: [0.1, 0.2]}, {fee: 5});
+	joined = $JOIN("-", "a", "b", "c");
+	terms = result.terms.length + ":" + Array.isArray(result.terms) + ":" + result.terms[1];
+	`
+
+	c, err := f.NewContext(script)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = c.Run(script); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{
+		"installment":  "107",
+		"result.total": "135",
+		"joined":       "a-b-c",
+		"terms":        "2:true:24",
+	}
+
+	for name, value := range expected {
+		v, err := c.Run(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s, _ := v.ToString(); s != value {
+			t.Errorf("%s - expect %v but got %v\n", name, value, s)
+		}
+	}
+
+	//A returned error is a formula error
+	_, err = c.Run("$INSTALLMENT(1000, 0, false)")
+
+	var formulaErr *model.FormulaError
+	if !errors.As(err, &formulaErr) || formulaErr.Function != "$INSTALLMENT" || formulaErr.Message != "term must be positive" {
+		t.Errorf("Unexpected %v\n", err)
+	}
+
+	//Arguments of wrong types are formula errors
+	_, err = c.Run("$TOTAL({principal: 'abc'}, {})")
+	if !errors.As(err, &formulaErr) || formulaErr.Kind != model.ErrorKindType || formulaErr.ArgIndex != 0 {
+		t.Errorf("Unexpected %v\n", err)
+	}
+
+	signature, _ := f.DescribeBuiltInFunction("$JOIN")
+	if s := signature.String(); s != "$JOIN(arg1 string, arg2...? string) string" {
+		t.Errorf("Unexpected %v\n", s)
+	}
+}
+
+func TestRegisterGoFuncArguments(t *testing.T) {
+
+	f := NewFormulaBuilder().
+		RegisterGoFunc("$SMALL", func(n int8) int8 { return n }).
+		RegisterGoFunc("$COUNT", func(n uint16) uint16 { return n }).
+		RegisterGoFunc("$SUM3", func(values [3]float64) float64 {
+			return values[0] + values[1] + values[2]
+		}).
+		RegisterGoFunc("$ABS", func(n float64) string { return "overridden" }).
+		Get()
+
+	c, err := f.NewContext("$SMALL(0) + $COUNT(0) + $SUM3([]) + $ABS(0)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for script, expected := range map[string]string{
+		"$SMALL(-128)":       "-128",
+		"$SMALL(127)":        "127",
+		"$COUNT(65535)":      "65535",
+		"$SUM3([1, 2, 3.5])": "6.5",
+		"$ABS(-1)":           "overridden",
+	} {
+		v, err := c.Run(script)
+		if err != nil {
+			t.Fatalf("%s - %v", script, err)
+		}
+		if s, _ := v.ToString(); s != expected {
+			t.Errorf("%s - expect %v but got %v\n", script, expected, s)
+		}
+	}
+
+	var formulaErr *model.FormulaError
+
+	//Numbers not fitting into parameters aren't wrapped
+	for _, script := range []string{"$SMALL(1000)", "$SMALL(-129)", "$COUNT(65536)", "$COUNT(-1)"} {
+		_, err = c.Run(script)
+		if !errors.As(err, &formulaErr) || formulaErr.Kind != model.ErrorKindRange || formulaErr.ArgIndex != 0 {
+			t.Errorf("%s - unexpected %v\n", script, err)
+		}
+	}
+
+	//Fractions aren't truncated into integers
+	for _, script := range []string{"$SMALL(1.5)", "$COUNT(-0.5)", "$SUM3([1, 2])"} {
+		_, err = c.Run(script)
+		if !errors.As(err, &formulaErr) || formulaErr.Kind != model.ErrorKindType || formulaErr.ArgIndex != 0 {
+			t.Errorf("%s - unexpected %v\n", script, err)
+		}
+	}
+
+	signature, _ := f.DescribeBuiltInFunction("$ABS")
+	if signature.Returns != model.TypeString {
+		t.Errorf("Unexpected %v\n", signature)
+	}
+
+	//A function which isn't supported is reported instead of panicking
+	f = NewFormulaBuilder().
+		RegisterGoFunc("$BAD", "not a function").
+		Get()
+
+	if _, err = f.NewContext(""); err == nil {
+		t.Errorf("Expecting an error")
+	}
+	if _, err = f.Compile("1"); err == nil {
+		t.Errorf("Expecting an error")
+	}
+	if _, err = f.NewContextPool(model.PoolConfig{}); err == nil {
+		t.Errorf("Expecting an error")
+	}
+}
+
+func TestDeterministicMode(t *testing.T) {
+
+	now := time.Date(2021, 1, 4, 20, 0, 0, 0, time.UTC)
+
+	f := NewFormulaBuilder().
+		SetDeterministic(true).
+		SetClock(model.FixedClock(now)).
+		Get()
+
+	script := `[Math.random(), $RAND(), $RANDBETWEEN(1, 6), Date.now(), new Date().getTime(), new Date(0).getTime(), new Date() instanceof Date].join()`
+
+	c, err := f.NewContext(script)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := c.Run(script)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorded, _ := v.ToString()
+	seed := c.Seed()
+
+	millis := fmt.Sprint(now.UnixNano() / int64(time.Millisecond))
+	if !strings.HasSuffix(recorded, ","+millis+","+millis+",0,true") {
+		t.Errorf("Expect the time of the clock but got %v\n", recorded)
+	}
+
+	//Replaying the run by the recorded seed, in another context
+	replay, _ := f.NewContext(script)
+	v, err = replay.RunContext(model.WithSeed(context.Background(), seed), script)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s, _ := v.ToString(); s != recorded {
+		t.Errorf("Expect %v but got %v\n", recorded, s)
+	}
+	if replay.Seed() != seed {
+		t.Errorf("Expect seed %v but got %v\n", seed, replay.Seed())
+	}
+
+	//Every run is seeded anew
+	v, _ = c.Run(script)
+	if s, _ := v.ToString(); s == recorded || c.Seed() == seed {
+		t.Errorf("Expect another sequence but got %v\n", s)
+	}
+
+	for i := 0; i < 100; i++ {
+		v, _ := c.Run("$RANDBETWEEN(-2, 2)")
+		if n, _ := v.ToInteger(); n < -2 || n > 2 {
+			t.Fatalf("Expect -2 to 2 but got %v\n", n)
+		}
+	}
+
+	c.Prepare("$RANDBETWEEN(2, 1)")
+	_, err = c.Run("$RANDBETWEEN(2, 1)")
+
+	var formulaErr *model.FormulaError
+	if !errors.As(err, &formulaErr) || formulaErr.Kind != model.ErrorKindRange {
+		t.Errorf("Unexpected %v\n", err)
+	}
+
+	//Seeds are recorded only by deterministic Formulas
+	c, _ = NewFormulaBuilder().Get().NewContext("$RAND()")
+	if v, err = c.Run("$RAND()"); err != nil {
+		t.Error(err)
+	} else if r, _ := v.ToFloat(); r < 0 || r >= 1 || c.Seed() != 0 {
+		t.Errorf("Unexpected %v (seed %v)\n", r, c.Seed())
+	}
+}
+
+func TestFileFunctionRepository(t *testing.T) {
+
+	dir := t.TempDir()
+	modTime := time.Now().Add(-time.Hour)
+
+	write := func(name string, content string) {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		//Every write is seen as a change even within the same second
+		modTime = modTime.Add(time.Second)
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("$CIRCLE.js", `function $CIRCLE(radius) { return $RND(Math.PI * radius * radius, 2); }`)
+	write("tax.js", `
+		var VAT_RATE = 0.07;
+		function $VAT(amount) { return amount * VAT_RATE; }
+		function $GROSS(amount) { return amount + $VAT(amount); }
+	`)
+	write("README.txt", "not a function")
+
+	repo, err := vm.LoadFileFunctionRepository(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Close()
+
+	if names := fmt.Sprint(repo.FunctionNames()); names != "[$CIRCLE $GROSS $VAT]" {
+		t.Errorf("Unexpected functions %v\n", names)
+	}
+
+	for _, template := range []bool{false, true} {
+
+		f := NewFormulaBuilder().
+			AddCustomFunctionRepository(repo).
+			SetPrewarmTemplate(template).
+			Get()
+
+		run := func(script string) string {
+			c, err := f.NewContext(script)
+			if err != nil {
+				t.Fatal(err)
+			}
+			v, err := c.Run(script)
+			if err != nil {
+				t.Fatal(err)
+			}
+			s, _ := v.ToString()
+			return s
+		}
+
+		write("tax.js", `
+			var VAT_RATE = 0.07;
+			function $VAT(amount) { return amount * VAT_RATE; }
+			function $GROSS(amount) { return amount + $VAT(amount); }
+		`)
+		if err := repo.Reload(); err != nil {
+			t.Fatal(err)
+		}
+
+		if s := run("$CIRCLE(1) + ',' + $GROSS(100)"); s != "3.14,107" {
+			t.Errorf("Expect 3.14,107 but got %v\n", s)
+		}
+
+		//Changed
+		write("tax.js", `
+			var VAT_RATE = 0.1;
+			function $VAT(amount) { return amount * VAT_RATE; }
+			function $GROSS(amount) { return amount + $VAT(amount); }
+		`)
+		if err := repo.Reload(); err != nil {
+			t.Fatal(err)
+		}
+
+		if s := run("$GROSS(100)"); s != "110" {
+			t.Errorf("Expect 110 but got %v\n", s)
+		}
+
+		//Broken, the last good version is kept
+		write("tax.js", `function $VAT(amount) { return amount * ; }`)
+		if err := repo.Reload(); err == nil || repo.Errors()["tax.js"] == nil {
+			t.Errorf("Expect a syntax error but got %v\n", err)
+		}
+
+		if s := run("$GROSS(100)"); s != "110" {
+			t.Errorf("Expect 110 but got %v\n", s)
+		}
+
+		//Reported once
+		if err := repo.Reload(); err != nil {
+			t.Errorf("Unexpected %v\n", err)
+		}
+	}
+
+	//Fixed then removed
+	write("tax.js", `function $VAT(amount) { return amount * 0.07; }`)
+	if err := repo.Reload(); err != nil || len(repo.Errors()) != 0 {
+		t.Errorf("Unexpected %v\n", err)
+	}
+	if names := fmt.Sprint(repo.FunctionNames()); names != "[$CIRCLE $VAT]" {
+		t.Errorf("Unexpected functions %v\n", names)
+	}
+
+	if err := os.Remove(filepath.Join(dir, "tax.js")); err != nil {
+		t.Fatal(err)
+	}
+
+	write("$AREA.js", `function $SQUARE(side) { return side * side; }`)
+
+	if err := repo.Reload(); err == nil || repo.Errors()["$AREA.js"] == nil {
+		t.Errorf("Expect $AREA isn't declared but got %v\n", err)
+	}
+	if names := fmt.Sprint(repo.FunctionNames()); names != "[$CIRCLE]" {
+		t.Errorf("Unexpected functions %v\n", names)
+	}
+
+	//Watching
+	reported := make(chan string, 10)
+	repo.Watch(10*time.Millisecond, func(path string, err error) {
+		reported <- filepath.Base(path)
+	})
+
+	write("$AREA.js", `function $AREA(side) { return side * side; }`)
+	write("$BROKEN.js", `function $BROKEN( {`)
+
+	select {
+	case name := <-reported:
+		if name != "$BROKEN.js" {
+			t.Errorf("Expect $BROKEN.js but got %v\n", name)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expect $BROKEN.js to be reported")
+	}
+
+	if body := repo.GetFunctionBody("$AREA"); !strings.Contains(body, "$AREA") {
+		t.Errorf("Expect $AREA to be reloaded but got %v\n", body)
+	}
+	repo.Close()
+
+	//A file which can't be loaded doesn't fail loading the others
+	loaded, err := vm.LoadFileFunctionRepository(dir)
+	if loaded == nil || err == nil || !strings.Contains(err.Error(), "$BROKEN.js") {
+		t.Fatalf("Expect $BROKEN.js to be reported but got %v\n", err)
+	}
+	if names := fmt.Sprint(loaded.FunctionNames()); names != "[$AREA $CIRCLE]" {
+		t.Errorf("Unexpected functions %v\n", names)
+	}
+	if errs := loaded.Errors(); len(errs) != 1 || errs["$BROKEN.js"] == nil {
+		t.Errorf("Unexpected errors %v\n", errs)
+	}
+
+	if _, err = vm.LoadFileFunctionRepository(filepath.Join(dir, "missing")); err == nil {
+		t.Errorf("Expect a missing directory to be reported")
+	}
+}
@@ -0,0 +1,24 @@
+package impl
+
+//DefaultCompiledFormula default implementation of model.CompiledFormula
+type DefaultCompiledFormula struct {
+	script    string
+	program   interface{}
+	functions []string
+}
+
+//Script getting the source of the formula
+func (cf DefaultCompiledFormula) Script() string {
+
+	return cf.script
+}
+
+//Functions getting names of functions (both built-in & custom)
+//referred by the formula
+func (cf DefaultCompiledFormula) Functions() []string {
+
+	functions := make([]string, len(cf.functions))
+	copy(functions, cf.functions)
+
+	return functions
+}
@@ -2,6 +2,7 @@ package impl
 
 import (
 	"github.com/lertrel/goforit/model"
+	"github.com/lertrel/goforit/parse"
 	"github.com/lertrel/goforit/util"
 	"github.com/lertrel/goforit/vm"
 )
@@ -16,6 +17,37 @@ type DefaultFormula struct {
 	// BuiltInFuncs map[int]BuiltInFunctions
 	BuiltInFuncs []vm.BuiltInFunctions
 	Debug        bool
+	//Limits default resource budgets of every FormulaContext
+	Limits model.Limits
+	//Lenient if true, unknown functions are left unresolved (for being
+	//defined at runtime) instead of failing FormulaContext.Prepare
+	Lenient bool
+	//Parser extracting function names from scripts, nil for using VM
+	Parser parse.Parser
+	//Deterministic if true, every run of every FormulaContext draws random
+	//numbers from a PRNG seeded per run (see model.WithSeed), and reads
+	//the current time (Date.now and new Date()) from Clock
+	Deterministic bool
+	//Clock the current time of deterministic runs, nil for the system time
+	Clock model.Clock
+	//Err an error of building the Formula (e.g., a Go function which isn't
+	//supported), returned by NewContext, Compile and NewContextPool
+	Err      error
+	template *vmTemplate
+}
+
+//EnableTemplate making every FormulaContext created by the returned
+//Formula start from a copy of a template VM having all built-in and
+//custom functions loaded, the template is rebuilt automatically when
+//a custom function is registered through RegisterCustomFunction
+//
+//*NOTE* the template is set into VM (vm.Driver), so the driver must
+//not be shared with another Formula
+func (f DefaultFormula) EnableTemplate() DefaultFormula {
+
+	f.template = newVMTemplate()
+
+	return f
 }
 
 //Driver is a method for getting vm.Driver implementation
@@ -41,7 +73,13 @@ func (f DefaultFormula) debug(format string, args ...interface{}) {
 //
 func (f DefaultFormula) RegisterCustomFunction(funcName string, body string) bool {
 
-	return f.CustomFuncs[0].RegisterFunction(funcName, body)
+	found := f.CustomFuncs[0].RegisterFunction(funcName, body)
+
+	if f.template != nil {
+		f.template.invalidate()
+	}
+
+	return found
 }
 
 //GetCustomFunctionBody to get custom function source code
@@ -61,22 +99,19 @@ func (f DefaultFormula) GetCustomFunctionBody(funcName string) string {
 
 func (f DefaultFormula) extractFunctionListFromFormulaString(formulaStr string) []string {
 
+	if f.Parser != nil {
+		return f.Parser.ExtractFunctionNames(formulaStr)
+	}
+
 	return f.VM.ExtractFunctionNames(formulaStr)
 }
 
 //NewContext is a method for creating a new FormulaContext
 func (f DefaultFormula) NewContext(script string) (c model.FormulaContext, err error) {
 
-	vm, err := f.VM.Get()
+	c, err = f.newContext()
 	if err != nil {
-		return
-	}
-
-	c = DefaultFormulaContext{
-		VM:          vm,
-		loadedFuncs: make(map[string]bool),
-		formula:     f,
-		Debug:       f.Debug,
+		return nil, err
 	}
 
 	if script != "" {
@@ -88,6 +123,281 @@ func (f DefaultFormula) NewContext(script string) (c model.FormulaContext, err e
 	return
 }
 
+//Compile parsing the given script, and resolving functions referred
+//by the script once, so it can be run many times by any FormulaContext
+//(through FormulaContext.RunCompiled) without being re-parsed
+//
+//Ex.
+//
+// 		cf, err := f.Compile("$CIRCLE(r)")
+// 		if err != nil {
+// 			panic(err)
+// 		}
+//
+// 		c, _ := f.NewContext("")
+// 		c.Set("r", 5)
+//
+// 		area, err := c.RunCompiled(cf)
+//
+func (f DefaultFormula) Compile(script string) (model.CompiledFormula, error) {
+
+	if f.Err != nil {
+		return nil, f.Err
+	}
+
+	program := f.thunkLazyArguments(script)
+	if program == nil {
+		var err error
+		if program, err = f.VM.Compile(script); err != nil {
+			return nil, err
+		}
+	}
+
+	functions := f.extractFunctionListFromFormulaString(script)
+
+	if !f.Lenient {
+		unknown := make(map[string]bool)
+		resolved := make(map[string]bool)
+
+		for _, funcName := range functions {
+			f.collectUnresolvable(funcName, unknown, resolved, make(map[string]bool))
+		}
+
+		if len(unknown) > 0 {
+			return nil, newUnknownFunctionError(unknown)
+		}
+	}
+
+	return DefaultCompiledFormula{
+		script:    script,
+		program:   program,
+		functions: functions,
+	}, nil
+}
+
+//NewContextPool creating a FormulaContextPool handing out FormulaContext(s)
+//pre-loaded with functions given by the config
+//
+//Ex.
+//
+// 		pool, err := f.NewContextPool(model.PoolConfig{
+// 			InitialSize: 8,
+// 			Functions:   []string{"$LOAN"},
+// 		})
+//
+// 		c, err := pool.Get()
+// 		if err != nil {
+// 			panic(err)
+// 		}
+// 		defer pool.Put(c)
+//
+func (f DefaultFormula) NewContextPool(config model.PoolConfig) (model.FormulaContextPool, error) {
+
+	return newFormulaContextPool(f, config)
+}
+
+func (f DefaultFormula) newContext() (DefaultFormulaContext, error) {
+
+	if f.Err != nil {
+		return DefaultFormulaContext{}, f.Err
+	}
+
+	var v vm.VM
+	var loadedFuncs map[string]bool
+	var err error
+
+	if f.template != nil {
+		v, loadedFuncs, err = f.template.newVM(f)
+	} else {
+		v, err = f.VM.Get()
+		loadedFuncs = make(map[string]bool)
+	}
+
+	if err != nil {
+		return DefaultFormulaContext{}, err
+	}
+
+	v.SetLimits(f.Limits)
+
+	if f.Deterministic {
+		if err = v.SetDeterministic(f.Clock); err != nil {
+			return DefaultFormulaContext{}, err
+		}
+	}
+
+	return DefaultFormulaContext{
+		VM:          v,
+		loadedFuncs: loadedFuncs,
+		formula:     f,
+		Debug:       f.Debug,
+		thunks:      make(map[string]interface{}),
+	}, nil
+}
+
+//listFunctions getting names of all built-in and custom functions
+//provided by BuiltInFuncs and CustomFuncs implementing vm.FunctionLister
+func (f DefaultFormula) listFunctions() []string {
+
+	names := make([]string, 0)
+
+	for _, funcs := range f.BuiltInFuncs {
+		if lister, ok := funcs.(vm.FunctionLister); ok {
+			names = append(names, lister.FunctionNames()...)
+		}
+	}
+
+	for _, repo := range f.CustomFuncs {
+		if lister, ok := repo.(vm.FunctionLister); ok {
+			names = append(names, lister.FunctionNames()...)
+		}
+	}
+
+	return names
+}
+
+//functionsVersion getting the sum of versions of CustomFuncs implementing
+//vm.FunctionVersioner, which is changed once any of them is changed
+func (f DefaultFormula) functionsVersion() uint64 {
+
+	var version uint64
+
+	for _, repo := range f.CustomFuncs {
+		if versioner, ok := repo.(vm.FunctionVersioner); ok {
+			version += versioner.FunctionsVersion()
+		}
+	}
+
+	return version
+}
+
+//ListBuiltInFunctions getting signatures of all built-in functions
+//(of every BuiltInFunctions which is able to describe its functions)
+func (f DefaultFormula) ListBuiltInFunctions() []model.FunctionSignature {
+
+	signatures := make([]model.FunctionSignature, 0)
+	listed := make(map[string]bool)
+
+	for _, funcs := range f.BuiltInFuncs {
+
+		describer, ok := funcs.(vm.BuiltInDescriber)
+		if !ok {
+			continue
+		}
+
+		//The first BuiltInFunctions having a function wins (as in Execute)
+		for _, signature := range describer.List() {
+			if !listed[signature.Name] {
+				listed[signature.Name] = true
+				signatures = append(signatures, signature)
+			}
+		}
+	}
+
+	return signatures
+}
+
+//DescribeBuiltInFunction getting signature of the given built-in
+//function (or alias)
+func (f DefaultFormula) DescribeBuiltInFunction(funcName string) (model.FunctionSignature, bool) {
+
+	for _, funcs := range f.BuiltInFuncs {
+
+		if !funcs.Has(funcName) {
+			continue
+		}
+
+		if describer, ok := funcs.(vm.BuiltInDescriber); ok {
+			return describer.Describe(funcName)
+		}
+
+		break
+	}
+
+	return model.FunctionSignature{}, false
+}
+
+//thunkLazyArguments getting a program (for VM.RunCompiled) of the given
+//script whose lazy arguments (see model.Param.Lazy) of built-in functions
+//are wrapped into thunks, nil if the script has no lazy argument
+func (f DefaultFormula) thunkLazyArguments(script string) interface{} {
+
+	lazyFuncs := make(map[string]model.FunctionSignature)
+
+	for _, funcName := range f.extractFunctionListFromFormulaString(script) {
+		if signature, found := f.DescribeBuiltInFunction(funcName); found && signature.Lazy() {
+			lazyFuncs[funcName] = signature
+		}
+	}
+
+	if len(lazyFuncs) == 0 {
+		return nil
+	}
+
+	program := parse.ThunkLazyArguments(script, func(funcName string, index int) bool {
+		param, found := lazyFuncs[funcName].Param(index)
+		return found && param.Lazy
+	})
+
+	if program == nil {
+		return nil
+	}
+
+	return program
+}
+
+func (f DefaultFormula) isBuiltInFunction(funcName string) bool {
+
+	for _, funcs := range f.BuiltInFuncs {
+		if funcs.Has(funcName) {
+			return true
+		}
+	}
+
+	return false
+}
+
+//isResolvable telling if the given function and all functions it refers to
+//(transitively) are either built-in or custom functions
+func (f DefaultFormula) isResolvable(funcName string, resolved map[string]bool, visiting map[string]bool) bool {
+
+	return f.collectUnresolvable(funcName, make(map[string]bool), resolved, visiting)
+}
+
+//collectUnresolvable putting names of functions which are neither built-in
+//nor custom functions (referred by the given function transitively) into
+//unknown, and telling if the given function is resolvable
+func (f DefaultFormula) collectUnresolvable(funcName string, unknown map[string]bool, resolved map[string]bool, visiting map[string]bool) bool {
+
+	if ok, found := resolved[funcName]; found && ok {
+		return ok
+	}
+
+	if visiting[funcName] || f.isBuiltInFunction(funcName) {
+		return true
+	}
+
+	body := f.GetCustomFunctionBody(funcName)
+	if body == "" {
+		unknown[funcName] = true
+		resolved[funcName] = false
+		return false
+	}
+
+	visiting[funcName] = true
+	ok := true
+
+	for _, subFunc := range f.extractFunctionListFromFormulaString(body) {
+		if !f.collectUnresolvable(subFunc, unknown, resolved, visiting) {
+			ok = false
+		}
+	}
+
+	delete(visiting, funcName)
+	resolved[funcName] = ok
+
+	return ok
+}
+
 //LoadContext If context is nil then create a new FormulaContext
 //Then preparing a newly created context or a given context
 //By loading referred functions (both built-in & custom) into context
@@ -136,7 +446,9 @@ func (f DefaultFormula) NewContext(script string) (c model.FormulaContext, err e
 // 	return
 // }
 
-func (f DefaultFormula) injectFuncToContext(context *DefaultFormulaContext, funcName string) error {
+//injectFuncToContext loading the given function (and functions it refers to)
+//into the given context, names which can't be resolved are put into unknown
+func (f DefaultFormula) injectFuncToContext(context *DefaultFormulaContext, funcName string, unknown map[string]bool) error {
 
 	f.debug("Formula.injectFuncToContext() started ...")
 
@@ -172,20 +484,27 @@ func (f DefaultFormula) injectFuncToContext(context *DefaultFormulaContext, func
 			f.debug("Formula.injectFuncToContext() - funcList[i]=%v", funcList[i])
 			subFunc := funcList[i]
 			if subFunc != funcName {
-				err := f.injectFuncToContext(context, subFunc)
+				err := f.injectFuncToContext(context, subFunc, unknown)
 				if err != nil {
+					context.unmarkFuncAsLoaded(funcName)
 					return err
 				}
 			}
 		}
 
-		context.markFuncAsLoaded(funcName, true)
-
 		_, err := context.Run(body)
 		if err != nil {
+			//Left to be loaded again (e.g., after being fixed)
+			context.unmarkFuncAsLoaded(funcName)
 			return err
 		}
 
+		context.markFuncAsLoaded(funcName, true)
+
+	} else {
+
+		f.debug("Formula.injectFuncToContext() - %v is unknown", funcName)
+		unknown[funcName] = true
 	}
 
 	f.debug("Formula.injectFuncToContext() ended ...")
@@ -1,6 +1,10 @@
 package impl
 
 import (
+	"context"
+	"fmt"
+	"sort"
+
 	"github.com/lertrel/goforit/model"
 	"github.com/lertrel/goforit/util"
 	"github.com/lertrel/goforit/vm"
@@ -14,28 +18,60 @@ type DefaultFormulaContext struct {
 	loadedFuncs map[string]bool
 	formula     DefaultFormula
 	Debug       bool
+	pooled      *pooledState
+	thunks      map[string]interface{}
 }
 
+//maxThunks the most scripts of which a context keeps programs
+//having lazy arguments wrapped into thunks
+const maxThunks = 64
+
 //Prepare If context is nil then create a new FormulaContext
 //Then preparing a newly created context or a given context
 //By loading referred functions (both built-in & custom) into context
+//
+//*model.UnknownFunctionError is returned if any referred function can't be
+//resolved, unless the formula is lenient (FormulaBuilder.SetLenient)
 func (c DefaultFormulaContext) Prepare(formulaStr string) error {
 
 	c.debug("DefualtFormulaContext.Prepare() - Extracting function names from %v", formulaStr)
 	funcList := c.formula.extractFunctionListFromFormulaString(formulaStr)
+	unknown := make(map[string]bool)
 
 	for i := 0; i < len(funcList); i++ {
 
 		c.debug("DefualtFormulaContext.Prepare() - funcList[i]=%v", funcList[i])
-		err := c.formula.injectFuncToContext(&c, funcList[i])
+		err := c.formula.injectFuncToContext(&c, funcList[i], unknown)
 		if err != nil {
 			return err
 		}
 	}
 
+	if len(unknown) > 0 && !c.formula.Lenient {
+		return newUnknownFunctionError(unknown)
+	}
+
+	//Rewriting lazy arguments once, instead of every run
+	c.thunkLazyArguments(formulaStr)
+
 	return nil
 }
 
+var backgroundContext = context.Background()
+
+func newUnknownFunctionError(unknown map[string]bool) error {
+
+	names := make([]string, 0, len(unknown))
+
+	for name := range unknown {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return &model.UnknownFunctionError{Names: names}
+}
+
 // func (c FormulaContext) GetVM() *otto.Otto {
 //
 // 	return c.vm
@@ -66,7 +102,120 @@ func (c DefaultFormulaContext) Prepare(formulaStr string) error {
 //
 func (c DefaultFormulaContext) Run(formulaString string) (model.Value, error) {
 
-	return c.VM.Run(formulaString)
+	return c.RunContext(backgroundContext, formulaString)
+}
+
+//RunContext is the same as Run, but the execution will be interrupted
+//once the given ctx is done (deadline exceeded or cancelled), in which
+//case an *model.InterruptedError is returned
+//
+// Ex.
+//
+// 		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+// 		defer cancel()
+//
+// 		_, err := c.RunContext(ctx, "while(true){}")
+// 		if errors.Is(err, model.ErrTimeout) {
+// 			t.Log("timed out")
+// 		}
+//
+func (c DefaultFormulaContext) RunContext(ctx context.Context, formulaString string) (model.Value, error) {
+
+	if program := c.thunkLazyArguments(formulaString); program != nil {
+		return c.VM.RunCompiled(ctx, program)
+	}
+
+	return c.VM.RunContext(ctx, formulaString)
+}
+
+//thunkLazyArguments getting a program of the given script whose lazy
+//arguments are wrapped into thunks (see DefaultFormula.thunkLazyArguments)
+//kept by the context, the script is rewritten (and kept) if not found
+func (c DefaultFormulaContext) thunkLazyArguments(script string) interface{} {
+
+	if program, found := c.thunks[script]; found {
+		return program
+	}
+
+	program := c.formula.thunkLazyArguments(script)
+
+	if c.thunks != nil {
+		if len(c.thunks) >= maxThunks {
+			for kept := range c.thunks {
+				delete(c.thunks, kept)
+			}
+		}
+		c.thunks[script] = program
+	}
+
+	return program
+}
+
+//RunCompiled running a formula compiled by Formula.Compile, functions
+//referred by the formula are loaded into the context if needed
+//
+// Ex.
+//
+// 		cf, err := f.Compile("$SUMI(a, b)")
+// 		if err != nil {
+// 			t.Error(err)
+// 		}
+//
+// 		c.Set("a", 1)
+// 		c.Set("b", 2)
+//
+// 		jsI, runtimeError := c.RunCompiled(cf)
+//
+func (c DefaultFormulaContext) RunCompiled(cf model.CompiledFormula) (model.Value, error) {
+
+	return c.RunCompiledContext(backgroundContext, cf)
+}
+
+//RunCompiledContext is the same as RunCompiled, but the execution will
+//be interrupted once the given ctx is done (see RunContext)
+func (c DefaultFormulaContext) RunCompiledContext(ctx context.Context, cf model.CompiledFormula) (model.Value, error) {
+
+	compiled, ok := cf.(DefaultCompiledFormula)
+	if !ok {
+		return nil, fmt.Errorf("DefaultFormulaContext.RunCompiled() - unsupported CompiledFormula %T", cf)
+	}
+
+	unknown := make(map[string]bool)
+
+	for _, funcName := range compiled.functions {
+
+		if err := c.formula.injectFuncToContext(&c, funcName, unknown); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(unknown) > 0 && !c.formula.Lenient {
+		return nil, newUnknownFunctionError(unknown)
+	}
+
+	return c.VM.RunCompiled(ctx, compiled.program)
+}
+
+//SetLimits overriding resource budgets (given by FormulaBuilder) of
+//the current context, a run hitting any of the limits will be aborted
+//with *model.LimitError
+func (c DefaultFormulaContext) SetLimits(limits model.Limits) {
+
+	c.VM.SetLimits(limits)
+}
+
+//Limits getting resource budgets of the current context
+func (c DefaultFormulaContext) Limits() model.Limits {
+
+	return c.VM.Limits()
+}
+
+//Seed getting the random seed of the last run of a deterministic Formula,
+//which replays the run when passed back through model.WithSeed, zero if
+//the Formula isn't deterministic
+func (c DefaultFormulaContext) Seed() int64 {
+
+	return c.VM.Seed()
 }
 
 // func (c FormulaContext) Run(formulaString string) (JSValue, error) {
@@ -184,3 +333,9 @@ func (c *DefaultFormulaContext) markFuncAsLoaded(funcName string, loaded bool) {
 	c.loadedFuncs[funcName] = loaded
 	c.debug("FormulaContext.markFuncAsLoaded(after) - c.loadedFunc=%v", c.loadedFuncs)
 }
+
+//unmarkFuncAsLoaded forgetting the given function, so it will be loaded again
+func (c *DefaultFormulaContext) unmarkFuncAsLoaded(funcName string) {
+
+	delete(c.loadedFuncs, funcName)
+}
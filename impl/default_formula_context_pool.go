@@ -0,0 +1,241 @@
+package impl
+
+import (
+	"sync"
+
+	"github.com/lertrel/goforit/model"
+)
+
+//DefaultFormulaContextPool default implementation of model.FormulaContextPool
+type DefaultFormulaContextPool struct {
+	formula DefaultFormula
+	config  model.PoolConfig
+	mutex   sync.Mutex
+	idle    []DefaultFormulaContext
+	stats   model.PoolStats
+	//warmed a context having functions of config loaded, which is never
+	//given out, but every context of the pool is a copy of it
+	warmed DefaultFormulaContext
+	//version versions of custom functions (see DefaultFormula.functionsVersion)
+	//loaded into warmed
+	version uint64
+}
+
+//pooledState states of a DefaultFormulaContext created by a pool
+type pooledState struct {
+	pool *DefaultFormulaContextPool
+	//version versions of custom functions loaded into the context
+	version uint64
+	//inUse the context is obtained but not yet given back
+	inUse bool
+}
+
+func newFormulaContextPool(f DefaultFormula, config model.PoolConfig) (*DefaultFormulaContextPool, error) {
+
+	p := &DefaultFormulaContextPool{
+		formula: f,
+		config:  config,
+		idle:    make([]DefaultFormulaContext, 0, config.InitialSize),
+	}
+
+	if err := p.warm(); err != nil {
+		return nil, err
+	}
+
+	for i := 0; i < config.InitialSize; i++ {
+
+		c, err := p.copyOf(p.warmed, p.version)
+		if err != nil {
+			return nil, err
+		}
+
+		p.idle = append(p.idle, c)
+		p.stats.Created++
+	}
+
+	return p, nil
+}
+
+//Get obtaining a FormulaContext from the pool, a new one is created
+//if no idle FormulaContext is available
+func (p *DefaultFormulaContextPool) Get() (model.FormulaContext, error) {
+
+	p.mutex.Lock()
+	p.stats.Gets++
+
+	if err := p.refresh(); err != nil {
+		p.mutex.Unlock()
+		return nil, err
+	}
+
+	if size := len(p.idle); size > 0 {
+
+		c := p.idle[size-1]
+		p.idle = p.idle[:size-1]
+		c.pooled.inUse = true
+		p.stats.Hits++
+		p.stats.InUse++
+		p.mutex.Unlock()
+
+		return c, nil
+	}
+
+	p.stats.Misses++
+	warmed, version := p.warmed, p.version
+	p.mutex.Unlock()
+
+	c, err := p.copyOf(warmed, version)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mutex.Lock()
+	c.pooled.inUse = true
+	p.stats.Created++
+	p.stats.InUse++
+	p.mutex.Unlock()
+
+	return c, nil
+}
+
+//Put giving a FormulaContext back to the pool, the pool keeps a fresh
+//copy of the warmed up context instead, so variables set by the user (or
+//the formulas), changes to functions and built-in objects (e.g., Math),
+//and limits are not seen by the next one obtaining it
+//
+//A FormulaContext which isn't obtained from the pool, or is already
+//given back, is ignored
+func (p *DefaultFormulaContextPool) Put(c model.FormulaContext) {
+
+	p.mutex.Lock()
+	p.stats.Puts++
+
+	context, ok := c.(DefaultFormulaContext)
+	if !ok || context.pooled == nil || context.pooled.pool != p {
+		p.stats.Discarded++
+		p.mutex.Unlock()
+		return
+	}
+
+	if !context.pooled.inUse {
+		//Given back twice
+		p.mutex.Unlock()
+		return
+	}
+
+	context.pooled.inUse = false
+	p.stats.InUse--
+
+	if p.refresh() != nil || context.pooled.version != p.version || p.full() {
+		p.stats.Discarded++
+		p.mutex.Unlock()
+		return
+	}
+
+	warmed, version := p.warmed, p.version
+	p.mutex.Unlock()
+
+	fresh, err := p.copyOf(warmed, version)
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	//Functions could be changed, or the pool could be filled up meanwhile
+	if err != nil || version != p.version || p.full() {
+		p.stats.Discarded++
+		return
+	}
+
+	p.idle = append(p.idle, fresh)
+}
+
+//full telling if no more idle context can be kept,
+//p.mutex must be locked by the caller
+func (p *DefaultFormulaContextPool) full() bool {
+
+	return p.config.MaxIdle > 0 && len(p.idle) >= p.config.MaxIdle
+}
+
+//Stats getting statistics of the pool
+func (p *DefaultFormulaContextPool) Stats() model.PoolStats {
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	stats := p.stats
+	stats.Idle = len(p.idle)
+
+	return stats
+}
+
+//warm creating the warmed context with functions of config loaded
+func (p *DefaultFormulaContextPool) warm() error {
+
+	version := p.formula.functionsVersion()
+
+	c, err := p.formula.newContext()
+	if err != nil {
+		return err
+	}
+
+	unknown := make(map[string]bool)
+
+	for _, funcName := range p.config.Functions {
+
+		if err = p.formula.injectFuncToContext(&c, funcName, unknown); err != nil {
+			return err
+		}
+	}
+
+	if len(unknown) > 0 && !p.formula.Lenient {
+		return newUnknownFunctionError(unknown)
+	}
+
+	p.warmed = c
+	p.version = version
+
+	return nil
+}
+
+//refresh re-warming the pool and evicting idle contexts once custom
+//functions are changed (e.g., registered or reloaded), p.mutex must be
+//locked by the caller
+func (p *DefaultFormulaContextPool) refresh() error {
+
+	if p.formula.functionsVersion() == p.version {
+		return nil
+	}
+
+	if err := p.warm(); err != nil {
+		return err
+	}
+
+	p.idle = p.idle[:0]
+
+	return nil
+}
+
+//copyOf creating a new context of the pool by copying the given warmed
+//context (of the given version of custom functions)
+func (p *DefaultFormulaContextPool) copyOf(warmed DefaultFormulaContext, version uint64) (DefaultFormulaContext, error) {
+
+	v, err := warmed.VM.Copy()
+	if err != nil {
+		return DefaultFormulaContext{}, err
+	}
+
+	v.SetLimits(p.formula.Limits)
+
+	loadedFuncs := make(map[string]bool, len(warmed.loadedFuncs))
+	for funcName, loaded := range warmed.loadedFuncs {
+		loadedFuncs[funcName] = loaded
+	}
+
+	c := warmed
+	c.VM = v
+	c.loadedFuncs = loadedFuncs
+	c.thunks = make(map[string]interface{})
+	c.pooled = &pooledState{pool: p, version: version}
+
+	return c, nil
+}
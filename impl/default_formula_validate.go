@@ -0,0 +1,125 @@
+package impl
+
+import (
+	"fmt"
+
+	"github.com/lertrel/goforit/model"
+	"github.com/lertrel/goforit/parse"
+	"github.com/lertrel/goforit/vm"
+)
+
+//Validate checking the given script, and custom functions it calls
+//(transitively) without running them, see model.Formula
+func (f DefaultFormula) Validate(script string) []model.Diagnostic {
+
+	diagnostics, customFuncs := f.validate(script, "")
+	visited := make(map[string]bool)
+
+	//customFuncs grows while validating custom function bodies
+	for i := 0; i < len(customFuncs); i++ {
+
+		funcName := customFuncs[i]
+		if visited[funcName] {
+			continue
+		}
+		visited[funcName] = true
+
+		found, subFuncs := f.validate(f.GetCustomFunctionBody(funcName), funcName)
+		diagnostics = append(diagnostics, found...)
+		customFuncs = append(customFuncs, subFuncs...)
+	}
+
+	return diagnostics
+}
+
+//validate checking the given script (a formula or body of the given custom
+//function), returning problems found and custom functions it calls
+func (f DefaultFormula) validate(script string, funcName string) (diagnostics []model.Diagnostic, customFuncs []string) {
+
+	diagnostics = parse.NewLinter().Lint(script)
+
+	sites, err := parse.NewASTParser().CallSites(script)
+	if err != nil {
+		//Syntax errors are already reported by Linter
+		return withFunction(diagnostics, funcName), nil
+	}
+
+	unknownSeverity := model.SeverityError
+	if f.Lenient {
+		unknownSeverity = model.SeverityWarning
+	}
+
+	for _, site := range sites {
+
+		if !site.Global() {
+			continue
+		}
+
+		d := model.Diagnostic{Line: site.Line, Column: site.Column}
+
+		if f.isBuiltInFunction(site.Name) {
+
+			min, max, found := f.builtInArity(site.Name)
+			if !found || site.Args < 0 || (site.Args >= min && (max < 0 || site.Args <= max)) {
+				continue
+			}
+
+			d.Code = model.DiagnosticArity
+			d.Severity = model.SeverityError
+			d.Message = fmt.Sprintf("%s expects %s but got %d", site.Name, describeArity(min, max), site.Args)
+
+		} else if f.GetCustomFunctionBody(site.Name) != "" {
+
+			customFuncs = append(customFuncs, site.Name)
+			continue
+
+		} else {
+
+			d.Code = model.DiagnosticUnknownFunction
+			d.Severity = unknownSeverity
+			d.Message = fmt.Sprintf("%s is neither built-in nor custom function", site.Name)
+		}
+
+		diagnostics = append(diagnostics, d)
+	}
+
+	return withFunction(diagnostics, funcName), customFuncs
+}
+
+func (f DefaultFormula) builtInArity(funcName string) (min int, max int, found bool) {
+
+	for _, funcs := range f.BuiltInFuncs {
+		if !funcs.Has(funcName) {
+			continue
+		}
+
+		if arity, ok := funcs.(vm.BuiltInArity); ok {
+			return arity.Arity(funcName)
+		}
+
+		return 0, 0, false
+	}
+
+	return 0, 0, false
+}
+
+func describeArity(min int, max int) string {
+
+	switch {
+	case max < 0:
+		return fmt.Sprintf("at least %d argument(s)", min)
+	case min == max:
+		return fmt.Sprintf("%d argument(s)", min)
+	default:
+		return fmt.Sprintf("%d to %d arguments", min, max)
+	}
+}
+
+func withFunction(diagnostics []model.Diagnostic, funcName string) []model.Diagnostic {
+
+	for i := range diagnostics {
+		diagnostics[i].Function = funcName
+	}
+
+	return diagnostics
+}
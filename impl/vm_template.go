@@ -0,0 +1,124 @@
+package impl
+
+import (
+	"sync"
+
+	"github.com/lertrel/goforit/vm"
+)
+
+//vmTemplate maintaining a template VM (set into vm.Driver) having
+//all built-in and custom functions loaded, so a new FormulaContext
+//is started from a copy of the template instead of re-parsing functions
+type vmTemplate struct {
+	mutex sync.RWMutex
+	//dirty the template has to be (re)built before being used
+	dirty bool
+	//loadedFuncs functions which are ready to use in the template
+	loadedFuncs map[string]bool
+	//version versions of custom functions the template was built with
+	version uint64
+}
+
+func newVMTemplate() *vmTemplate {
+
+	return &vmTemplate{dirty: true}
+}
+
+//invalidate marking the template to be rebuilt on the next use
+func (t *vmTemplate) invalidate() {
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.dirty = true
+}
+
+//newVM getting a copy of the template VM together with names of
+//functions loaded in it, the template is rebuilt if needed
+func (t *vmTemplate) newVM(f DefaultFormula) (vm.VM, map[string]bool, error) {
+
+	version := f.functionsVersion()
+
+	t.mutex.RLock()
+
+	if t.dirty || t.version != version {
+		t.mutex.RUnlock()
+		t.mutex.Lock()
+
+		if t.dirty || t.version != version {
+			if err := t.build(f, version); err != nil {
+				t.mutex.Unlock()
+				return nil, nil, err
+			}
+		}
+
+		t.mutex.Unlock()
+		t.mutex.RLock()
+	}
+
+	defer t.mutex.RUnlock()
+
+	v, err := f.VM.Get()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	loadedFuncs := make(map[string]bool, len(t.loadedFuncs))
+	for funcName := range t.loadedFuncs {
+		loadedFuncs[funcName] = true
+	}
+
+	return v, loadedFuncs, nil
+}
+
+//build building the template VM of the given version of custom functions,
+//t.mutex must be locked by the caller
+func (t *vmTemplate) build(f DefaultFormula, version uint64) error {
+
+	f.debug("vmTemplate.build() started ...")
+
+	f.VM.SetTemplate(nil)
+
+	v, err := f.VM.Get()
+	if err != nil {
+		return err
+	}
+
+	c := DefaultFormulaContext{
+		VM:          v,
+		loadedFuncs: make(map[string]bool),
+		formula:     f,
+		Debug:       f.Debug,
+	}
+
+	unknown := make(map[string]bool)
+
+	for _, funcName := range f.listFunctions() {
+
+		//A broken custom function will be reported when it's used
+		if err := f.injectFuncToContext(&c, funcName, unknown); err != nil {
+			f.debug("vmTemplate.build() - failed to load %v: %v", funcName, err)
+		}
+	}
+
+	loadedFuncs := make(map[string]bool, len(c.loadedFuncs))
+	resolved := make(map[string]bool)
+
+	for funcName, loaded := range c.loadedFuncs {
+
+		//Functions relying on unknown functions are left to be loaded
+		//by FormulaContext.Prepare, so the unknown ones are reported
+		if loaded && (f.Lenient || f.isResolvable(funcName, resolved, make(map[string]bool))) {
+			loadedFuncs[funcName] = true
+		}
+	}
+
+	f.VM.SetTemplate(v)
+	t.loadedFuncs = loadedFuncs
+	t.version = version
+	t.dirty = false
+
+	f.debug("vmTemplate.build() ended ...")
+
+	return nil
+}
@@ -0,0 +1,37 @@
+package model
+
+import (
+	"context"
+	"time"
+)
+
+//asOfKey the key of the as-of date carried by context.Context
+type asOfKey struct{}
+
+//WithAsOf getting a copy of the given ctx carrying the given as-of date,
+//which parameters ($PARAM) of a run (FormulaContext.RunContext) are
+//resolved as of, instead of the current date of the Formula's clock
+//
+//Ex.
+//
+// 		ctx := model.WithAsOf(context.Background(), time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+//
+// 		//VAT rate effective on 2020-01-01
+// 		v, err := c.RunContext(ctx, `$PARAM("VAT_RATE")`)
+//
+func WithAsOf(ctx context.Context, asOf time.Time) context.Context {
+
+	return context.WithValue(ctx, asOfKey{}, asOf)
+}
+
+//AsOf getting the as-of date carried by the given ctx, false if none
+func AsOf(ctx context.Context) (time.Time, bool) {
+
+	if ctx == nil {
+		return time.Time{}, false
+	}
+
+	asOf, found := ctx.Value(asOfKey{}).(time.Time)
+
+	return asOf, found
+}
@@ -0,0 +1,15 @@
+package model
+
+import "time"
+
+//Calendar telling business days e.g., of a country or an exchange,
+//which is registered on a Formula under a name (see FormulaBuilder.AddCalendar)
+//and used by $WORKDAY, $NETWORKDAYS and $ISBUSINESSDAY
+type Calendar interface {
+
+	//IsWeekend telling if the (calendar) date of the given time is a weekend
+	IsWeekend(date time.Time) bool
+
+	//IsHoliday telling if the (calendar) date of the given time is a holiday
+	IsHoliday(date time.Time) bool
+}
@@ -0,0 +1,37 @@
+package model
+
+import "time"
+
+//Clock providing the current time to date functions e.g., $NOW and $TODAY,
+//so formulas can be run deterministically (e.g., in tests or back-dated
+//recalculations)
+//
+//Ex.
+//
+// 		f := goforit.NewFormulaBuilder().
+// 			SetClock(model.FixedClock(time.Date(2020, 12, 31, 0, 0, 0, 0, time.UTC))).
+// 			Get()
+//
+type Clock interface {
+	//Now getting the current time
+	Now() time.Time
+}
+
+//ClockFunc an adapter allowing an ordinary function to be a Clock
+type ClockFunc func() time.Time
+
+//Now calling f()
+func (f ClockFunc) Now() time.Time {
+	return f()
+}
+
+//SystemClock a Clock reading the system time
+var SystemClock Clock = ClockFunc(time.Now)
+
+//FixedClock getting a Clock which always returns the given time
+func FixedClock(t time.Time) Clock {
+
+	return ClockFunc(func() time.Time {
+		return t
+	})
+}
@@ -0,0 +1,28 @@
+package model
+
+//CompiledFormula a formula parsed once by Formula.Compile, having its
+//functions resolved, so it can be run many times (by any FormulaContext
+//created by the same Formula) without being re-parsed
+//
+//Ex.
+//
+// 		cf, err := f.Compile("$CIRCLE(r)")
+// 		if err != nil {
+// 			panic(err)
+// 		}
+//
+// 		for _, r := range []float64{1, 2, 3} {
+// 			c.Set("r", r)
+// 			area, err := c.RunCompiled(cf)
+// 			...
+// 		}
+//
+type CompiledFormula interface {
+
+	//Script getting the source of the formula
+	Script() string
+
+	//Functions getting names of functions (both built-in & custom)
+	//referred by the formula
+	Functions() []string
+}
@@ -0,0 +1,102 @@
+package model
+
+import (
+	"errors"
+	"math/big"
+	"regexp"
+	"strings"
+)
+
+//decimalPattern the grammar of ParseDecimal, big.Rat would also take
+//fractions (e.g., "1/3") and other bases (e.g., "0x10")
+var decimalPattern = regexp.MustCompile(`^[+-]?(\d+\.?\d*|\.\d+)([eE][+-]?\d+)?$`)
+
+//DefaultDecimalScale number of decimal places kept when a decimal
+//can't be represented exactly e.g., 1/3 or a division without scale
+const DefaultDecimalScale = 16
+
+//ParseDecimal parsing a decimal string e.g., "1234.50", "-0.001", "1e-3"
+//into an exact number
+func ParseDecimal(s string) (*big.Rat, error) {
+
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, errors.New("empty decimal")
+	}
+
+	if !decimalPattern.MatchString(s) {
+		return nil, errors.New("invalid decimal " + s)
+	}
+
+	d, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return nil, errors.New("invalid decimal " + s)
+	}
+
+	return d, nil
+}
+
+//FormatDecimal formatting the given number as a decimal string without
+//trailing zeros, a number having no exact decimal representation
+//(e.g., 1/3) is rounded (half-even) to DefaultDecimalScale places
+//
+//Ex.
+//	FormatDecimal(big.NewRat(3, 10)) // "0.3"
+//	FormatDecimal(big.NewRat(2, 3)) // "0.6666666666666667"
+func FormatDecimal(d *big.Rat) string {
+
+	if scale, exact := decimalScale(d); exact {
+		return d.FloatString(scale)
+	}
+
+	s := FormatDecimalScale(d, DefaultDecimalScale, RoundHalfEven)
+	s = strings.TrimRight(s, "0")
+
+	return strings.TrimSuffix(s, ".")
+}
+
+//FormatDecimalScale formatting the given number as a decimal string
+//having exactly the given number of decimal places, rounded by the given
+//mode, a negative scale rounds to tens, hundreds, ...
+//
+//Ex.
+//	FormatDecimalScale(big.NewRat(12, 10), 2, model.RoundHalfUp) // "1.20"
+//	FormatDecimalScale(big.NewRat(1250, 1), -2, model.RoundHalfEven) // "1200"
+func FormatDecimalScale(d *big.Rat, scale int, mode RoundingMode) string {
+
+	rounded := RoundDecimal(d, scale, mode)
+	if scale <= 0 {
+		return rounded.Num().String()
+	}
+
+	return rounded.FloatString(scale)
+}
+
+//decimalScale number of decimal places needed to represent the given
+//number exactly, false if it has no exact decimal representation
+func decimalScale(d *big.Rat) (int, bool) {
+
+	denom := new(big.Int).Set(d.Denom())
+	twos, fives := 0, 0
+	two, five := big.NewInt(2), big.NewInt(5)
+	m := new(big.Int)
+
+	for denom.Cmp(big.NewInt(1)) != 0 {
+		switch {
+		case m.Mod(denom, two).Sign() == 0:
+			denom.Quo(denom, two)
+			twos++
+		case m.Mod(denom, five).Sign() == 0:
+			denom.Quo(denom, five)
+			fives++
+		default:
+			return 0, false
+		}
+	}
+
+	if twos > fives {
+		return twos, true
+	}
+
+	return fives, true
+}
@@ -0,0 +1,91 @@
+package model
+
+import "fmt"
+
+//Severity how serious a Diagnostic is
+type Severity int
+
+const (
+	//SeverityError the formula will fail (or fail to run)
+	SeverityError Severity = iota
+	//SeverityWarning the formula runs, but likely not as intended
+	SeverityWarning
+)
+
+func (s Severity) String() string {
+
+	switch s {
+
+	case SeverityError:
+		return "error"
+	case SeverityWarning:
+		return "warning"
+	default:
+		return fmt.Sprintf("Severity(%d)", int(s))
+
+	}
+}
+
+//DiagnosticCode a category of Diagnostic
+type DiagnosticCode int
+
+const (
+	//DiagnosticSyntaxError the script can't be parsed
+	DiagnosticSyntaxError DiagnosticCode = iota
+	//DiagnosticUnknownFunction a function which is neither built-in
+	//nor custom function
+	DiagnosticUnknownFunction
+	//DiagnosticArity a built-in function called with a wrong number
+	//of arguments
+	DiagnosticArity
+	//DiagnosticUndeclaredGlobal a function assigning a variable which is
+	//not declared (by var), so it's leaked as a global variable
+	DiagnosticUndeclaredGlobal
+	//DiagnosticUnreachableCode a statement which can never be executed
+	//(e.g., after return)
+	DiagnosticUnreachableCode
+)
+
+func (c DiagnosticCode) String() string {
+
+	switch c {
+
+	case DiagnosticSyntaxError:
+		return "syntax-error"
+	case DiagnosticUnknownFunction:
+		return "unknown-function"
+	case DiagnosticArity:
+		return "arity"
+	case DiagnosticUndeclaredGlobal:
+		return "undeclared-global"
+	case DiagnosticUnreachableCode:
+		return "unreachable-code"
+	default:
+		return fmt.Sprintf("DiagnosticCode(%d)", int(c))
+
+	}
+}
+
+//Diagnostic a problem found by validating a formula (see Formula.Validate)
+type Diagnostic struct {
+	Code     DiagnosticCode
+	Severity Severity
+	Message  string
+	//Function the custom function in which the problem is found
+	//(Line and Column are relative to its body), empty for the formula
+	Function string
+	//Line 1-based line number (0 if unknown)
+	Line int
+	//Column 1-based column number (0 if unknown)
+	Column int
+}
+
+func (d Diagnostic) String() string {
+
+	where := fmt.Sprintf("%d:%d", d.Line, d.Column)
+	if d.Function != "" {
+		where = d.Function + ":" + where
+	}
+
+	return fmt.Sprintf("%s: %s: %s (%s)", where, d.Severity, d.Message, d.Code)
+}
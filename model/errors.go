@@ -0,0 +1,193 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+//ErrTimeout is matched (by errors.Is) by an InterruptedError
+//caused by an expired deadline
+var ErrTimeout = errors.New("formula execution timed out")
+
+//ErrCanceled is matched (by errors.Is) by an InterruptedError
+//caused by a cancelled context
+var ErrCanceled = errors.New("formula execution canceled")
+
+//InterruptedError is returned by FormulaContext.RunContext when a running
+//formula is interrupted because its context.Context is done
+//
+//Ex.
+//
+// 		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+// 		defer cancel()
+//
+// 		_, err := c.RunContext(ctx, "while(true){}")
+// 		if errors.Is(err, model.ErrTimeout) {
+// 			...
+// 		}
+//
+type InterruptedError struct {
+	//Err is the error returned by context.Context.Err()
+	Err error
+}
+
+//Error returning the error message
+func (e *InterruptedError) Error() string {
+	return e.reason().Error() + " - " + e.Err.Error()
+}
+
+//Unwrap returning the underlying context error
+//i.e., context.DeadlineExceeded or context.Canceled
+func (e *InterruptedError) Unwrap() error {
+	return e.Err
+}
+
+//Is telling if the current error is either ErrTimeout or ErrCanceled
+func (e *InterruptedError) Is(target error) bool {
+	return target == e.reason()
+}
+
+//Timeout telling if the interruption was caused by an expired deadline
+func (e *InterruptedError) Timeout() bool {
+	return errors.Is(e.Err, context.DeadlineExceeded)
+}
+
+func (e *InterruptedError) reason() error {
+
+	if e.Timeout() {
+		return ErrTimeout
+	}
+
+	return ErrCanceled
+}
+
+//ErrorKind a category of FormulaError
+type ErrorKind int
+
+const (
+	//ErrorKindRuntime a failure while executing a function
+	ErrorKindRuntime ErrorKind = iota
+	//ErrorKindArity a wrong number of arguments
+	ErrorKindArity
+	//ErrorKindType an argument having an unexpected type
+	ErrorKindType
+	//ErrorKindRange an argument being out of an acceptable range
+	ErrorKindRange
+)
+
+func (k ErrorKind) String() string {
+
+	switch k {
+
+	case ErrorKindRuntime:
+		return "runtime"
+	case ErrorKindArity:
+		return "arity"
+	case ErrorKindType:
+		return "type"
+	case ErrorKindRange:
+		return "range"
+	default:
+		return fmt.Sprintf("ErrorKind(%d)", int(k))
+
+	}
+}
+
+//FormulaError is returned by FormulaContext.Run (and Triggers.Execute)
+//when a function called by a formula fails, so the caller could tell
+//exactly what broke
+//
+//*NOTE* it isn't a JS exception, so the run is aborted even within
+//try/catch of the formula, $IFERROR is the way to fall back on it
+//
+//Ex.
+//
+// 		_, err := c.Run("$RND(1.5, 11)")
+//
+// 		var formulaErr *model.FormulaError
+// 		if errors.As(err, &formulaErr) {
+// 			// formulaErr.Function == "$RND"
+// 			// formulaErr.ArgIndex == 1
+// 			// formulaErr.Kind == model.ErrorKindRange
+// 		}
+//
+type FormulaError struct {
+	//Function a name of the failing function e.g., $RND
+	Function string
+	//ArgIndex a (zero-based) index of the offending argument,
+	//-1 if the error isn't caused by a particular argument
+	ArgIndex int
+	//Kind a category of the error
+	Kind ErrorKind
+	//Message a description of the error
+	Message string
+	//Line a line (starting from 1) of the script where the function was called,
+	//0 if unknown
+	Line int
+	//Column a column (starting from 1) of the script where the function was called,
+	//0 if unknown
+	Column int
+	//Err an underlying error (if any)
+	Err error
+}
+
+//NewFormulaError creating a FormulaError without script position,
+//which will be filled in by VM when the error reaches the script
+func NewFormulaError(function string, argIndex int, kind ErrorKind, message string) *FormulaError {
+
+	return &FormulaError{
+		Function: function,
+		ArgIndex: argIndex,
+		Kind:     kind,
+		Message:  message,
+	}
+}
+
+//Error returning the error message
+func (e *FormulaError) Error() string {
+
+	var b strings.Builder
+
+	b.WriteString(e.Function)
+	b.WriteString(" - ")
+
+	if e.ArgIndex >= 0 {
+		fmt.Fprintf(&b, "argument #%d: ", e.ArgIndex+1)
+	}
+
+	b.WriteString(e.Message)
+
+	if e.Line > 0 {
+		fmt.Fprintf(&b, " (line %d, column %d)", e.Line, e.Column)
+	}
+
+	return b.String()
+}
+
+//Unwrap returning the underlying error
+func (e *FormulaError) Unwrap() error {
+	return e.Err
+}
+
+//ErrUnknownFunction is matched (by errors.Is) by any UnknownFunctionError
+var ErrUnknownFunction = errors.New("unknown function")
+
+//UnknownFunctionError is returned by FormulaContext.Prepare (and
+//Formula.NewContext) when a formula refers to $FUNCTION(s) which are
+//neither built-in nor registered in any CustomFunctionRepository
+type UnknownFunctionError struct {
+	//Names every unresolved function name (sorted)
+	Names []string
+}
+
+//Error returning the error message
+func (e *UnknownFunctionError) Error() string {
+	return ErrUnknownFunction.Error() + " - " + strings.Join(e.Names, ", ")
+}
+
+//Is telling if the target is ErrUnknownFunction
+func (e *UnknownFunctionError) Is(target error) bool {
+	return target == ErrUnknownFunction
+}
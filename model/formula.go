@@ -22,4 +22,34 @@ type Formula interface {
 
 	//NewContext is a method for creating a new FormulaContext
 	NewContext(script string) (c FormulaContext, err error)
+
+	//Compile parsing the given script, and resolving functions referred
+	//by the script once, so it can be run many times by any FormulaContext
+	//(through FormulaContext.RunCompiled) without being re-parsed
+	//
+	//*UnknownFunctionError is returned if any referred function can't be
+	//resolved, unless the formula is lenient
+	Compile(script string) (CompiledFormula, error)
+
+	//Validate checking the given script, and custom functions it calls
+	//(transitively), without running them for syntax errors, unknown
+	//functions, wrong number of arguments of built-in functions, variables
+	//leaked as globals by functions and unreachable code
+	//
+	//Diagnostics found in custom functions have Function set, and
+	//positions relative to the function body, an empty result means
+	//no problem is found
+	Validate(script string) []Diagnostic
+
+	//ListBuiltInFunctions getting signatures of all built-in functions
+	//(of every BuiltInFunctions which is able to describe its functions)
+	ListBuiltInFunctions() []FunctionSignature
+
+	//DescribeBuiltInFunction getting signature of the given built-in
+	//function (or alias)
+	DescribeBuiltInFunction(funcName string) (FunctionSignature, bool)
+
+	//NewContextPool creating a FormulaContextPool handing out FormulaContext(s)
+	//pre-loaded with functions given by the config
+	NewContextPool(config PoolConfig) (FormulaContextPool, error)
 }
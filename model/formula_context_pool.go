@@ -0,0 +1,76 @@
+package model
+
+//FormulaContextPool a pool of pre-warmed FormulaContext(s) which is safe
+//for concurrent use, so a program running many formulas concurrently
+//doesn't have to pay for creating (and loading functions into) a new
+//FormulaContext on every evaluation
+//
+//A FormulaContext obtained from the pool is still not thread-safe, it must
+//be used by one goroutine at a time and given back to the pool once done
+//
+//Ex.
+//
+// 		pool, err := f.NewContextPool(model.PoolConfig{
+// 			InitialSize: 8,
+// 			Functions:   []string{"$LOAN", "$RND"},
+// 		})
+//
+// 		c, err := pool.Get()
+// 		if err != nil {
+// 			panic(err)
+// 		}
+// 		defer pool.Put(c)
+//
+type FormulaContextPool interface {
+
+	//Get obtaining a FormulaContext from the pool, a new one is created
+	//if no idle FormulaContext is available
+	Get() (FormulaContext, error)
+
+	//Put giving a FormulaContext back to the pool, changes made by the user
+	//(or the formulas) e.g., variables, functions and limits, must not be
+	//seen by the next one obtaining it
+	//
+	//A FormulaContext which isn't obtained from the pool, or is already
+	//given back, is ignored
+	Put(c FormulaContext)
+
+	//Stats getting statistics of the pool
+	Stats() PoolStats
+}
+
+//PoolConfig a configuration of FormulaContextPool
+type PoolConfig struct {
+
+	//InitialSize number of FormulaContext(s) created when creating the pool
+	InitialSize int
+
+	//MaxIdle maximum number of idle FormulaContext(s) kept by the pool,
+	//FormulaContext(s) given back to a full pool are discarded,
+	//zero means unlimited
+	MaxIdle int
+
+	//Functions names of functions (both built-in & custom) loaded into
+	//every FormulaContext in advance
+	Functions []string
+}
+
+//PoolStats statistics of FormulaContextPool
+type PoolStats struct {
+	//Gets number of calls to Get
+	Gets uint64
+	//Hits number of Get(s) served by an idle FormulaContext
+	Hits uint64
+	//Misses number of Get(s) which had to create a new FormulaContext
+	Misses uint64
+	//Puts number of calls to Put
+	Puts uint64
+	//Discarded number of FormulaContext(s) given back but not kept
+	Discarded uint64
+	//Created number of FormulaContext(s) created by the pool
+	Created uint64
+	//Idle number of FormulaContext(s) currently idle in the pool
+	Idle int
+	//InUse number of FormulaContext(s) currently obtained but not yet given back
+	InUse int
+}
@@ -1,5 +1,7 @@
 package model
 
+import "context"
+
 //FormulaContext a formula context created by parsing formula string
 //Any formula string have to be parsed into a context before using
 type FormulaContext interface {
@@ -7,6 +9,9 @@ type FormulaContext interface {
 	//LoadContext If context is nil then create a new FormulaContext
 	//Then preparing a newly created context or a given context
 	//By loading referred functions (both built-in & custom) into context
+	//
+	//*UnknownFunctionError (matching ErrUnknownFunction) is returned if
+	//any referred function is neither built-in nor custom function
 	Prepare(formulaString string) error
 
 	//Run to run a formula (commands given in form of string)
@@ -34,6 +39,79 @@ type FormulaContext interface {
 	//
 	Run(formulaString string) (Value, error)
 
+	//RunContext is the same as Run, but the execution will be interrupted
+	//once the given ctx is done (deadline exceeded or cancelled), in which
+	//case an *InterruptedError is returned
+	//
+	//The context is still usable after being interrupted, though variables
+	//assigned before the interruption are kept as they are
+	//
+	// Ex.
+	//
+	// 		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	// 		defer cancel()
+	//
+	// 		_, err := c.RunContext(ctx, "while(true){}")
+	// 		if errors.Is(err, model.ErrTimeout) {
+	// 			t.Log("timed out")
+	// 		}
+	//
+	RunContext(ctx context.Context, formulaString string) (Value, error)
+
+	//RunCompiled running a formula compiled by Formula.Compile, functions
+	//referred by the formula are loaded into the context if needed
+	//
+	// Ex.
+	//
+	// 		cf, err := f.Compile("$SUMI(a, b)")
+	// 		if err != nil {
+	// 			t.Error(err)
+	// 		}
+	//
+	// 		c.Set("a", 1)
+	// 		c.Set("b", 2)
+	//
+	// 		jsI, runtimeError := c.RunCompiled(cf)
+	//
+	RunCompiled(cf CompiledFormula) (Value, error)
+
+	//RunCompiledContext is the same as RunCompiled, but the execution will
+	//be interrupted once the given ctx is done (see RunContext)
+	RunCompiledContext(ctx context.Context, cf CompiledFormula) (Value, error)
+
+	//SetLimits overriding resource budgets (given by FormulaBuilder) of
+	//the current context, a run hitting any of the limits will be aborted
+	//with *LimitError
+	//
+	// Ex.
+	//
+	// 		c.SetLimits(model.Limits{MaxSteps: 1000, MaxCallDepth: 16})
+	//
+	// 		_, err := c.Run("function f(n) { return f(n + 1) }; f(0)")
+	// 		if errors.Is(err, model.ErrLimitExceeded) {
+	// 			t.Log("too deep")
+	// 		}
+	//
+	SetLimits(limits Limits)
+
+	//Limits getting resource budgets of the current context
+	Limits() Limits
+
+	//Seed getting the random seed of the last run of a deterministic Formula
+	//(FormulaBuilder.SetDeterministic), which is recorded together with the
+	//result, so the run can be replayed exactly by passing the seed back
+	//through model.WithSeed, zero if the Formula isn't deterministic
+	//
+	// Ex.
+	//
+	// 		v, err := c.Run(`Math.random()`)
+	// 		record(v, c.Seed())
+	//
+	// 		//Later on
+	// 		replayed, err := c.RunContext(model.WithSeed(context.Background(), seed), `Math.random()`)
+	//
+	Seed() int64
+
 	//Get getting a variable inside FormulaContext
 	//
 	// 		str := `
@@ -0,0 +1,155 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+)
+
+//ValueType a type of function parameters and return values
+type ValueType int
+
+const (
+	//TypeAny any value
+	TypeAny ValueType = iota
+	//TypeNumber a number (float)
+	TypeNumber
+	//TypeInteger a whole number
+	TypeInteger
+	//TypeString a string
+	TypeString
+	//TypeBoolean true or false
+	TypeBoolean
+	//TypeArray an array
+	TypeArray
+	//TypeObject an object
+	TypeObject
+	//TypeDecimal an exact number (a number or a decimal string)
+	TypeDecimal
+	//TypeDate a date or a date-time (a string e.g., 2020-12-31, or a JS Date)
+	TypeDate
+)
+
+func (t ValueType) String() string {
+
+	switch t {
+
+	case TypeAny:
+		return "any"
+	case TypeNumber:
+		return "number"
+	case TypeInteger:
+		return "integer"
+	case TypeString:
+		return "string"
+	case TypeBoolean:
+		return "boolean"
+	case TypeArray:
+		return "array"
+	case TypeObject:
+		return "object"
+	case TypeDecimal:
+		return "decimal"
+	case TypeDate:
+		return "date"
+	default:
+		return fmt.Sprintf("ValueType(%d)", int(t))
+
+	}
+}
+
+//Param a function parameter
+type Param struct {
+	Name string
+	Type ValueType
+	//Optional the argument may be omitted
+	Optional bool
+	//Variadic the parameter accepts any number of arguments
+	//(only the last parameter can be variadic)
+	Variadic bool
+	//Lazy the argument is passed unevaluated (as a thunk), and evaluated
+	//only when (and if) the function gets it (e.g., branches of $IF)
+	Lazy bool
+}
+
+//FunctionSignature describing a function, e.g., for autocomplete and help
+type FunctionSignature struct {
+	Name string
+	//Aliases other names of the same function (e.g., $FLR of $FLOOR)
+	Aliases     []string
+	Params      []Param
+	Returns     ValueType
+	Description string
+	//Examples formulas calling the function
+	Examples []string
+}
+
+//Arity getting min and max number of arguments accepted,
+//max is -1 if the last parameter is variadic
+func (s FunctionSignature) Arity() (min int, max int) {
+
+	for _, param := range s.Params {
+
+		if param.Variadic {
+			if !param.Optional {
+				min++
+			}
+			return min, -1
+		}
+
+		if !param.Optional {
+			min++
+		}
+		max++
+	}
+
+	return min, max
+}
+
+//Param getting the parameter receiving the argument at the given index
+//(0-based), false if there's no such parameter
+func (s FunctionSignature) Param(index int) (Param, bool) {
+
+	if index < 0 || len(s.Params) == 0 {
+		return Param{}, false
+	}
+
+	if index >= len(s.Params) {
+		last := s.Params[len(s.Params)-1]
+		return last, last.Variadic
+	}
+
+	return s.Params[index], true
+}
+
+//Lazy telling if any parameter is lazy
+func (s FunctionSignature) Lazy() bool {
+
+	for _, param := range s.Params {
+		if param.Lazy {
+			return true
+		}
+	}
+
+	return false
+}
+
+//String e.g., $RND(value number, precision integer) number
+func (s FunctionSignature) String() string {
+
+	params := make([]string, len(s.Params))
+
+	for i, param := range s.Params {
+
+		name := param.Name
+		if param.Variadic {
+			name += "..."
+		}
+		if param.Optional {
+			name += "?"
+		}
+
+		params[i] = name + " " + param.Type.String()
+	}
+
+	return fmt.Sprintf("%s(%s) %s", s.Name, strings.Join(params, ", "), s.Returns)
+}
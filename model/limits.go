@@ -0,0 +1,71 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+)
+
+//Limits resource budgets applied to every run of a FormulaContext,
+//a zero value of each field means unlimited
+//
+//Ex.
+//
+// 		f := goforit.NewFormulaBuilder().
+// 			SetLimits(model.Limits{MaxSteps: 100000, MaxCallDepth: 64}).
+// 			Get()
+//
+type Limits struct {
+
+	//MaxSteps maximum number of statements and expressions
+	//evaluated by a single run
+	MaxSteps int64
+
+	//MaxCallDepth maximum depth of nested function calls
+	MaxCallDepth int
+}
+
+//Limit identifying a kind of budget in Limits
+type Limit int
+
+const (
+	//LimitSteps identifying Limits.MaxSteps
+	LimitSteps Limit = iota
+	//LimitCallDepth identifying Limits.MaxCallDepth
+	LimitCallDepth
+)
+
+func (l Limit) String() string {
+
+	switch l {
+
+	case LimitSteps:
+		return "steps"
+	case LimitCallDepth:
+		return "call depth"
+	default:
+		return fmt.Sprintf("Limit(%d)", int(l))
+
+	}
+}
+
+//ErrLimitExceeded is matched (by errors.Is) by any LimitError
+var ErrLimitExceeded = errors.New("formula execution limit exceeded")
+
+//LimitError is returned by FormulaContext.Run when a run is aborted
+//because one of its Limits was hit
+type LimitError struct {
+	//Limit a budget being exceeded
+	Limit Limit
+	//Max a configured value of the budget
+	Max uint64
+}
+
+//Error returning the error message
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s - %s (max %d)", ErrLimitExceeded.Error(), e.Limit, e.Max)
+}
+
+//Is telling if the target is ErrLimitExceeded
+func (e *LimitError) Is(target error) bool {
+	return target == ErrLimitExceeded
+}
@@ -0,0 +1,147 @@
+package model
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+//RoundingMode a way of discarding digits beyond a given scale
+type RoundingMode int
+
+const (
+	//RoundHalfUp rounding to the nearest, ties away from zero
+	//e.g., 2.5 -> 3, -2.5 -> -3
+	RoundHalfUp RoundingMode = iota
+	//RoundHalfEven rounding to the nearest, ties to the even neighbour
+	//(banker's rounding) e.g., 2.5 -> 2, 3.5 -> 4
+	RoundHalfEven
+	//RoundHalfDown rounding to the nearest, ties toward zero
+	//e.g., 2.5 -> 2, -2.5 -> -2
+	RoundHalfDown
+	//RoundUp rounding away from zero e.g., 2.1 -> 3, -2.1 -> -3
+	RoundUp
+	//RoundDown rounding toward zero (truncating) e.g., 2.9 -> 2, -2.9 -> -2
+	RoundDown
+	//RoundCeiling rounding toward positive infinity e.g., 2.1 -> 3, -2.9 -> -2
+	RoundCeiling
+	//RoundFloor rounding toward negative infinity e.g., 2.9 -> 2, -2.1 -> -3
+	RoundFloor
+)
+
+var roundingModeNames = []string{
+	RoundHalfUp:   "half-up",
+	RoundHalfEven: "half-even",
+	RoundHalfDown: "half-down",
+	RoundUp:       "up",
+	RoundDown:     "down",
+	RoundCeiling:  "ceiling",
+	RoundFloor:    "floor",
+}
+
+func (m RoundingMode) String() string {
+
+	if m < 0 || int(m) >= len(roundingModeNames) {
+		return fmt.Sprintf("RoundingMode(%d)", int(m))
+	}
+
+	return roundingModeNames[m]
+}
+
+//ParseRoundingMode getting RoundingMode by its name (case-insensitive,
+//- or _ as a separator) e.g., "half-even", "HALF_EVEN"
+func ParseRoundingMode(name string) (RoundingMode, error) {
+
+	normalized := strings.ReplaceAll(strings.ToLower(strings.TrimSpace(name)), "_", "-")
+
+	for mode, modeName := range roundingModeNames {
+		if modeName == normalized {
+			return RoundingMode(mode), nil
+		}
+	}
+
+	return RoundHalfUp, fmt.Errorf("unknown rounding mode %q (expecting one of %s)", name, strings.Join(roundingModeNames, ", "))
+}
+
+//RoundFloat rounding the given number to the given number of decimal
+//places by the given mode, a negative precision rounds to tens,
+//hundreds, ...
+//
+//The number is rounded as its shortest decimal representation
+//(e.g., 1.005 rather than 1.00499999999999989...), so
+//RoundFloat(1.005, 2, RoundHalfUp) is 1.01
+func RoundFloat(v float64, precision int, mode RoundingMode) float64 {
+
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return v
+	}
+
+	d, _ := new(big.Rat).SetString(strconv.FormatFloat(v, 'g', -1, 64))
+	result, _ := RoundDecimal(d, precision, mode).Float64()
+
+	return result
+}
+
+//RoundDecimal rounding the given number to the given number of
+//decimal places by the given mode, a negative scale rounds to tens,
+//hundreds, ...
+func RoundDecimal(d *big.Rat, scale int, mode RoundingMode) *big.Rat {
+
+	factor := new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(abs(scale))), nil))
+
+	scaled := new(big.Rat)
+	if scale >= 0 {
+		scaled.Mul(d, factor)
+	} else {
+		scaled.Quo(d, factor)
+	}
+
+	q, r := new(big.Int).QuoRem(scaled.Num(), scaled.Denom(), new(big.Int))
+
+	if r.Sign() != 0 && roundsAway(mode, scaled.Sign(), q, r, scaled.Denom()) {
+		q.Add(q, big.NewInt(int64(scaled.Sign())))
+	}
+
+	result := new(big.Rat).SetInt(q)
+	if scale >= 0 {
+		return result.Quo(result, factor)
+	}
+
+	return result.Mul(result, factor)
+}
+
+//roundsAway telling if the truncated quotient q (with the non-zero
+//remainder r of the given divisor) has to be moved away from zero
+func roundsAway(mode RoundingMode, sign int, q *big.Int, r *big.Int, divisor *big.Int) bool {
+
+	//Comparing the discarded fraction with a half
+	half := new(big.Int).Mul(new(big.Int).Abs(r), big.NewInt(2)).Cmp(divisor)
+
+	switch mode {
+	case RoundHalfEven:
+		return half > 0 || (half == 0 && q.Bit(0) == 1)
+	case RoundHalfDown:
+		return half > 0
+	case RoundUp:
+		return true
+	case RoundDown:
+		return false
+	case RoundCeiling:
+		return sign > 0
+	case RoundFloor:
+		return sign < 0
+	default:
+		return half >= 0
+	}
+}
+
+func abs(i int) int {
+
+	if i < 0 {
+		return -i
+	}
+
+	return i
+}
@@ -0,0 +1,52 @@
+package model
+
+import (
+	"context"
+	crand "crypto/rand"
+	"encoding/binary"
+	"time"
+)
+
+//seedKey the key of the random seed carried by context.Context
+type seedKey struct{}
+
+//WithSeed getting a copy of the given ctx carrying the given random seed,
+//which a run (FormulaContext.RunContext) of a deterministic Formula
+//(FormulaBuilder.SetDeterministic) draws its random numbers from, instead
+//of a newly generated seed, so a recorded run can be replayed exactly
+//
+//Ex.
+//
+// 		v, err := c.Run(`$RANDBETWEEN(1, 6)`)
+// 		seed := c.Seed()
+//
+// 		//Rolling the same number again
+// 		replayed, err := c.RunContext(model.WithSeed(context.Background(), seed), `$RANDBETWEEN(1, 6)`)
+//
+func WithSeed(ctx context.Context, seed int64) context.Context {
+
+	return context.WithValue(ctx, seedKey{}, seed)
+}
+
+//Seed getting the random seed carried by the given ctx, false if none
+func Seed(ctx context.Context) (int64, bool) {
+
+	if ctx == nil {
+		return 0, false
+	}
+
+	seed, found := ctx.Value(seedKey{}).(int64)
+
+	return seed, found
+}
+
+//NewSeed generating a random seed which is unlikely to repeat
+func NewSeed() int64 {
+
+	var b [8]byte
+	if _, err := crand.Read(b[:]); err != nil {
+		return time.Now().UnixNano()
+	}
+
+	return int64(binary.LittleEndian.Uint64(b[:]))
+}
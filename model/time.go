@@ -0,0 +1,55 @@
+package model
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+//DateLayout a layout of dates returned by date functions e.g., 2020-12-31
+const DateLayout = "2006-01-02"
+
+//DateTimeLayout a layout of date-times returned by date functions
+//e.g., 2020-12-31T23:59:59+07:00
+const DateTimeLayout = time.RFC3339
+
+//timeLayouts layouts accepted by ParseTime (in order)
+var timeLayouts = []string{
+	DateLayout,
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04",
+}
+
+//ParseTime parsing a date (e.g., 2020-12-31) or a date-time (e.g.,
+//2020-12-31T23:59:59+07:00, 2020-12-31 23:59:59), a date or a date-time
+//without time zone offset is in the given location (UTC if nil)
+func ParseTime(s string, loc *time.Location) (time.Time, error) {
+
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	s = strings.TrimSpace(s)
+
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, errors.New("invalid date " + s + " (expecting e.g., 2020-12-31 or 2020-12-31T23:59:59+07:00)")
+}
+
+//FormatDate formatting the given time as a date string e.g., 2020-12-31
+func FormatDate(t time.Time) string {
+	return t.Format(DateLayout)
+}
+
+//FormatDateTime formatting the given time as a date-time string
+//(RFC 3339) e.g., 2020-12-31T23:59:59+07:00
+func FormatDateTime(t time.Time) string {
+	return t.Format(DateTimeLayout)
+}
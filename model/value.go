@@ -1,5 +1,10 @@
 package model
 
+import (
+	"math/big"
+	"time"
+)
+
 //Value is a placeholder for a VM/script value
 type Value interface {
 	//IsDefined check if the current JS value is defined
@@ -30,6 +35,11 @@ type Value interface {
 	ToInteger() (int64, error)
 	//ToString get value as string
 	ToString() (string, error)
+	//ToDecimal get value (a number or a decimal string) as an exact number
+	ToDecimal() (*big.Rat, error)
+	//ToTime get value (a date string, a date-time string or a JS Date) as
+	//time, a date string without time zone offset (e.g., 2020-12-31) is in UTC
+	ToTime() (time.Time, error)
 	//Export js value to Go value type
 	Export() (interface{}, error)
 }
@@ -0,0 +1,341 @@
+package parse
+
+import (
+	"fmt"
+
+	"github.com/robertkrimen/otto/ast"
+	"github.com/robertkrimen/otto/parser"
+	"github.com/robertkrimen/otto/token"
+)
+
+//Analysis variables and functions a script depends on
+type Analysis struct {
+	//Reads global variables read by the script (in the order they appear)
+	Reads []string
+	//Writes global variables assigned (or declared) by the script
+	Writes []string
+	//Functions $ functions called or referred to by the script
+	Functions []string
+}
+
+//Inputs global variables read but never assigned by the script,
+//which have to be provided before running it
+//
+//*NOTE* the analysis doesn't follow the flow of the script, so a variable
+//read before being assigned (e.g., x = x + 1) is not reported
+func (a Analysis) Inputs() []string {
+
+	written := make(map[string]bool, len(a.Writes))
+	for _, name := range a.Writes {
+		written[name] = true
+	}
+
+	inputs := make([]string, 0, len(a.Reads))
+	for _, name := range a.Reads {
+		if !written[name] {
+			inputs = append(inputs, name)
+		}
+	}
+
+	return inputs
+}
+
+//FunctionBodyLookup getting source code of a custom function,
+//empty string if the function is not a custom function (e.g., built-in)
+//
+//Ex.
+//
+//		analysis, err := parse.NewAnalyzer().Analyze(script, formula.GetCustomFunctionBody)
+//
+type FunctionBodyLookup func(funcName string) string
+
+//Analyzer a script analyzer
+type Analyzer interface {
+
+	//Analyze finding global variables read and written, and functions
+	//called by the given script, following transitively into bodies
+	//of custom functions given by lookup (nil for not following)
+	Analyze(formulaStr string, lookup FunctionBodyLookup) (Analysis, error)
+}
+
+//NewAnalyzer will return an Analyzer walking through JavaScript syntax tree
+func NewAnalyzer() Analyzer {
+
+	return ASTAnalyzer{}
+}
+
+//ASTAnalyzer is an Analyzer implementation based on otto syntax tree
+type ASTAnalyzer struct{}
+
+//Analyze finding global variables read and written, and functions
+//called by the given script, following transitively into bodies
+//of custom functions given by lookup (nil for not following)
+func (a ASTAnalyzer) Analyze(formulaStr string, lookup FunctionBodyLookup) (Analysis, error) {
+
+	result := newAnalysisBuilder()
+
+	if err := result.analyze(formulaStr); err != nil {
+		return Analysis{}, err
+	}
+
+	if lookup == nil {
+		return result.Analysis, nil
+	}
+
+	visited := make(map[string]bool)
+
+	//Functions grows while following into custom function bodies
+	for i := 0; i < len(result.Functions); i++ {
+
+		funcName := result.Functions[i]
+		if visited[funcName] {
+			continue
+		}
+		visited[funcName] = true
+
+		body := lookup(funcName)
+		if body == "" {
+			continue
+		}
+
+		if err := result.analyze(body); err != nil {
+			return Analysis{}, fmt.Errorf("%s: %w", funcName, err)
+		}
+	}
+
+	return result.Analysis, nil
+}
+
+//standardGlobals globals provided by JavaScript itself (or the VM)
+var standardGlobals = map[string]bool{
+	"arguments": true, "Array": true, "Boolean": true, "console": true,
+	"Date": true, "decodeURI": true, "decodeURIComponent": true,
+	"encodeURI": true, "encodeURIComponent": true, "Error": true,
+	"escape": true, "eval": true, "EvalError": true, "Function": true,
+	"Infinity": true, "isFinite": true, "isNaN": true, "JSON": true,
+	"Math": true, "NaN": true, "Number": true, "Object": true,
+	"parseFloat": true, "parseInt": true, "RangeError": true,
+	"ReferenceError": true, "RegExp": true, "String": true,
+	"SyntaxError": true, "TypeError": true, "undefined": true,
+	"unescape": true, "URIError": true,
+}
+
+//analysisBuilder accumulating Analysis of many scripts without duplicates
+type analysisBuilder struct {
+	Analysis
+	seen map[string]bool
+}
+
+func newAnalysisBuilder() *analysisBuilder {
+
+	return &analysisBuilder{seen: make(map[string]bool)}
+}
+
+func (b *analysisBuilder) analyze(formulaStr string) error {
+
+	program, err := parser.ParseFile(nil, "", formulaStr, 0)
+	if err != nil {
+		return err
+	}
+
+	b.walk(program)
+
+	return nil
+}
+
+//walk walking through the given program, returning the visitor
+func (b *analysisBuilder) walk(program *ast.Program) *analysisVisitor {
+
+	v := &analysisVisitor{
+		calls: &callSiteVisitor{
+			program: program,
+			handled: make(map[*ast.Identifier]bool),
+		},
+		access:  make(map[*ast.Identifier]identifierAccess),
+		builder: b,
+	}
+
+	//Top level declarations are globals assigned by the script
+	for _, declaration := range program.DeclarationList {
+		switch declaration := declaration.(type) {
+		case *ast.FunctionDeclaration:
+			if name := declaration.Function.Name; name != nil && !isFunctionName(name.Name) {
+				b.add(&b.Writes, "write:", name.Name)
+			}
+		case *ast.VariableDeclaration:
+			for _, variable := range declaration.List {
+				b.add(&b.Writes, "write:", variable.Name)
+			}
+		}
+	}
+
+	ast.Walk(v, program)
+
+	for _, site := range v.calls.sites {
+		if site.Global() {
+			b.add(&b.Functions, "func:", site.Name)
+		}
+	}
+
+	return v
+}
+
+func (b *analysisBuilder) add(list *[]string, kind string, name string) {
+
+	if b.seen[kind+name] {
+		return
+	}
+
+	b.seen[kind+name] = true
+	*list = append(*list, name)
+}
+
+//identifierAccess how an identifier is used
+type identifierAccess int
+
+const (
+	accessRead identifierAccess = iota
+	accessWrite
+	accessReadWrite
+	accessDeclare
+)
+
+//analysisVisitor walking through a script for variables, while letting
+//callSiteVisitor collect functions, local scopes (functions and catch
+//blocks) are stacked so local variables are not reported
+type analysisVisitor struct {
+	calls   *callSiteVisitor
+	access  map[*ast.Identifier]identifierAccess
+	scopes  []map[string]bool
+	builder *analysisBuilder
+	//functions depth of function literals being walked through
+	functions int
+	//leaks globals assigned within functions
+	leaks []*ast.Identifier
+}
+
+func (v *analysisVisitor) Enter(n ast.Node) ast.Visitor {
+
+	v.calls.Enter(n)
+
+	switch n := n.(type) {
+	case *ast.FunctionLiteral:
+		v.access[n.Name] = accessDeclare
+		v.functions++
+		v.scopes = append(v.scopes, functionScope(n))
+		if n.ParameterList != nil {
+			for _, param := range n.ParameterList.List {
+				v.access[param] = accessDeclare
+			}
+		}
+	case *ast.CatchStatement:
+		//Exit pops the scope even if there's no catch block (nil)
+		scope := make(map[string]bool)
+		if n != nil && n.Parameter != nil {
+			scope[n.Parameter.Name] = true
+			v.access[n.Parameter] = accessDeclare
+		}
+		v.scopes = append(v.scopes, scope)
+	case *ast.BranchStatement:
+		v.access[n.Label] = accessDeclare
+	case *ast.AssignExpression:
+		if left, ok := n.Left.(*ast.Identifier); ok {
+			if n.Operator == token.ASSIGN {
+				v.access[left] = accessWrite
+			} else {
+				v.access[left] = accessReadWrite
+			}
+		}
+	case *ast.UnaryExpression:
+		if n.Operator == token.INCREMENT || n.Operator == token.DECREMENT {
+			if operand, ok := n.Operand.(*ast.Identifier); ok {
+				v.access[operand] = accessReadWrite
+			}
+		}
+	case *ast.ForInStatement:
+		if into, ok := n.Into.(*ast.Identifier); ok {
+			v.access[into] = accessWrite
+		}
+	case *ast.Identifier:
+		if n != nil {
+			v.identifier(n)
+		}
+	}
+
+	return v
+}
+
+func (v *analysisVisitor) Exit(n ast.Node) {
+
+	switch n.(type) {
+	case *ast.FunctionLiteral:
+		v.functions--
+		v.scopes = v.scopes[:len(v.scopes)-1]
+	case *ast.CatchStatement:
+		v.scopes = v.scopes[:len(v.scopes)-1]
+	}
+}
+
+func (v *analysisVisitor) identifier(id *ast.Identifier) {
+
+	access := v.access[id]
+	if access == accessDeclare || isFunctionName(id.Name) || v.isLocal(id.Name) {
+		return
+	}
+
+	if access == accessRead || access == accessReadWrite {
+		if !standardGlobals[id.Name] {
+			v.builder.add(&v.builder.Reads, "read:", id.Name)
+		}
+	}
+
+	if access == accessWrite || access == accessReadWrite {
+		v.builder.add(&v.builder.Writes, "write:", id.Name)
+		if v.functions > 0 {
+			v.leaks = append(v.leaks, id)
+		}
+	}
+}
+
+func (v *analysisVisitor) isLocal(name string) bool {
+
+	for i := len(v.scopes) - 1; i >= 0; i-- {
+		if v.scopes[i][name] {
+			return true
+		}
+	}
+
+	return false
+}
+
+//functionScope variables local to the given function,
+//including its name, parameters and (hoisted) declarations
+func functionScope(function *ast.FunctionLiteral) map[string]bool {
+
+	scope := make(map[string]bool)
+
+	if function.Name != nil {
+		scope[function.Name.Name] = true
+	}
+
+	if function.ParameterList != nil {
+		for _, param := range function.ParameterList.List {
+			scope[param.Name] = true
+		}
+	}
+
+	for _, declaration := range function.DeclarationList {
+		switch declaration := declaration.(type) {
+		case *ast.FunctionDeclaration:
+			if name := declaration.Function.Name; name != nil {
+				scope[name.Name] = true
+			}
+		case *ast.VariableDeclaration:
+			for _, variable := range declaration.List {
+				scope[variable.Name] = true
+			}
+		}
+	}
+
+	return scope
+}
@@ -0,0 +1,232 @@
+package parse
+
+import (
+	"strings"
+
+	"github.com/robertkrimen/otto/ast"
+	"github.com/robertkrimen/otto/parser"
+)
+
+//NewASTParser will return a Parser walking through JavaScript syntax tree
+//instead of matching a regular expression, so function names within
+//string literals and comments are ignored, and calls like $FOO (1),
+//$FOO.call(null, 1) or var f = $FOO are found
+//
+//A script which cannot be parsed falls back to the default Parser,
+//leaving the syntax error to be reported when the script is run
+//
+//Ex.
+//
+//		formula := builder.NewFormulaBuilder().
+//			SetParser(parse.NewASTParser()).
+//			Get()
+//
+func NewASTParser() CallSiteParser {
+
+	return ASTParser{New()}
+}
+
+//ASTParser is a Parser implementation based on otto syntax tree
+type ASTParser struct {
+	fallback Parser
+}
+
+//ExtractFunctionNames extracting functions names
+//from the given script/formular so that the function can be loaded
+//by Formula.LoadContext() before being executed, otherwise the
+//unloaded functions will not be known to the scripting/VM engine
+func (p ASTParser) ExtractFunctionNames(formulaStr string) []string {
+
+	sites, err := p.CallSites(formulaStr)
+	if err != nil {
+		return p.fallback.ExtractFunctionNames(formulaStr)
+	}
+
+	dedupNames := make(map[string]bool)
+	funArr := make([]string, 0, len(sites))
+
+	for _, site := range sites {
+
+		if !site.Global() || dedupNames[site.Name] {
+			continue
+		}
+
+		dedupNames[site.Name] = true
+		funArr = append(funArr, site.Name)
+	}
+
+	return funArr
+}
+
+//CallSites listing functions (having names start with $) called
+//or referred to by the given script, in the order they appear
+func (p ASTParser) CallSites(formulaStr string) ([]CallSite, error) {
+
+	program, err := parser.ParseFile(nil, "", formulaStr, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	v := &callSiteVisitor{
+		program: program,
+		handled: make(map[*ast.Identifier]bool),
+	}
+
+	ast.Walk(v, program)
+
+	return v.sites, nil
+}
+
+//callSiteVisitor collecting call sites while walking through the tree,
+//identifiers already reported (e.g., callee) or not referring to
+//a function (e.g., parameters, labels) are marked as handled
+//
+//Names declared by the script (variables, functions, parameters)
+//are kept per scope, so that var $total = 1; $total + 1
+//does not refer to a function called $total
+type callSiteVisitor struct {
+	program *ast.Program
+	handled map[*ast.Identifier]bool
+	scopes  []map[string]bool
+	sites   []CallSite
+}
+
+func (v *callSiteVisitor) Enter(n ast.Node) ast.Visitor {
+
+	switch n := n.(type) {
+	case *ast.Program:
+		v.push(n.DeclarationList)
+	case *ast.CallExpression:
+		v.callee(n.Callee, len(n.ArgumentList))
+	case *ast.NewExpression:
+		v.callee(n.Callee, len(n.ArgumentList))
+	case *ast.FunctionLiteral:
+		scope := v.push(n.DeclarationList)
+		if n.Name != nil {
+			scope[n.Name.Name] = true
+		}
+		v.handled[n.Name] = true
+		if n.ParameterList != nil {
+			for _, param := range n.ParameterList.List {
+				scope[param.Name] = true
+				v.handled[param] = true
+			}
+		}
+	case *ast.CatchStatement:
+		if n != nil {
+			scope := v.push(nil)
+			if n.Parameter != nil {
+				scope[n.Parameter.Name] = true
+			}
+			v.handled[n.Parameter] = true
+		}
+	case *ast.BranchStatement:
+		v.handled[n.Label] = true
+	case *ast.Identifier:
+		if n != nil && !v.handled[n] && isFunctionName(n.Name) && !v.declared(n.Name) {
+			v.add(n, CallReference, -1)
+		}
+	}
+
+	return v
+}
+
+func (v *callSiteVisitor) Exit(n ast.Node) {
+
+	switch n := n.(type) {
+	case *ast.Program, *ast.FunctionLiteral:
+		v.scopes = v.scopes[:len(v.scopes)-1]
+	case *ast.CatchStatement:
+		if n != nil {
+			v.scopes = v.scopes[:len(v.scopes)-1]
+		}
+	}
+}
+
+//push entering a new scope having the given declarations
+func (v *callSiteVisitor) push(declarations []ast.Declaration) map[string]bool {
+
+	scope := make(map[string]bool)
+
+	for _, declaration := range declarations {
+		switch declaration := declaration.(type) {
+		case *ast.VariableDeclaration:
+			for _, variable := range declaration.List {
+				scope[variable.Name] = true
+			}
+		case *ast.FunctionDeclaration:
+			if declaration.Function.Name != nil {
+				scope[declaration.Function.Name.Name] = true
+			}
+		}
+	}
+
+	v.scopes = append(v.scopes, scope)
+
+	return scope
+}
+
+//declared checking whether the given name is declared
+//by the current scope or any of the enclosing ones
+func (v *callSiteVisitor) declared(name string) bool {
+
+	for i := len(v.scopes) - 1; i >= 0; i-- {
+		if v.scopes[i][name] {
+			return true
+		}
+	}
+
+	return false
+}
+
+//callee reporting the function being called (if any)
+func (v *callSiteVisitor) callee(callee ast.Expression, args int) {
+
+	switch callee := callee.(type) {
+	case *ast.Identifier:
+		if isFunctionName(callee.Name) && !v.declared(callee.Name) {
+			v.handled[callee] = true
+			v.add(callee, CallDirect, args)
+		}
+	case *ast.DotExpression:
+		if isFunctionName(callee.Identifier.Name) {
+			//obj.$FOO(...)
+			v.add(callee.Identifier, CallMember, args)
+			return
+		}
+
+		left, ok := callee.Left.(*ast.Identifier)
+		if !ok || !isFunctionName(left.Name) || v.declared(left.Name) {
+			return
+		}
+
+		switch callee.Identifier.Name {
+		case "call":
+			//$FOO.call(thisArg, ...)
+			v.handled[left] = true
+			v.add(left, CallIndirect, args-1)
+		case "apply":
+			//$FOO.apply(thisArg, [...])
+			v.handled[left] = true
+			v.add(left, CallIndirect, -1)
+		}
+	}
+}
+
+func (v *callSiteVisitor) add(id *ast.Identifier, kind CallKind, args int) {
+
+	site := CallSite{Name: id.Name, Kind: kind, Args: args}
+
+	if position := v.program.File.Position(id.Idx0()); position != nil {
+		site.Line = position.Line
+		site.Column = position.Column
+		site.Offset = position.Offset
+	}
+
+	v.sites = append(v.sites, site)
+}
+
+func isFunctionName(name string) bool {
+
+	return strings.HasPrefix(name, "$") && len(name) > 1
+}
@@ -0,0 +1,69 @@
+package parse
+
+//CallKind how a function is referred to at a call site
+type CallKind int
+
+const (
+	//CallDirect a function called directly (e.g., $FOO(1) or new $FOO(1))
+	CallDirect CallKind = iota
+	//CallIndirect a function called through Function.prototype
+	//(e.g., $FOO.call(null, 1) or $FOO.apply(null, [1]))
+	CallIndirect
+	//CallReference a function referred to as a value
+	//(e.g., var f = $FOO), it may be called later through the variable
+	CallReference
+	//CallMember a method of an object (e.g., obj.$FOO(1)),
+	//which is not a global function
+	CallMember
+)
+
+func (k CallKind) String() string {
+
+	switch k {
+	case CallDirect:
+		return "direct"
+	case CallIndirect:
+		return "indirect"
+	case CallReference:
+		return "reference"
+	case CallMember:
+		return "member"
+	}
+
+	return "unknown"
+}
+
+//CallSite a function call (or reference) found in a script
+type CallSite struct {
+	//Name function name (e.g., $FOO)
+	Name string
+	//Kind how the function is referred to
+	Kind CallKind
+	//Line 1-based line number of the function name
+	Line int
+	//Column 1-based column number of the function name
+	Column int
+	//Offset 0-based byte offset of the function name
+	Offset int
+	//Args number of arguments passed, -1 if unknown
+	//(e.g., CallReference or $FOO.apply(null, args))
+	Args int
+}
+
+//Global whether the call site refers to a global function,
+//which has to be loaded before running the script
+func (c CallSite) Global() bool {
+
+	return c.Kind != CallMember
+}
+
+//CallSiteParser a Parser which is also able to report
+//where functions are called in a script
+type CallSiteParser interface {
+	Parser
+
+	//CallSites listing functions (having names start with $) called
+	//or referred to by the given script, in the order they appear,
+	//an error is returned if the script is not syntactically valid
+	CallSites(formulaStr string) ([]CallSite, error)
+}
@@ -0,0 +1,154 @@
+package parse
+
+import (
+	"github.com/robertkrimen/otto/ast"
+	"github.com/robertkrimen/otto/file"
+	"github.com/robertkrimen/otto/parser"
+)
+
+//ThunkName name of functions wrapping lazy arguments by ThunkLazyArguments,
+//which a VM recognizes as thunks to be evaluated on demand
+const ThunkName = "__goforit_thunk"
+
+//LazyArgument telling if the argument at the given index (0-based)
+//of the given function is lazy
+type LazyArgument func(funcName string, index int) bool
+
+//ThunkLazyArguments parsing the given script into a syntax tree where every
+//lazy argument of a direct call (e.g., $IF(c, a, b)) is wrapped into a
+//thunk function, as if the script was written
+//
+//		$IF(x != 0, function __goforit_thunk(){return 100 / x}, 0)
+//
+//A thunk referring to this (or arguments) of the enclosing function is
+//bound to them, so the argument is evaluated as if it was not wrapped
+//
+//		$IF(true, (function __goforit_thunk(arguments){return arguments[0]}).bind(this, arguments), 0)
+//
+//Literals are left as is. The source isn't rewritten, so positions of the
+//tree (and of errors raised while running it) are of the given script
+//
+//nil is returned if the script has no lazy argument or can't be parsed
+//(leaving the syntax error to be reported when the script is run)
+func ThunkLazyArguments(formulaStr string, lazy LazyArgument) *ast.Program {
+
+	program, err := parser.ParseFile(nil, "", formulaStr, 0)
+	if err != nil {
+		return nil
+	}
+
+	v := &lazyVisitor{lazy: lazy}
+
+	ast.Walk(v, program)
+
+	if !v.wrapped {
+		return nil
+	}
+
+	return program
+}
+
+//lazyVisitor wrapping lazy arguments into thunks, calls are rewritten
+//on exit, so thunks of nested calls are wrapped by thunks of outer calls
+type lazyVisitor struct {
+	lazy    LazyArgument
+	wrapped bool
+}
+
+func (v *lazyVisitor) Enter(n ast.Node) ast.Visitor {
+
+	return v
+}
+
+func (v *lazyVisitor) Exit(n ast.Node) {
+
+	call, ok := n.(*ast.CallExpression)
+	if !ok {
+		return
+	}
+
+	callee, ok := call.Callee.(*ast.Identifier)
+	if !ok || !isFunctionName(callee.Name) {
+		return
+	}
+
+	for i, arg := range call.ArgumentList {
+
+		if v.lazy(callee.Name, i) && !isLiteral(arg) {
+			call.ArgumentList[i] = newThunk(arg)
+			v.wrapped = true
+		}
+	}
+}
+
+//newThunk wrapping the given expression into a thunk function
+func newThunk(expr ast.Expression) ast.Expression {
+
+	idx := expr.Idx0()
+	scope := &scopeVisitor{}
+
+	ast.Walk(scope, expr)
+
+	thunk := &ast.FunctionLiteral{
+		Function:      idx,
+		Name:          &ast.Identifier{Name: ThunkName, Idx: idx},
+		ParameterList: &ast.ParameterList{Opening: idx, Closing: idx},
+		Body:          &ast.ReturnStatement{Return: idx, Argument: expr},
+	}
+
+	if !scope.this && !scope.arguments {
+		return thunk
+	}
+
+	//(thunk).bind(this[, arguments])
+	bindArgs := []ast.Expression{&ast.ThisExpression{Idx: idx}}
+
+	if scope.arguments {
+		//The parameter named arguments shadows arguments of the thunk itself
+		thunk.ParameterList.List = []*ast.Identifier{{Name: "arguments", Idx: idx}}
+		bindArgs = append(bindArgs, &ast.Identifier{Name: "arguments", Idx: idx})
+	}
+
+	return &ast.CallExpression{
+		Callee: &ast.DotExpression{
+			Left:       thunk,
+			Identifier: &ast.Identifier{Name: "bind", Idx: idx},
+		},
+		LeftParenthesis:  idx,
+		ArgumentList:     bindArgs,
+		RightParenthesis: file.Idx(int(expr.Idx1()) - 1),
+	}
+}
+
+//scopeVisitor finding if an expression refers to this or arguments of
+//the enclosing function (not of functions declared within the expression)
+type scopeVisitor struct {
+	this      bool
+	arguments bool
+}
+
+func (v *scopeVisitor) Enter(n ast.Node) ast.Visitor {
+
+	switch n := n.(type) {
+	case *ast.FunctionLiteral:
+		return nil
+	case *ast.ThisExpression:
+		v.this = true
+	case *ast.Identifier:
+		v.arguments = v.arguments || n.Name == "arguments"
+	}
+
+	return v
+}
+
+func (v *scopeVisitor) Exit(n ast.Node) {}
+
+func isLiteral(expr ast.Expression) bool {
+
+	switch expr.(type) {
+	case *ast.NumberLiteral, *ast.StringLiteral, *ast.BooleanLiteral, *ast.NullLiteral:
+		return true
+	}
+
+	return false
+}
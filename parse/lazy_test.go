@@ -0,0 +1,113 @@
+package parse
+
+import (
+	"testing"
+
+	"github.com/robertkrimen/otto/ast"
+)
+
+//lazyIF the 2nd and the 3rd arguments of $IF are lazy
+func lazyIF(funcName string, index int) bool {
+
+	return funcName == "$IF" && index > 0
+}
+
+//thunkOf getting the thunk function (and if it's bound) of the given argument
+func thunkOf(arg ast.Expression) (*ast.FunctionLiteral, bool) {
+
+	if call, ok := arg.(*ast.CallExpression); ok {
+		if dot, ok := call.Callee.(*ast.DotExpression); ok && dot.Identifier.Name == "bind" {
+			fn, _ := dot.Left.(*ast.FunctionLiteral)
+			return fn, true
+		}
+	}
+
+	fn, _ := arg.(*ast.FunctionLiteral)
+
+	return fn, false
+}
+
+func firstCall(t *testing.T, program *ast.Program) *ast.CallExpression {
+
+	if program == nil {
+		t.Fatal("Expect lazy arguments to be wrapped")
+	}
+
+	stmt, ok := program.Body[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("Unexpected %T\n", program.Body[0])
+	}
+
+	return stmt.Expression.(*ast.CallExpression)
+}
+
+func TestThunkLazyArguments(t *testing.T) {
+
+	//Comments between arguments
+	call := firstCall(t, ThunkLazyArguments("$IF(/* c */ x, /* a */ a + 1, /* b */ f())", lazyIF))
+
+	if _, ok := call.ArgumentList[0].(*ast.Identifier); !ok {
+		t.Errorf("Expect the condition not to be wrapped but got %T\n", call.ArgumentList[0])
+	}
+
+	for _, arg := range call.ArgumentList[1:] {
+		if fn, bound := thunkOf(arg); fn == nil || fn.Name.Name != ThunkName || bound {
+			t.Errorf("Expect an unbound thunk but got %T\n", arg)
+		}
+	}
+
+	//Literals are left as is
+	if program := ThunkLazyArguments("$IF(x, 1, 'a')", lazyIF); program != nil {
+		t.Error("Expect literals not to be wrapped")
+	}
+
+	//Syntax errors are left to be reported by VM
+	if program := ThunkLazyArguments("$IF(x, a +, b)", lazyIF); program != nil {
+		t.Error("Expect nil for a syntax error")
+	}
+}
+
+func TestThunkBinding(t *testing.T) {
+
+	tests := []struct {
+		script    string
+		bound     bool
+		arguments bool
+	}{
+		{"$IF(x, this.a, 0)", true, false},
+		{"$IF(x, arguments[0], 0)", true, true},
+		{"$IF(x, o.arguments, 0)", false, false},
+		{"$IF(x, function() { return this.a + arguments[0] }, 0)", false, false},
+		{"$IF(x, $IF(y, this.a, 0), 0)", true, false},
+	}
+
+	for _, test := range tests {
+
+		call := firstCall(t, ThunkLazyArguments(test.script, lazyIF))
+
+		fn, bound := thunkOf(call.ArgumentList[1])
+		if fn == nil || bound != test.bound {
+			t.Errorf("%s - expect bound=%v but got %v\n", test.script, test.bound, bound)
+			continue
+		}
+
+		arguments := len(fn.ParameterList.List) == 1 && fn.ParameterList.List[0].Name == "arguments"
+		if arguments != test.arguments {
+			t.Errorf("%s - expect arguments=%v but got %v\n", test.script, test.arguments, arguments)
+		}
+	}
+}
+
+func TestThunkPositions(t *testing.T) {
+
+	script := "$IF(x,\n  a + 1, 0)"
+	call := firstCall(t, ThunkLazyArguments(script, lazyIF))
+
+	fn, _ := thunkOf(call.ArgumentList[1])
+	body := fn.Body.(*ast.ReturnStatement).Argument
+
+	//1-based offset of a + 1 in the script as written
+	if int(body.Idx0()) != 10 {
+		t.Errorf("Expect the argument at 10 but got %v\n", body.Idx0())
+	}
+}
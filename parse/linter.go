@@ -0,0 +1,182 @@
+package parse
+
+import (
+	"fmt"
+
+	"github.com/lertrel/goforit/model"
+	"github.com/robertkrimen/otto/ast"
+	"github.com/robertkrimen/otto/file"
+	"github.com/robertkrimen/otto/parser"
+)
+
+//Linter a script checker finding problems without running the script
+type Linter interface {
+
+	//Lint finding syntax errors, variables leaked as globals by functions
+	//(assigned without var) and unreachable code in the given script,
+	//problems related to functions being called (e.g., unknown function)
+	//are left to Formula.Validate, which knows available functions
+	Lint(formulaStr string) []model.Diagnostic
+}
+
+//NewLinter will return a Linter walking through JavaScript syntax tree
+func NewLinter() Linter {
+
+	return ASTLinter{}
+}
+
+//ASTLinter is a Linter implementation based on otto syntax tree
+type ASTLinter struct{}
+
+//Lint finding syntax errors, variables leaked as globals by functions
+//(assigned without var) and unreachable code in the given script
+func (l ASTLinter) Lint(formulaStr string) []model.Diagnostic {
+
+	program, err := parser.ParseFile(nil, "", formulaStr, 0)
+	if err != nil {
+		return syntaxErrors(err)
+	}
+
+	diagnostics := make([]model.Diagnostic, 0)
+
+	//Leaked globals
+	v := newAnalysisBuilder().walk(program)
+	reported := make(map[string]bool)
+
+	for _, id := range v.leaks {
+
+		if reported[id.Name] {
+			continue
+		}
+		reported[id.Name] = true
+
+		d := newDiagnostic(program, id.Idx0(), model.DiagnosticUndeclaredGlobal, model.SeverityWarning)
+		d.Message = fmt.Sprintf("'%s' is assigned without being declared (by var), so it's leaked as a global variable", id.Name)
+		diagnostics = append(diagnostics, d)
+	}
+
+	//Unreachable code
+	u := &unreachableVisitor{program: program}
+	ast.Walk(u, program)
+
+	return append(diagnostics, u.diagnostics...)
+}
+
+func syntaxErrors(err error) []model.Diagnostic {
+
+	var errs parser.ErrorList
+
+	switch err := err.(type) {
+	case parser.ErrorList:
+		errs = err
+	case *parser.Error:
+		errs = parser.ErrorList{err}
+	default:
+		return []model.Diagnostic{{
+			Code:     model.DiagnosticSyntaxError,
+			Severity: model.SeverityError,
+			Message:  err.Error(),
+		}}
+	}
+
+	diagnostics := make([]model.Diagnostic, len(errs))
+
+	for i, e := range errs {
+		diagnostics[i] = model.Diagnostic{
+			Code:     model.DiagnosticSyntaxError,
+			Severity: model.SeverityError,
+			Message:  e.Message,
+			Line:     e.Position.Line,
+			Column:   e.Position.Column,
+		}
+	}
+
+	return diagnostics
+}
+
+func newDiagnostic(program *ast.Program, idx file.Idx, code model.DiagnosticCode, severity model.Severity) model.Diagnostic {
+
+	d := model.Diagnostic{Code: code, Severity: severity}
+
+	if position := program.File.Position(idx); position != nil {
+		d.Line = position.Line
+		d.Column = position.Column
+	}
+
+	return d
+}
+
+//unreachableVisitor reporting the first statement following
+//a statement which never completes normally (e.g., return) in every
+//statement list
+type unreachableVisitor struct {
+	program     *ast.Program
+	diagnostics []model.Diagnostic
+}
+
+func (v *unreachableVisitor) Enter(n ast.Node) ast.Visitor {
+
+	switch n := n.(type) {
+	case *ast.Program:
+		v.check(n.Body)
+	case *ast.BlockStatement:
+		if n != nil {
+			v.check(n.List)
+		}
+	case *ast.CaseStatement:
+		if n != nil {
+			v.check(n.Consequent)
+		}
+	}
+
+	return v
+}
+
+func (v *unreachableVisitor) Exit(n ast.Node) {}
+
+func (v *unreachableVisitor) check(list []ast.Statement) {
+
+	for i, stmt := range list {
+
+		if !isTerminating(stmt) {
+			continue
+		}
+
+		for _, next := range list[i+1:] {
+			switch next.(type) {
+			case *ast.FunctionStatement, *ast.EmptyStatement:
+				//Function declarations are hoisted
+				continue
+			}
+
+			d := newDiagnostic(v.program, next.Idx0(), model.DiagnosticUnreachableCode, model.SeverityWarning)
+			d.Message = "unreachable code"
+			v.diagnostics = append(v.diagnostics, d)
+
+			return
+		}
+
+		return
+	}
+}
+
+//isTerminating telling if the given statement never completes normally
+func isTerminating(stmt ast.Statement) bool {
+
+	switch stmt := stmt.(type) {
+	case *ast.ReturnStatement, *ast.ThrowStatement, *ast.BranchStatement:
+		return true
+	case *ast.BlockStatement:
+		for _, s := range stmt.List {
+			if isTerminating(s) {
+				return true
+			}
+		}
+	case *ast.IfStatement:
+		return stmt.Alternate != nil &&
+			isTerminating(stmt.Consequent) &&
+			isTerminating(stmt.Alternate)
+	}
+
+	return false
+}
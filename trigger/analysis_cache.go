@@ -0,0 +1,68 @@
+package trigger
+
+import (
+	"crypto/sha256"
+	"sync"
+
+	"github.com/lertrel/goforit/model"
+	"github.com/lertrel/goforit/parse"
+)
+
+//analysisCache a cache of parse.Analysis keyed by an ID (e.g., formula ID)
+//and a hash of the script and bodies of custom functions it calls, an entry
+//is replaced once the script of the same ID (or any of the functions)
+//has been changed
+type analysisCache struct {
+	mutex   sync.RWMutex
+	entries map[string]analysisEntry
+}
+
+type analysisEntry struct {
+	hash     [sha256.Size]byte
+	analysis parse.Analysis
+}
+
+func newAnalysisCache() *analysisCache {
+
+	return &analysisCache{entries: make(map[string]analysisEntry)}
+}
+
+//get getting an analysis of the given script of the given ID from
+//the cache, the script is analyzed (and cached) if not found or changed
+func (c *analysisCache) get(f model.Formula, id string, script string) (parse.Analysis, error) {
+
+	c.mutex.RLock()
+	entry, found := c.entries[id]
+	c.mutex.RUnlock()
+
+	if found && entry.hash == analysisHash(f, script, entry.analysis.Functions) {
+		return entry.analysis, nil
+	}
+
+	analysis, err := parse.NewAnalyzer().Analyze(script, f.GetCustomFunctionBody)
+	if err != nil {
+		return parse.Analysis{}, err
+	}
+
+	c.mutex.Lock()
+	c.entries[id] = analysisEntry{hash: analysisHash(f, script, analysis.Functions), analysis: analysis}
+	c.mutex.Unlock()
+
+	return analysis, nil
+}
+
+//analysisHash hashing the given script and bodies of the given functions
+func analysisHash(f model.Formula, script string, functions []string) (hash [sha256.Size]byte) {
+
+	h := sha256.New()
+	h.Write([]byte(script))
+
+	for _, funcName := range functions {
+		h.Write([]byte{0})
+		h.Write([]byte(f.GetCustomFunctionBody(funcName)))
+	}
+
+	copy(hash[:], h.Sum(nil))
+
+	return
+}
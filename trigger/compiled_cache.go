@@ -0,0 +1,52 @@
+package trigger
+
+import (
+	"crypto/sha256"
+	"sync"
+
+	"github.com/lertrel/goforit/model"
+)
+
+//compiledCache a cache of model.CompiledFormula keyed by an ID
+//(e.g., formula ID) and a hash of the script, an entry is replaced
+//once the script of the same ID has been changed
+type compiledCache struct {
+	mutex   sync.RWMutex
+	entries map[string]compiledEntry
+}
+
+type compiledEntry struct {
+	hash     [sha256.Size]byte
+	compiled model.CompiledFormula
+}
+
+func newCompiledCache() *compiledCache {
+
+	return &compiledCache{entries: make(map[string]compiledEntry)}
+}
+
+//get getting a compiled script of the given ID from the cache,
+//the script is compiled (and cached) if not found or changed
+func (c *compiledCache) get(f model.Formula, id string, script string) (model.CompiledFormula, error) {
+
+	hash := sha256.Sum256([]byte(script))
+
+	c.mutex.RLock()
+	entry, found := c.entries[id]
+	c.mutex.RUnlock()
+
+	if found && entry.hash == hash {
+		return entry.compiled, nil
+	}
+
+	compiled, err := f.Compile(script)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mutex.Lock()
+	c.entries[id] = compiledEntry{hash: hash, compiled: compiled}
+	c.mutex.Unlock()
+
+	return compiled, nil
+}
@@ -0,0 +1,34 @@
+package trigger
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+//ErrMissingInput is matched (by errors.Is) by any MissingInputError
+var ErrMissingInput = errors.New("missing formula input")
+
+//MissingInputError is returned when a formula reads variables which are
+//provided by neither the trigger's InputMapping nor the trigger itself
+//(ContextVarName and OutputVarName)
+type MissingInputError struct {
+	//Trigger trigger ID
+	Trigger string
+	//Formula formula ID
+	Formula string
+	//Names every missing variable (in the order they're read)
+	Names []string
+}
+
+//Error returning the error message
+func (e *MissingInputError) Error() string {
+	return fmt.Sprintf(
+		"%s - formula '%s' of trigger '%s' reads %s",
+		ErrMissingInput.Error(), e.Formula, e.Trigger, strings.Join(e.Names, ", "))
+}
+
+//Is telling if the target is ErrMissingInput
+func (e *MissingInputError) Is(target error) bool {
+	return target == ErrMissingInput
+}
@@ -1,9 +1,11 @@
 package trigger
 
 import (
+	"context"
 	"errors"
 
 	"github.com/lertrel/goforit/model"
+	"github.com/lertrel/goforit/parse"
 )
 
 //SimpleTriggers simple implementation of Triggers
@@ -11,6 +13,14 @@ type SimpleTriggers struct {
 	triggerLookup Lookup
 	formulaLookup FormulaLookup
 	formula       model.Formula
+	//compiled cache of compiled formula bodies & mappings,
+	//nil for compiling them on every execution
+	compiled *compiledCache
+	//analyzed cache of analyses of formula bodies & mappings,
+	//nil for analyzing them on every validation
+	analyzed *analysisCache
+	//validate if true, inputs of a formula are validated before running
+	validate bool
 }
 
 //Execute executing formulas for a given trigger point with the states
@@ -24,7 +34,20 @@ type SimpleTriggers struct {
 //Then executing the matches formula(s) under the FormulaContext created by
 //FormulaBuilder
 //
-func (t SimpleTriggers) Execute(trigger string, context map[string]interface{}) (result map[string]interface{}, err error) {
+func (t SimpleTriggers) Execute(trigger string, context map[string]interface{}) (map[string]interface{}, error) {
+
+	return t.ExecuteContext(backgroundContext, trigger, context)
+}
+
+//ExecuteContext is the same as Execute, but any formula/mapping being
+//executed will be interrupted once the given ctx is done, in which case
+//an *model.InterruptedError is returned
+//
+//The input mapping, the formula and the output mapping are run by the
+//same random seed, the one carried by ctx (model.WithSeed) or a newly
+//generated one, which is returned as SeedKey of the result, so an
+//execution of a deterministic Formula can be replayed exactly
+func (t SimpleTriggers) ExecuteContext(ctx context.Context, trigger string, context map[string]interface{}) (result map[string]interface{}, err error) {
 
 	//Obtaining trigger definition of the given trigger ID
 	triggerDef, err := t.triggerLookup.GetTrigger(trigger)
@@ -48,12 +71,35 @@ func (t SimpleTriggers) Execute(trigger string, context map[string]interface{})
 
 	//Obtaining formula engine
 	f, _ := t.getFormula(triggerDef)
+
+	if t.validate {
+		if err = t.validateInputs(f, triggerDef, formulaDef); err != nil {
+			return
+		}
+	}
+
+	//Obtaining compiled formula
+	body, err := t.compile(f, "formula:"+formulaDef.ID, formulaDef.Body)
+	if err != nil {
+		return
+	}
+
 	//Creating a new formula context to run this formula
-	fc, err := f.NewContext(formulaDef.Body)
+	fc, err := f.NewContext("")
 	if err != nil {
 		return
 	}
 
+	//Making every run below share the same seed
+	seed, found := model.Seed(ctx)
+	if !found {
+		seed = model.NewSeed()
+		ctx = model.WithSeed(ctx, seed)
+	}
+
+	//Making every run below interruptible by ctx
+	fc = contextBoundFormulaContext{fc, ctx}
+
 	//Mapping context states as formula inputs
 	//by following input mapping rule provided
 	//by the trigger definition
@@ -62,7 +108,7 @@ func (t SimpleTriggers) Execute(trigger string, context map[string]interface{})
 	}
 
 	//Running the formula, and obtaining result
-	jsRet, err := fc.Run(formulaDef.Body)
+	jsRet, err := fc.RunCompiled(body)
 	if err != nil {
 		return
 	}
@@ -75,11 +121,116 @@ func (t SimpleTriggers) Execute(trigger string, context map[string]interface{})
 		return
 	}
 
+	result[SeedKey] = seed
 	result["_return"], err = jsRet.Export()
 
 	return
 }
 
+//SeedKey the key of the random seed (int64) of an execution in the result
+//of Triggers.Execute, passing it back by model.WithSeed to
+//Triggers.ExecuteContext replays the execution of a deterministic Formula
+//(FormulaBuilder.SetDeterministic)
+//
+//Ex.
+//
+// 		result, err := triggers.Execute("Drawing a prize", context)
+// 		seed := result[trigger.SeedKey].(int64)
+//
+// 		//Drawing the same prize again
+// 		replayed, err := triggers.ExecuteContext(model.WithSeed(ctx, seed), "Drawing a prize", context)
+//
+const SeedKey = "_seed"
+
+var backgroundContext = context.Background()
+
+//contextBoundFormulaContext a FormulaContext which every Run
+//is bound to the given context.Context
+type contextBoundFormulaContext struct {
+	model.FormulaContext
+	ctx context.Context
+}
+
+func (c contextBoundFormulaContext) Run(formulaString string) (model.Value, error) {
+
+	return c.RunContext(c.ctx, formulaString)
+}
+
+func (c contextBoundFormulaContext) RunCompiled(cf model.CompiledFormula) (model.Value, error) {
+
+	return c.RunCompiledContext(c.ctx, cf)
+}
+
+//compile getting the given script compiled from the cache (if any)
+func (t SimpleTriggers) compile(f model.Formula, id string, script string) (model.CompiledFormula, error) {
+
+	if t.compiled == nil {
+		return f.Compile(script)
+	}
+
+	return t.compiled.get(f, id, script)
+}
+
+//analyze getting an analysis of the given script from the cache (if any)
+func (t SimpleTriggers) analyze(f model.Formula, id string, script string) (parse.Analysis, error) {
+
+	if t.analyzed == nil {
+		return parse.NewAnalyzer().Analyze(script, f.GetCustomFunctionBody)
+	}
+
+	return t.analyzed.get(f, id, script)
+}
+
+//ValidateInputs checking that the InputMapping of the given trigger
+//provides every variable read by the given formula (following into
+//custom functions it calls), *MissingInputError is returned otherwise
+func (t SimpleTriggers) ValidateInputs(trigger string, formula FormulaConfig) error {
+
+	triggerDef, err := t.triggerLookup.GetTrigger(trigger)
+	if err != nil {
+		return err
+	}
+
+	f, _ := t.getFormula(triggerDef)
+
+	return t.validateInputs(f, triggerDef, formula)
+}
+
+func (t SimpleTriggers) validateInputs(f model.Formula, triggerDef Trigger, formulaDef FormulaConfig) error {
+
+	needed, err := t.analyze(f, "formula:"+formulaDef.ID, formulaDef.Body)
+	if err != nil {
+		return err
+	}
+
+	mapping, err := t.analyze(f, "input:"+triggerDef.ID, triggerDef.InputMapping)
+	if err != nil {
+		return err
+	}
+
+	provided := make(map[string]bool)
+	provided[triggerDef.ContextVarName] = true
+	provided[triggerDef.OutputVarName] = true
+
+	for _, name := range mapping.Writes {
+		provided[name] = true
+	}
+
+	missing := make([]string, 0)
+
+	for _, name := range needed.Inputs() {
+		if !provided[name] {
+			missing = append(missing, name)
+		}
+	}
+
+	if len(missing) > 0 {
+		return &MissingInputError{Trigger: triggerDef.ID, Formula: formulaDef.ID, Names: missing}
+	}
+
+	return nil
+}
+
 func (t SimpleTriggers) getFormula(trigger Trigger) (model.Formula, error) {
 
 	return t.formula, nil
@@ -97,12 +248,13 @@ func (t SimpleTriggers) mapInputs(f *model.FormulaContext, context map[string]in
 		}
 	}
 
-	if err = (*f).Prepare(c.InputMapping); err != nil {
+	mapping, err := t.compile(t.formula, "input:"+c.ID, c.InputMapping)
+	if err != nil {
 		return
 	}
 
 	//Falls through
-	_, err = (*f).Run(c.InputMapping)
+	_, err = (*f).RunCompiled(mapping)
 
 	return
 }
@@ -121,12 +273,13 @@ func (t SimpleTriggers) mapOutputs(f *model.FormulaContext, c Trigger) (result m
 		}
 	}
 
-	if err = (*f).Prepare(c.OuputMapping); err != nil {
+	mapping, err := t.compile(t.formula, "output:"+c.ID, c.OuputMapping)
+	if err != nil {
 		return
 	}
 
 	//Falls through
-	_, err = (*f).Run(c.OuputMapping)
+	_, err = (*f).RunCompiled(mapping)
 
 	return
 }
@@ -1,10 +1,13 @@
 package trigger
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"math"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/lertrel/goforit/builder"
 	"github.com/lertrel/goforit/model"
@@ -442,3 +445,217 @@ func TestTriggerBuilder(t *testing.T) {
 	}
 
 }
+
+func TestExecuteContextTimeout(t *testing.T) {
+
+	triggers := newTriggers()
+	triggers.formulaLookup = newFormulaLookup(FormulaConfig{
+		ID:      "Formula 1",
+		Body:    "while(true){}",
+		Enabled: true,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err := triggers.ExecuteContext(ctx, "loan", make(map[string]interface{}))
+	if !errors.Is(err, model.ErrTimeout) {
+		t.Errorf("Expected %v but found %v\n", model.ErrTimeout, err)
+	}
+}
+
+func TestExecuteFormulaError(t *testing.T) {
+
+	triggers := newTriggers()
+	triggers.formulaLookup = newFormulaLookup(FormulaConfig{
+		ID:      "Formula 1",
+		Body:    "$RND(p, 11)",
+		Enabled: true,
+	})
+
+	context := make(map[string]interface{})
+	context["principal"] = 1000000
+
+	_, err := triggers.Execute("loan", context)
+
+	var formulaErr *model.FormulaError
+	if !errors.As(err, &formulaErr) {
+		t.Fatalf("Expected *model.FormulaError but found %v\n", err)
+	}
+
+	if formulaErr.Function != "$RND" || formulaErr.Kind != model.ErrorKindRange {
+		t.Errorf("Unexpected %#v\n", formulaErr)
+	}
+}
+
+func TestExecuteReplayBySeed(t *testing.T) {
+
+	triggers := newTriggers()
+	triggers.formula = builder.NewFormulaBuilder().SetDeterministic(true).Get()
+	triggers.triggerLookup = newTriggerLookup(newTrigger(
+		`a = $RAND()`,
+		`output['b'] = $RANDBETWEEN(1, 1000000)`))
+	triggers.formulaLookup = newFormulaLookup(FormulaConfig{
+		ID:      "Formula 1",
+		Body:    "a + $RAND()",
+		Enabled: true,
+	})
+
+	states := make(map[string]interface{})
+
+	result, err := triggers.Execute("loan", states)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	seed, ok := result[SeedKey].(int64)
+	if !ok {
+		t.Fatalf("Expect a seed but got %v\n", result[SeedKey])
+	}
+
+	replayed, err := triggers.ExecuteContext(model.WithSeed(context.Background(), seed), "loan", states)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(result, replayed) {
+		t.Errorf("Expect %v but got %v\n", result, replayed)
+	}
+}
+
+func TestExecuteCompiledCache(t *testing.T) {
+
+	triggers := newTriggers()
+	triggers.compiled = newCompiledCache()
+
+	config := FormulaConfig{
+		ID:      "Formula 1",
+		Body:    "$RND(p, 0)",
+		Enabled: true,
+	}
+	triggers.formulaLookup = newFormulaLookup(config)
+
+	context := make(map[string]interface{})
+	context["principal"] = 1000000.4
+
+	for i := 0; i < 2; i++ {
+		result, err := triggers.Execute("loan", context)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v := result["_return"].(float64); v != 1000000 {
+			t.Errorf("Expect %v but got %v\n", 1000000, v)
+		}
+	}
+
+	entry := triggers.compiled.entries["formula:Formula 1"]
+
+	//Changing the body invalidates the cached entry
+	config.Body = "$RND(p, 1)"
+	triggers.formulaLookup = newFormulaLookup(config)
+
+	result, err := triggers.Execute("loan", context)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := result["_return"].(float64); v != 1000000.4 {
+		t.Errorf("Expect %v but got %v\n", 1000000.4, v)
+	}
+	if triggers.compiled.entries["formula:Formula 1"].hash == entry.hash {
+		t.Error("Expect the cached entry to be replaced")
+	}
+}
+
+func TestValidateInputs(t *testing.T) {
+
+	triggers := newTriggers()
+
+	config := FormulaConfig{
+		ID:      "Formula 1",
+		Body:    "$LOAN(p, d, r, t, v)",
+		Enabled: true,
+	}
+
+	if err := triggers.ValidateInputs("loan", config); err != nil {
+		t.Errorf("Unexpected %v\n", err)
+	}
+
+	f.RegisterCustomFunction(
+		"$TAXED",
+		`
+		function $TAXED(amount) {
+			return amount * (1 + tax_rate);
+		}
+		`)
+
+	config.Body = "$TAXED($LOAN(p, d, r, t, v)) + fee"
+
+	err := triggers.ValidateInputs("loan", config)
+
+	var missingErr *MissingInputError
+	if !errors.As(err, &missingErr) || !errors.Is(err, ErrMissingInput) {
+		t.Fatalf("Expected *MissingInputError but found %v\n", err)
+	}
+	if fmt.Sprint(missingErr.Names) != "[fee tax_rate]" {
+		t.Errorf("Unexpected %v\n", missingErr.Names)
+	}
+
+	//Validated before running
+	triggers.validate = true
+	triggers.formulaLookup = newFormulaLookup(config)
+
+	context := make(map[string]interface{})
+	context["principal"] = 1000000
+
+	if _, err = triggers.Execute("loan", context); !errors.Is(err, ErrMissingInput) {
+		t.Errorf("Expected %v but found %v\n", ErrMissingInput, err)
+	}
+}
+
+func TestValidateInputsCache(t *testing.T) {
+
+	triggers := newTriggers()
+	triggers.analyzed = newAnalysisCache()
+
+	f.RegisterCustomFunction(
+		"$FEE",
+		`
+		function $FEE(amount) {
+			return amount * 0.01;
+		}
+		`)
+
+	config := FormulaConfig{
+		ID:      "Formula 1",
+		Body:    "$FEE($LOAN(p, d, r, t, v))",
+		Enabled: true,
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := triggers.ValidateInputs("loan", config); err != nil {
+			t.Errorf("Unexpected %v\n", err)
+		}
+	}
+
+	entry := triggers.analyzed.entries["formula:Formula 1"]
+	if _, found := triggers.analyzed.entries["input:Test"]; !found {
+		t.Error("Expect the input mapping to be cached")
+	}
+
+	//Changing a custom function called invalidates the cached entry
+	f.RegisterCustomFunction(
+		"$FEE",
+		`
+		function $FEE(amount) {
+			return amount * fee_rate;
+		}
+		`)
+
+	var missingErr *MissingInputError
+	if err := triggers.ValidateInputs("loan", config); !errors.As(err, &missingErr) || fmt.Sprint(missingErr.Names) != "[fee_rate]" {
+		t.Errorf("Expected [fee_rate] missing but found %v\n", err)
+	}
+	if triggers.analyzed.entries["formula:Formula 1"].hash == entry.hash {
+		t.Error("Expect the cached entry to be replaced")
+	}
+}
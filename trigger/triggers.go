@@ -1,5 +1,7 @@
 package trigger
 
+import "context"
+
 //Triggers so-called a controller layer to help executing external formula
 //related to a pre-defined trigger point
 type Triggers interface {
@@ -16,4 +18,17 @@ type Triggers interface {
 	//FormulaBuilder
 	//
 	Execute(trigger string, context map[string]interface{}) (map[string]interface{}, error)
+
+	//ExecuteContext is the same as Execute, but any formula/mapping being
+	//executed will be interrupted once the given ctx is done, in which case
+	//an *model.InterruptedError is returned
+	//
+	//Every run of an execution draws random numbers by the same seed,
+	//which is returned as SeedKey of the result
+	ExecuteContext(ctx context.Context, trigger string, context map[string]interface{}) (map[string]interface{}, error)
+
+	//ValidateInputs checking that the InputMapping of the given trigger
+	//provides every variable read by the given formula (following into
+	//custom functions it calls), *MissingInputError is returned otherwise
+	ValidateInputs(trigger string, formula FormulaConfig) error
 }
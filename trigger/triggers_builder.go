@@ -14,6 +14,7 @@ type TriggersBuilder struct {
 	isTriggerLookupSet bool
 	formulaLookup      FormulaLookup
 	isFormulaLookupSet bool
+	validateInputs     bool
 }
 
 //SetFormula setting FormulaBuilder
@@ -26,6 +27,7 @@ func (b TriggersBuilder) SetFormula(formula model.Formula) TriggersBuilder {
 		isTriggerLookupSet: b.isTriggerLookupSet,
 		formulaLookup:      b.formulaLookup,
 		isFormulaLookupSet: b.isFormulaLookupSet,
+		validateInputs:     b.validateInputs,
 	}
 }
 
@@ -39,6 +41,7 @@ func (b TriggersBuilder) SetTriggerLookup(lookup Lookup) TriggersBuilder {
 		isTriggerLookupSet: true,
 		formulaLookup:      b.formulaLookup,
 		isFormulaLookupSet: b.isFormulaLookupSet,
+		validateInputs:     b.validateInputs,
 	}
 }
 
@@ -52,6 +55,24 @@ func (b TriggersBuilder) SetFormulaLookup(lookup FormulaLookup) TriggersBuilder
 		isTriggerLookupSet: b.isTriggerLookupSet,
 		formulaLookup:      lookup,
 		isFormulaLookupSet: true,
+		validateInputs:     b.validateInputs,
+	}
+}
+
+//SetValidateInputs if enabled, every formula is checked before running
+//that the trigger's InputMapping provides all variables it reads
+//(see Triggers.ValidateInputs), which costs parsing the formula and
+//its custom functions on every execution
+func (b TriggersBuilder) SetValidateInputs(enabled bool) TriggersBuilder {
+
+	return TriggersBuilder{
+		formula:            b.formula,
+		isFormulaSet:       b.isFormulaSet,
+		triggerLookup:      b.triggerLookup,
+		isTriggerLookupSet: b.isTriggerLookupSet,
+		formulaLookup:      b.formulaLookup,
+		isFormulaLookupSet: b.isFormulaLookupSet,
+		validateInputs:     enabled,
 	}
 }
 
@@ -75,5 +96,8 @@ func (b TriggersBuilder) Get() Triggers {
 		triggerLookup: b.triggerLookup,
 		formulaLookup: b.formulaLookup,
 		formula:       fb,
+		compiled:      newCompiledCache(),
+		analyzed:      newAnalysisCache(),
+		validate:      b.validateInputs,
 	}
 }
@@ -1,13 +1,40 @@
 package vm
 
+import "github.com/lertrel/goforit/model"
+
 //BuiltInFunctions an interface provided as an extenstion point
 //for client to provide their own built-in functions
 type BuiltInFunctions interface {
 
 	//Execute to execute a built-in function as per the given function name
+	//
+	//A failure should be reported by panicking with *model.FormulaError,
+	//which will be returned by FormulaContext.Run together with the position
+	//of the calling script, any other error is reported as a runtime error
 	Execute(funcName string, vm VM, funcDef interface{}) (interface{}, bool)
 
 	//Has to check if the given function name is supported
 	//by the current BuiltInFunctions
 	Has(funcName string) bool
 }
+
+//BuiltInArity an optional interface of BuiltInFunctions telling how many
+//arguments its functions accept, so a formula can be validated without
+//running it (see Formula.Validate)
+type BuiltInArity interface {
+
+	//Arity getting min and max number of arguments accepted by the given
+	//function, max is -1 for variadic functions, found is false if unknown
+	Arity(funcName string) (min int, max int, found bool)
+}
+
+//BuiltInDescriber an optional interface of BuiltInFunctions describing its
+//functions (e.g., for autocomplete and inline help of a formula editor)
+type BuiltInDescriber interface {
+
+	//List getting signatures of all functions
+	List() []model.FunctionSignature
+
+	//Describe getting signature of the given function (or alias)
+	Describe(funcName string) (model.FunctionSignature, bool)
+}
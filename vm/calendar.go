@@ -0,0 +1,256 @@
+package vm
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/lertrel/goforit/model"
+)
+
+//HolidayCalendar a model.Calendar of weekend days and a list of holidays,
+//which can be loaded from a CSV or JSON file maintained without code
+//changes (see LoadCalendarFile)
+type HolidayCalendar struct {
+	weekend  [7]bool
+	holidays map[string]string
+}
+
+//NewCalendar creating a HolidayCalendar having the given weekend days
+//(Saturday and Sunday if none) without holidays
+func NewCalendar(weekend ...time.Weekday) *HolidayCalendar {
+
+	if len(weekend) == 0 {
+		weekend = []time.Weekday{time.Saturday, time.Sunday}
+	}
+
+	c := &HolidayCalendar{holidays: make(map[string]string)}
+	for _, day := range weekend {
+		c.weekend[day] = true
+	}
+
+	return c
+}
+
+//AddHoliday adding a holiday on the (calendar) date of the given time
+func (c *HolidayCalendar) AddHoliday(date time.Time, name string) *HolidayCalendar {
+
+	c.holidays[model.FormatDate(date)] = name
+
+	return c
+}
+
+//IsWeekend telling if the (calendar) date of the given time is a weekend
+func (c *HolidayCalendar) IsWeekend(date time.Time) bool {
+
+	return c.weekend[date.Weekday()]
+}
+
+//IsHoliday telling if the (calendar) date of the given time is a holiday
+func (c *HolidayCalendar) IsHoliday(date time.Time) bool {
+
+	_, found := c.holidays[model.FormatDate(date)]
+
+	return found
+}
+
+//Holiday getting name of the holiday on the (calendar) date of the
+//given time, false if it's not a holiday
+func (c *HolidayCalendar) Holiday(date time.Time) (string, bool) {
+
+	name, found := c.holidays[model.FormatDate(date)]
+
+	return name, found
+}
+
+//LoadCalendarFile loading a HolidayCalendar from a CSV (.csv) or
+//JSON (.json) file (see LoadCalendarCSV and LoadCalendarJSON)
+func LoadCalendarFile(path string) (*HolidayCalendar, error) {
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var c *HolidayCalendar
+
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".csv":
+		c, err = LoadCalendarCSV(file)
+	case ".json":
+		c, err = LoadCalendarJSON(file)
+	default:
+		return nil, fmt.Errorf("%s - unsupported calendar file (expecting .csv or .json)", path)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("%s - %w", path, err)
+	}
+
+	return c, nil
+}
+
+//LoadCalendarCSV loading a HolidayCalendar having the given weekend days
+//(Saturday and Sunday if none) from CSV of date and (optional) name of
+//holidays, a header line and lines starting with # are skipped
+//
+//A line of weekend followed by weekday names replaces the weekend days
+//
+//Ex.
+//
+//		date,name
+//		weekend,Friday,Saturday
+//		2021-01-01,New Year's Day
+//		# Moved from Saturday
+//		2021-04-12,Songkran Festival
+//
+func LoadCalendarCSV(r io.Reader, weekend ...time.Weekday) (*HolidayCalendar, error) {
+
+	reader := csv.NewReader(r)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	c := NewCalendar(weekend...)
+
+	for line := 1; ; line++ {
+
+		record, err := reader.Read()
+		if err == io.EOF {
+			return c, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if strings.EqualFold(strings.TrimSpace(record[0]), "weekend") {
+			if err = c.setWeekend(record[1:]); err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			continue
+		}
+
+		date, err := model.ParseTime(record[0], time.UTC)
+		if err != nil {
+			if line == 1 {
+				//Header
+				continue
+			}
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		var name string
+		if len(record) > 1 {
+			name = strings.TrimSpace(record[1])
+		}
+
+		c.AddHoliday(date, name)
+	}
+}
+
+//setWeekend replacing weekend days by the given weekday names
+func (c *HolidayCalendar) setWeekend(names []string) error {
+
+	var weekend [7]bool
+
+	for _, name := range names {
+		day, err := parseWeekday(name)
+		if err != nil {
+			return err
+		}
+		weekend[day] = true
+	}
+
+	c.weekend = weekend
+
+	return nil
+}
+
+//calendarJSON a HolidayCalendar in JSON
+type calendarJSON struct {
+	Weekend  []string      `json:"weekend"`
+	Holidays []holidayJSON `json:"holidays"`
+}
+
+//holidayJSON a holiday in JSON, either an object or a date string
+type holidayJSON struct {
+	Date string `json:"date"`
+	Name string `json:"name"`
+}
+
+func (h *holidayJSON) UnmarshalJSON(data []byte) error {
+
+	if err := json.Unmarshal(data, &h.Date); err == nil {
+		return nil
+	}
+
+	type holiday holidayJSON
+
+	return json.Unmarshal(data, (*holiday)(h))
+}
+
+//LoadCalendarJSON loading a HolidayCalendar from JSON of weekend days
+//(optional, Saturday and Sunday by default) and holidays (objects of date
+//and name, or date strings)
+//
+//Ex.
+//
+//		{
+//			"weekend": ["Friday", "Saturday"],
+//			"holidays": [
+//				{"date": "2021-01-01", "name": "New Year's Day"},
+//				"2021-04-12"
+//			]
+//		}
+//
+func LoadCalendarJSON(r io.Reader) (*HolidayCalendar, error) {
+
+	var config calendarJSON
+	if err := json.NewDecoder(r).Decode(&config); err != nil {
+		return nil, err
+	}
+
+	weekend := make([]time.Weekday, len(config.Weekend))
+	for i, name := range config.Weekend {
+		day, err := parseWeekday(name)
+		if err != nil {
+			return nil, err
+		}
+		weekend[i] = day
+	}
+
+	c := NewCalendar(weekend...)
+
+	for i, holiday := range config.Holidays {
+		date, err := model.ParseTime(holiday.Date, time.UTC)
+		if err != nil {
+			return nil, fmt.Errorf("holidays[%d]: %w", i, err)
+		}
+		c.AddHoliday(date, holiday.Name)
+	}
+
+	return c, nil
+}
+
+//parseWeekday getting time.Weekday by its name (case-insensitive,
+//full or 3-letter) e.g., Sunday, sun
+func parseWeekday(name string) (time.Weekday, error) {
+
+	name = strings.ToLower(strings.TrimSpace(name))
+
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		full := strings.ToLower(day.String())
+		if name == full || name == full[:3] {
+			return day, nil
+		}
+	}
+
+	return time.Sunday, errors.New("unknown weekday " + name)
+}
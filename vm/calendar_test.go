@@ -0,0 +1,101 @@
+package vm_test
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lertrel/goforit/builder"
+	"github.com/lertrel/goforit/model"
+	"github.com/lertrel/goforit/vm"
+)
+
+func TestBusinessDayFunctions(t *testing.T) {
+
+	th, err := vm.LoadCalendarCSV(strings.NewReader(`date,name
+2021-04-06,Chakri Memorial Day
+# Songkran
+2021-04-12,Songkran Festival
+2021-04-13,Songkran Festival
+2021-04-14,Songkran Festival
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "ae.json")
+	err = ioutil.WriteFile(path, []byte(`{
+		"weekend": ["Saturday", "sun"],
+		"holidays": [{"date": "2021-12-02", "name": "National Day"}, "2021-12-03"]
+	}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ae, err := vm.LoadCalendarFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name, _ := ae.Holiday(time.Date(2021, 12, 2, 0, 0, 0, 0, time.UTC)); name != "National Day" {
+		t.Errorf("Expect %v but got %v\n", "National Day", name)
+	}
+
+	//Friday and Saturday weekend given by the CSV
+	path = filepath.Join(t.TempDir(), "sa.csv")
+	err = ioutil.WriteFile(path, []byte(`date,name
+weekend,Friday,sat
+2021-09-23,National Day
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sa, err := vm.LoadCalendarFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := builder.NewFormulaBuilder().
+		AddCalendar("TH", th).
+		AddCalendar("AE", ae).
+		AddCalendar("SA", sa).
+		Get()
+
+	runScriptTests(t, f, []scriptTest{
+		{"$WORKDAY('2021-04-09', 1, 'TH')", "2021-04-15"},
+		{"$WORKDAY('2021-04-09', 3, 'TH')", "2021-04-19"},
+		{"$WORKDAY('2021-04-15', -1, 'TH')", "2021-04-09"},
+		{"$WORKDAY('2021-04-09', 1)", "2021-04-12"},
+		{"$WORKDAY('2021-04-10', 0, 'TH')", "2021-04-10"},
+		{"$WORKDAY('2021-12-01', 1, 'AE')", "2021-12-06"},
+		{"$NETWORKDAYS('2021-04-01', '2021-04-30', 'TH')", "18"},
+		{"$NETWORKDAYS('2021-04-30', '2021-04-01', 'TH')", "-18"},
+		{"$NETWORKDAYS('2021-04-01', '2021-04-30')", "22"},
+		{"$ISBUSINESSDAY('2021-04-13', 'TH')", "false"},
+		{"$ISBUSINESSDAY('2021-04-13')", "true"},
+		{"$ISBUSINESSDAY('2021-12-03', 'AE')", "false"},
+		{"$ISBUSINESSDAY('2021-09-24', 'SA')", "false"},
+		{"$ISBUSINESSDAY('2021-09-26', 'SA')", "true"},
+		{"$WORKDAY('2021-09-22', 1, 'SA')", "2021-09-26"},
+		{"$NETWORKDAYS('2021-09-19', '2021-09-30', 'SA')", "9"},
+	})
+
+	formulaErr := formulaErrorOf(newContext(t, f), "$WORKDAY('2021-04-09', 1, 'XX')")
+	if formulaErr == nil || formulaErr.Kind != model.ErrorKindRange || formulaErr.ArgIndex != 2 {
+		t.Errorf("Unexpected %v\n", formulaErr)
+	}
+
+	runErrorTests(t, f, []errorTest{
+		{"$NETWORKDAYS('1800-01-01', '2100-01-01')", model.ErrorKindRange},
+		{"$NETWORKDAYS('2100-01-01', '1800-01-01', 'TH')", model.ErrorKindRange},
+	})
+
+	if _, err = vm.LoadCalendarCSV(strings.NewReader("2021-01-01\n31/12/2021\n")); err == nil {
+		t.Errorf("Expect an error of an invalid date\n")
+	}
+	if _, err = vm.LoadCalendarCSV(strings.NewReader("weekend,Fri,Someday\n")); err == nil {
+		t.Errorf("Expect an error of an invalid weekday\n")
+	}
+}
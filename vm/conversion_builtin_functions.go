@@ -0,0 +1,222 @@
+package vm
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/lertrel/goforit/model"
+)
+
+//conversionBuiltIns currency and unit conversion functions of
+//DefaultBuiltInFunctions, results are exact decimal strings
+var conversionBuiltIns = []builtInFunction{
+	{
+		model.FunctionSignature{
+			Name: "$FX",
+			Params: []model.Param{
+				{Name: "amount", Type: model.TypeDecimal},
+				{Name: "from", Type: model.TypeString},
+				{Name: "to", Type: model.TypeString},
+				{Name: "date", Type: model.TypeDate, Optional: true},
+			},
+			Returns:     model.TypeDecimal,
+			Description: "Converting the given amount from a currency to another by the rate of the given date, or of the as-of date of the run (see model.WithAsOf), or of the current date of the Formula's clock, an error if the rate is missing",
+			Examples:    []string{"$FX(100, 'USD', 'THB')", "$FX(price, 'USD', 'THB', invoiceDate)"},
+		},
+		fFx,
+	},
+	{
+		model.FunctionSignature{
+			Name: "$CONVERT",
+			Params: []model.Param{
+				{Name: "value", Type: model.TypeDecimal},
+				{Name: "from", Type: model.TypeString},
+				{Name: "to", Type: model.TypeString},
+			},
+			Returns:     model.TypeDecimal,
+			Description: "Converting the given value from a unit to another of the same kind (length, mass, volume, area, time, speed or temperature) e.g., km to mi",
+			Examples:    []string{"$CONVERT(10, 'km', 'mi')", "$CONVERT(100, 'C', 'F')"},
+		},
+		fConvert,
+	},
+}
+
+//rateSet rate providers looked up in order (referred by a pointer,
+//so DefaultBuiltInFunctions is still comparable)
+type rateSet struct {
+	providers []RateProvider
+}
+
+//WithRates getting a copy of the current BuiltInFunctions getting
+//exchange rates of $FX also from the given provider (after the ones
+//given before)
+func (fs DefaultBuiltInFunctions) WithRates(provider RateProvider) DefaultBuiltInFunctions {
+
+	rates := &rateSet{}
+
+	if fs.rates != nil {
+		rates.providers = append(rates.providers, fs.rates.providers...)
+	}
+
+	rates.providers = append(rates.providers, provider)
+	fs.rates = rates
+
+	return fs
+}
+
+//Rate getting the exchange rate on the (calendar) date of the given
+//time from the first provider having it
+func (fs DefaultBuiltInFunctions) Rate(from string, to string, date time.Time) (*big.Rat, bool) {
+
+	if strings.EqualFold(from, to) {
+		return big.NewRat(1, 1), true
+	}
+
+	if fs.rates == nil {
+		return nil, false
+	}
+
+	for _, provider := range fs.rates.providers {
+		if rate, found := provider.Rate(from, to, date); found {
+			return rate, true
+		}
+	}
+
+	return nil, false
+}
+
+func fFx(fs DefaultBuiltInFunctions, vm VM, funcDef interface{}) interface{} {
+
+	amount := vm.GetFuncArgAsDecimal(funcDef, 0)
+	from := vm.GetFuncArgAsString(funcDef, 1)
+	to := vm.GetFuncArgAsString(funcDef, 2)
+
+	var date time.Time
+	if vm.GetFuncArgsCount(funcDef) > 3 {
+		date = fs.getDate(vm, funcDef, 3)
+	} else {
+		date = fs.asOf(vm)
+	}
+
+	rate, found := fs.Rate(from, to, date)
+	if !found {
+		errMsg := fmt.Sprintf("no %s/%s rate on %s", strings.ToUpper(from), strings.ToUpper(to), model.FormatDate(date))
+		panic(model.NewFormulaError("$FX", -1, model.ErrorKindRange, errMsg))
+	}
+
+	return vm.ToVMValue(amount.Mul(amount, rate))
+}
+
+//unit a unit of measurement, a value v of the unit is (v + offset) * factor
+//of the base unit of its kind
+type unit struct {
+	kind   string
+	factor *big.Rat
+	offset *big.Rat
+}
+
+func newUnit(kind string, factor string, offset string) unit {
+
+	f, ok1 := new(big.Rat).SetString(factor)
+	o, ok2 := new(big.Rat).SetString(offset)
+	if !ok1 || !ok2 {
+		panic("invalid unit factor " + factor + " or offset " + offset)
+	}
+
+	return unit{kind, f, o}
+}
+
+//units units of $CONVERT by their (lower-case) symbols
+var units = map[string]unit{
+	//Length (m)
+	"m":   newUnit("length", "1", "0"),
+	"km":  newUnit("length", "1000", "0"),
+	"cm":  newUnit("length", "1/100", "0"),
+	"mm":  newUnit("length", "1/1000", "0"),
+	"in":  newUnit("length", "0.0254", "0"),
+	"ft":  newUnit("length", "0.3048", "0"),
+	"yd":  newUnit("length", "0.9144", "0"),
+	"mi":  newUnit("length", "1609.344", "0"),
+	"nmi": newUnit("length", "1852", "0"),
+	"wa":  newUnit("length", "2", "0"),
+
+	//Mass (kg)
+	"kg": newUnit("mass", "1", "0"),
+	"g":  newUnit("mass", "1/1000", "0"),
+	"mg": newUnit("mass", "1/1000000", "0"),
+	"t":  newUnit("mass", "1000", "0"),
+	"lb": newUnit("mass", "0.45359237", "0"),
+	"oz": newUnit("mass", "0.028349523125", "0"),
+
+	//Volume (l)
+	"l":    newUnit("volume", "1", "0"),
+	"ml":   newUnit("volume", "1/1000", "0"),
+	"m3":   newUnit("volume", "1000", "0"),
+	"gal":  newUnit("volume", "3.785411784", "0"),
+	"qt":   newUnit("volume", "0.946352946", "0"),
+	"pt":   newUnit("volume", "0.473176473", "0"),
+	"floz": newUnit("volume", "0.0295735295625", "0"),
+
+	//Area (m2)
+	"m2":   newUnit("area", "1", "0"),
+	"km2":  newUnit("area", "1000000", "0"),
+	"ha":   newUnit("area", "10000", "0"),
+	"acre": newUnit("area", "4046.8564224", "0"),
+	"ft2":  newUnit("area", "0.09290304", "0"),
+	"rai":  newUnit("area", "1600", "0"),
+	"ngan": newUnit("area", "400", "0"),
+	"wa2":  newUnit("area", "4", "0"),
+
+	//Time (s)
+	"s":    newUnit("time", "1", "0"),
+	"min":  newUnit("time", "60", "0"),
+	"h":    newUnit("time", "3600", "0"),
+	"day":  newUnit("time", "86400", "0"),
+	"week": newUnit("time", "604800", "0"),
+
+	//Speed (m/s)
+	"m/s":  newUnit("speed", "1", "0"),
+	"km/h": newUnit("speed", "1000/3600", "0"),
+	"mph":  newUnit("speed", "0.44704", "0"),
+	"kn":   newUnit("speed", "1852/3600", "0"),
+
+	//Temperature (K)
+	"k": newUnit("temperature", "1", "0"),
+	"c": newUnit("temperature", "1", "273.15"),
+	"f": newUnit("temperature", "5/9", "459.67"),
+}
+
+func getUnit(vm VM, funcDef interface{}, index int) unit {
+
+	symbol := vm.GetFuncArgAsString(funcDef, index)
+
+	u, found := units[strings.ToLower(strings.TrimSpace(symbol))]
+	if !found {
+		panic(model.NewFormulaError("$CONVERT", index, model.ErrorKindRange, "unknown unit "+symbol))
+	}
+
+	return u
+}
+
+func fConvert(fs DefaultBuiltInFunctions, vm VM, funcDef interface{}) interface{} {
+
+	value := vm.GetFuncArgAsDecimal(funcDef, 0)
+	from := getUnit(vm, funcDef, 1)
+	to := getUnit(vm, funcDef, 2)
+
+	if from.kind != to.kind {
+		errMsg := fmt.Sprintf("cannot convert %s (%s) to %s (%s)",
+			vm.GetFuncArgAsString(funcDef, 1), from.kind, vm.GetFuncArgAsString(funcDef, 2), to.kind)
+		panic(model.NewFormulaError("$CONVERT", 2, model.ErrorKindRange, errMsg))
+	}
+
+	base := value.Add(value, from.offset)
+	base.Mul(base, from.factor)
+
+	result := base.Quo(base, to.factor)
+	result.Sub(result, to.offset)
+
+	return vm.ToVMValue(result)
+}
@@ -0,0 +1,98 @@
+package vm_test
+
+import (
+	"context"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lertrel/goforit/builder"
+	"github.com/lertrel/goforit/model"
+	"github.com/lertrel/goforit/vm"
+)
+
+func TestConversionFunctions(t *testing.T) {
+
+	rates, err := vm.LoadRateCSV(strings.NewReader(`date,from,to,rate
+2021-01-04,USD,THB,30.01
+2021-01-05,USD,THB,30.02
+# Pegged
+,HKD,USD,0.128
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	override := vm.NewMemoryRateProvider().
+		SetRate("EUR", "THB", time.Date(2021, 1, 4, 0, 0, 0, 0, time.UTC), big.NewRat(3685, 100))
+
+	f := builder.NewFormulaBuilder().
+		SetClock(model.FixedClock(time.Date(2021, 1, 4, 20, 0, 0, 0, time.UTC))).
+		AddRateProvider(rates).
+		AddRateProvider(override).
+		Get()
+
+	//Results are exact decimals
+	tests := []struct {
+		script   string
+		expected *big.Rat
+	}{
+		{"$FX(100, 'USD', 'THB')", big.NewRat(3001, 1)},
+		{"$FX('0.1', 'usd', 'thb', '2021-01-05')", big.NewRat(3002, 1000)},
+		{"$FX(3002, 'THB', 'USD', '2021-01-05')", big.NewRat(100, 1)},
+		{"$FX(1000, 'HKD', 'USD', '2030-01-01')", big.NewRat(128, 1)},
+		{"$FX(10, 'EUR', 'THB')", big.NewRat(3685, 10)},
+		{"$FX(10, 'JPY', 'JPY')", big.NewRat(10, 1)},
+		{"$CONVERT(10, 'km', 'm')", big.NewRat(10000, 1)},
+		{"$CONVERT(1, 'mi', 'km')", big.NewRat(1609344, 1000000)},
+		{"$CONVERT(100, 'C', 'F')", big.NewRat(212, 1)},
+		{"$CONVERT(98.6, 'F', 'C')", big.NewRat(37, 1)},
+		{"$CONVERT(-40, 'F', 'c')", big.NewRat(-40, 1)},
+		{"$CONVERT(0, 'C', 'K')", big.NewRat(27315, 100)},
+		{"$CONVERT(1, 'rai', 'm2')", big.NewRat(1600, 1)},
+		{"$CONVERT(1, 'lb', 'oz')", big.NewRat(16, 1)},
+		{"$CONVERT(36, 'km/h', 'm/s')", big.NewRat(10, 1)},
+		{"$CONVERT(1, 'gal', 'l')", big.NewRat(3785411784, 1000000000)},
+	}
+
+	c := newContext(t, f)
+
+	for _, test := range tests {
+
+		c.Prepare(test.script)
+		v, err := c.Run(test.script)
+		if err != nil {
+			t.Errorf("%s - %v\n", test.script, err)
+			continue
+		}
+
+		if d, err := v.ToDecimal(); err != nil || d.Cmp(test.expected) != 0 {
+			t.Errorf("%s - expect %v but got %v (%v)\n", test.script, test.expected.RatString(), v, err)
+		}
+	}
+
+	runScriptTests(t, f, []scriptTest{
+		{"typeof $FX(100, 'USD', 'THB')", "string"},
+		{"typeof $CONVERT(10, 'km', 'm')", "string"},
+		//Rounded to model.DefaultDecimalScale places if not exact
+		{"$CONVERT(10, 'km', 'mi')", "6.2137119223733397"},
+		{"$DRND($CONVERT(1, 'gal', 'l'), 2)", "3.79"},
+		{"$IFERROR($FX(10, 'USD', 'THB', '2021-01-06'), 'n/a')", "n/a"},
+	})
+
+	runErrorTests(t, f, []errorTest{
+		{"$FX(10, 'USD', 'THB', '2021-01-06')", model.ErrorKindRange},
+		{"$FX(10, 'USD', 'EUR')", model.ErrorKindRange},
+		{"$CONVERT(1, 'km', 'kg')", model.ErrorKindRange},
+		{"$CONVERT(1, 'parsec', 'km')", model.ErrorKindRange},
+	})
+
+	//The rate of a run is as of its date
+	ctx := model.WithAsOf(context.Background(), time.Date(2021, 1, 5, 0, 0, 0, 0, time.UTC))
+	if s, err := run(ctx, c, "$FX(1, 'USD', 'THB')"); err != nil {
+		t.Error(err)
+	} else if s != "30.02" {
+		t.Errorf("Expect %v but got %v\n", "30.02", s)
+	}
+}
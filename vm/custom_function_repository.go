@@ -20,3 +20,21 @@ type CustomFunctionRepository interface {
 	//GetFunctionBody to get custom function source code
 	GetFunctionBody(funcName string) string
 }
+
+//FunctionLister an optional interface of CustomFunctionRepository and
+//BuiltInFunctions which are able to enumerate their functions, so all of
+//the functions could be loaded in advance (e.g., into a template VM)
+type FunctionLister interface {
+
+	//FunctionNames getting names of all functions provided
+	FunctionNames() []string
+}
+
+//FunctionVersioner an optional interface of CustomFunctionRepository whose
+//functions are changed by itself (e.g., reloaded from files), so functions
+//loaded in advance (e.g., into a template VM) are reloaded once changed
+type FunctionVersioner interface {
+
+	//FunctionsVersion getting a number changed every time functions are changed
+	FunctionsVersion() uint64
+}
@@ -0,0 +1,612 @@
+package vm
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lertrel/goforit/model"
+)
+
+//dateBuiltIns date functions of DefaultBuiltInFunctions, dates are
+//passed around as strings e.g., 2020-12-31 (see model.ParseTime)
+var dateBuiltIns = []builtInFunction{
+	{
+		model.FunctionSignature{
+			Name: "$DATE",
+			Params: []model.Param{
+				{Name: "year", Type: model.TypeInteger},
+				{Name: "month", Type: model.TypeInteger},
+				{Name: "day", Type: model.TypeInteger},
+			},
+			Returns:     model.TypeDate,
+			Description: "A date (e.g., 2020-12-31) of the given year, month (1 to 12) and day, overflowing months and days are carried over",
+			Examples:    []string{"$DATE(2020, 12, 31)", "$DATE(2020, 13, 1)"},
+		},
+		fDate,
+	},
+	{
+		model.FunctionSignature{
+			Name:        "$NOW",
+			Returns:     model.TypeDate,
+			Description: "The current date-time (e.g., 2020-12-31T23:59:59+07:00) of the Formula's clock and time zone",
+			Examples:    []string{"$NOW()"},
+		},
+		fNow,
+	},
+	{
+		model.FunctionSignature{
+			Name:        "$TODAY",
+			Returns:     model.TypeDate,
+			Description: "The current date (e.g., 2020-12-31) of the Formula's clock and time zone",
+			Examples:    []string{"$TODAY()"},
+		},
+		fToday,
+	},
+	{
+		model.FunctionSignature{
+			Name: "$DATEDIFF",
+			Params: []model.Param{
+				{Name: "start", Type: model.TypeDate},
+				{Name: "end", Type: model.TypeDate},
+				{Name: "unit", Type: model.TypeString, Optional: true},
+			},
+			Returns:     model.TypeInteger,
+			Description: "Number of whole days (by default), weeks, months or years from start to end, negative if end is before start",
+			Examples:    []string{"$DATEDIFF('2020-01-15', '2020-03-01')", "$DATEDIFF(start, end, 'months')"},
+		},
+		fDateDiff,
+	},
+	{
+		model.FunctionSignature{
+			Name:        "$EDATE",
+			Params:      []model.Param{{Name: "date", Type: model.TypeDate}, {Name: "months", Type: model.TypeInteger}},
+			Returns:     model.TypeDate,
+			Description: "The date the given number of months before or after the given date, the day is limited to the end of the month",
+			Examples:    []string{"$EDATE('2020-01-31', 1)", "$EDATE(start, -12)"},
+		},
+		fEDate,
+	},
+	{
+		model.FunctionSignature{
+			Name:        "$EOMONTH",
+			Params:      []model.Param{{Name: "date", Type: model.TypeDate}, {Name: "months", Type: model.TypeInteger}},
+			Returns:     model.TypeDate,
+			Description: "The last day of the month the given number of months before or after the given date",
+			Examples:    []string{"$EOMONTH('2020-01-15', 0)", "$EOMONTH(start, 1)"},
+		},
+		fEOMonth,
+	},
+	{
+		model.FunctionSignature{
+			Name: "$YEARFRAC",
+			Params: []model.Param{
+				{Name: "start", Type: model.TypeDate},
+				{Name: "end", Type: model.TypeDate},
+				{Name: "basis", Type: model.TypeInteger, Optional: true},
+			},
+			Returns:     model.TypeNumber,
+			Description: "Fraction of years between two dates by the given day count basis (as Excel): 0 US 30/360 (default), 1 actual/actual, 2 actual/360, 3 actual/365, 4 European 30/360",
+			Examples:    []string{"$YEARFRAC('2020-01-01', '2020-07-01')", "$YEARFRAC(start, end, 1)"},
+		},
+		fYearFrac,
+	},
+	{
+		model.FunctionSignature{
+			Name:        "$WEEKDAY",
+			Params:      []model.Param{{Name: "date", Type: model.TypeDate}, {Name: "type", Type: model.TypeInteger, Optional: true}},
+			Returns:     model.TypeInteger,
+			Description: "Day of the week of the given date (as Excel) by the given type: 1 Sunday 1 to Saturday 7 (default), 2 Monday 1 to Sunday 7, 3 Monday 0 to Sunday 6",
+			Examples:    []string{"$WEEKDAY('2020-12-31')", "$WEEKDAY($TODAY(), 2)"},
+		},
+		fWeekday,
+	},
+	{
+		model.FunctionSignature{
+			Name:        "$AGE",
+			Params:      []model.Param{{Name: "birthDate", Type: model.TypeDate}, {Name: "asOf", Type: model.TypeDate, Optional: true}},
+			Returns:     model.TypeInteger,
+			Description: "Age in completed years on the given date (today if omitted)",
+			Examples:    []string{"$AGE('1980-02-29')", "$AGE(birthDate, policyDate)"},
+		},
+		fAge,
+	},
+	{
+		model.FunctionSignature{
+			Name: "$WORKDAY",
+			Params: []model.Param{
+				{Name: "start", Type: model.TypeDate},
+				{Name: "days", Type: model.TypeInteger},
+				{Name: "calendar", Type: model.TypeString, Optional: true},
+			},
+			Returns:     model.TypeDate,
+			Description: "The date the given number of business days before or after the start date by the given calendar (Saturday and Sunday weekend without holidays if omitted)",
+			Examples:    []string{"$WORKDAY('2021-04-09', 3, 'TH')", "$WORKDAY($TODAY(), -1)"},
+		},
+		fWorkday,
+	},
+	{
+		model.FunctionSignature{
+			Name: "$NETWORKDAYS",
+			Params: []model.Param{
+				{Name: "start", Type: model.TypeDate},
+				{Name: "end", Type: model.TypeDate},
+				{Name: "calendar", Type: model.TypeString, Optional: true},
+			},
+			Returns:     model.TypeInteger,
+			Description: "Number of business days from start to end (inclusive) by the given calendar, negative if end is before start",
+			Examples:    []string{"$NETWORKDAYS('2021-04-01', '2021-04-30', 'TH')"},
+		},
+		fNetworkDays,
+	},
+	{
+		model.FunctionSignature{
+			Name:        "$ISBUSINESSDAY",
+			Params:      []model.Param{{Name: "date", Type: model.TypeDate}, {Name: "calendar", Type: model.TypeString, Optional: true}},
+			Returns:     model.TypeBoolean,
+			Description: "True if the given date is neither a weekend nor a holiday of the given calendar",
+			Examples:    []string{"$ISBUSINESSDAY('2021-04-13', 'TH')"},
+		},
+		fIsBusinessDay,
+	},
+}
+
+//WithClock getting a copy of the current BuiltInFunctions reading the
+//current time (of $NOW, $TODAY, ...) from the given clock
+//(model.SystemClock by default)
+func (fs DefaultBuiltInFunctions) WithClock(clock model.Clock) DefaultBuiltInFunctions {
+
+	fs.clock = clock
+
+	return fs
+}
+
+//WithLocation getting a copy of the current BuiltInFunctions using the
+//given time zone (UTC by default) for dates without time zone offset,
+//and for dates returned by functions
+func (fs DefaultBuiltInFunctions) WithLocation(loc *time.Location) DefaultBuiltInFunctions {
+
+	fs.location = loc
+
+	return fs
+}
+
+//Location getting the time zone of dates
+func (fs DefaultBuiltInFunctions) Location() *time.Location {
+
+	if fs.location == nil {
+		return time.UTC
+	}
+
+	return fs.location
+}
+
+//now getting the current time (in the time zone of dates)
+func (fs DefaultBuiltInFunctions) now() time.Time {
+
+	clock := fs.clock
+	if clock == nil {
+		clock = model.SystemClock
+	}
+
+	return clock.Now().In(fs.Location())
+}
+
+//getDate getting the argument at the given index as time in the time zone of dates
+func (fs DefaultBuiltInFunctions) getDate(vm VM, funcDef interface{}, index int) time.Time {
+
+	loc := fs.Location()
+
+	return vm.GetFuncArgAsTime(funcDef, index, loc).In(loc)
+}
+
+//civilDays number of days since 1970-01-01 of the (calendar) date of
+//the given time regardless of its time zone
+func civilDays(t time.Time) int {
+
+	y, m, d := t.Date()
+
+	return int(time.Date(y, m, d, 0, 0, 0, 0, time.UTC).Unix() / 86400)
+}
+
+//wholeMonths number of whole months from start to end (start <= end)
+func wholeMonths(start time.Time, end time.Time) int {
+
+	months := (end.Year()-start.Year())*12 + int(end.Month()-start.Month())
+	if end.Day() < start.Day() {
+		months--
+	}
+
+	return months
+}
+
+//addMonths the date the given number of months after the given date,
+//the day is limited to the end of the month
+func addMonths(t time.Time, months int) time.Time {
+
+	firstDay := time.Date(t.Year(), t.Month()+time.Month(months), 1, 0, 0, 0, 0, t.Location())
+
+	day := t.Day()
+	if last := daysInMonth(firstDay); day > last {
+		day = last
+	}
+
+	return firstDay.AddDate(0, 0, day-1)
+}
+
+func daysInMonth(t time.Time) int {
+
+	return time.Date(t.Year(), t.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
+
+func isLeapYear(year int) bool {
+
+	return year%4 == 0 && (year%100 != 0 || year%400 == 0)
+}
+
+func fDate(fs DefaultBuiltInFunctions, vm VM, funcDef interface{}) interface{} {
+
+	year := vm.GetFuncArgAsInt(funcDef, 0)
+	month := vm.GetFuncArgAsInt(funcDef, 1)
+	day := vm.GetFuncArgAsInt(funcDef, 2)
+
+	if year < 1 || year > 9999 {
+		panic(model.NewFormulaError("$DATE", 0, model.ErrorKindRange, "year should be between 1 and 9999"))
+	}
+
+	t := time.Date(int(year), time.Month(month), int(day), 0, 0, 0, 0, fs.Location())
+
+	return vm.ToVMValue(model.FormatDate(t))
+}
+
+func fNow(fs DefaultBuiltInFunctions, vm VM, funcDef interface{}) interface{} {
+
+	return vm.ToVMValue(model.FormatDateTime(fs.now()))
+}
+
+func fToday(fs DefaultBuiltInFunctions, vm VM, funcDef interface{}) interface{} {
+
+	return vm.ToVMValue(model.FormatDate(fs.now()))
+}
+
+func fDateDiff(fs DefaultBuiltInFunctions, vm VM, funcDef interface{}) interface{} {
+
+	start := fs.getDate(vm, funcDef, 0)
+	end := fs.getDate(vm, funcDef, 1)
+
+	unit := "days"
+	if vm.GetFuncArgsCount(funcDef) > 2 {
+		unit = strings.ToLower(vm.GetFuncArgAsString(funcDef, 2))
+	}
+
+	sign := 1
+	if end.Before(start) {
+		start, end = end, start
+		sign = -1
+	}
+
+	var diff int
+
+	switch unit {
+	case "days", "day", "d":
+		diff = civilDays(end) - civilDays(start)
+	case "weeks", "week", "w":
+		diff = (civilDays(end) - civilDays(start)) / 7
+	case "months", "month", "m":
+		diff = wholeMonths(start, end)
+	case "years", "year", "y":
+		diff = wholeMonths(start, end) / 12
+	default:
+		errMsg := fmt.Sprintf("unknown unit %q (expecting days, weeks, months or years)", unit)
+		panic(model.NewFormulaError("$DATEDIFF", 2, model.ErrorKindRange, errMsg))
+	}
+
+	return vm.ToVMValue(sign * diff)
+}
+
+func fEDate(fs DefaultBuiltInFunctions, vm VM, funcDef interface{}) interface{} {
+
+	t := fs.getDate(vm, funcDef, 0)
+	months := vm.GetFuncArgAsInt(funcDef, 1)
+
+	return vm.ToVMValue(model.FormatDate(addMonths(t, int(months))))
+}
+
+func fEOMonth(fs DefaultBuiltInFunctions, vm VM, funcDef interface{}) interface{} {
+
+	t := fs.getDate(vm, funcDef, 0)
+	months := vm.GetFuncArgAsInt(funcDef, 1)
+
+	//Day 0 of the next month
+	t = time.Date(t.Year(), t.Month()+time.Month(months)+1, 0, 0, 0, 0, 0, t.Location())
+
+	return vm.ToVMValue(model.FormatDate(t))
+}
+
+func fYearFrac(fs DefaultBuiltInFunctions, vm VM, funcDef interface{}) interface{} {
+
+	start := fs.getDate(vm, funcDef, 0)
+	end := fs.getDate(vm, funcDef, 1)
+
+	var basis int64
+	if vm.GetFuncArgsCount(funcDef) > 2 {
+		basis = vm.GetFuncArgAsInt(funcDef, 2)
+	}
+
+	if civilDays(end) < civilDays(start) {
+		start, end = end, start
+	}
+
+	days := float64(civilDays(end) - civilDays(start))
+
+	var result float64
+
+	switch basis {
+	case 0:
+		result = days360(start, end, false) / 360
+	case 1:
+		result = days / actualDaysPerYear(start, end)
+	case 2:
+		result = days / 360
+	case 3:
+		result = days / 365
+	case 4:
+		result = days360(start, end, true) / 360
+	default:
+		panic(model.NewFormulaError("$YEARFRAC", 2, model.ErrorKindRange, "basis should be between 0 and 4"))
+	}
+
+	return vm.ToVMValue(result)
+}
+
+//days360 number of days between two dates of a 360-day year (twelve
+//30-day months) by US (NASD) or European method
+func days360(start time.Time, end time.Time, european bool) float64 {
+
+	d1, d2 := start.Day(), end.Day()
+
+	if european {
+		if d1 == 31 {
+			d1 = 30
+		}
+		if d2 == 31 {
+			d2 = 30
+		}
+	} else {
+		startEOFeb := start.Month() == time.February && d1 == daysInMonth(start)
+		endEOFeb := end.Month() == time.February && d2 == daysInMonth(end)
+
+		if startEOFeb && endEOFeb {
+			d2 = 30
+		}
+		if startEOFeb {
+			d1 = 30
+		}
+		if d2 == 31 && d1 >= 30 {
+			d2 = 30
+		}
+		if d1 == 31 {
+			d1 = 30
+		}
+	}
+
+	return float64((end.Year()-start.Year())*360 + int(end.Month()-start.Month())*30 + d2 - d1)
+}
+
+//actualDaysPerYear a denominator of actual/actual basis (as Excel),
+//which is 365 or 366 for dates within a year, otherwise an average
+//length of the years from start to end
+func actualDaysPerYear(start time.Time, end time.Time) float64 {
+
+	if !addMonths(start, 12).Before(end) {
+
+		if start.Year() == end.Year() {
+			if isLeapYear(start.Year()) {
+				return 366
+			}
+			return 365
+		}
+
+		//Including 29 February of either year
+		if isLeapYear(start.Year()) && (start.Month() < time.March) ||
+			isLeapYear(end.Year()) && (end.Month() > time.February || end.Month() == time.February && end.Day() == 29) {
+			return 366
+		}
+
+		return 365
+	}
+
+	days := 0
+	for year := start.Year(); year <= end.Year(); year++ {
+		days += 365
+		if isLeapYear(year) {
+			days++
+		}
+	}
+
+	return float64(days) / float64(end.Year()-start.Year()+1)
+}
+
+func fWeekday(fs DefaultBuiltInFunctions, vm VM, funcDef interface{}) interface{} {
+
+	t := fs.getDate(vm, funcDef, 0)
+
+	var returnType int64 = 1
+	if vm.GetFuncArgsCount(funcDef) > 1 {
+		returnType = vm.GetFuncArgAsInt(funcDef, 1)
+	}
+
+	//Sunday is 0
+	weekday := int(t.Weekday())
+
+	switch returnType {
+	case 1:
+		weekday++
+	case 2:
+		weekday = (weekday+6)%7 + 1
+	case 3:
+		weekday = (weekday + 6) % 7
+	default:
+		panic(model.NewFormulaError("$WEEKDAY", 1, model.ErrorKindRange, "type should be 1, 2 or 3"))
+	}
+
+	return vm.ToVMValue(weekday)
+}
+
+func fAge(fs DefaultBuiltInFunctions, vm VM, funcDef interface{}) interface{} {
+
+	birthDate := fs.getDate(vm, funcDef, 0)
+
+	asOf := fs.now()
+	if vm.GetFuncArgsCount(funcDef) > 1 {
+		asOf = fs.getDate(vm, funcDef, 1)
+	}
+
+	if civilDays(asOf) < civilDays(birthDate) {
+		panic(model.NewFormulaError("$AGE", 1, model.ErrorKindRange, "date is before the birth date"))
+	}
+
+	return vm.ToVMValue(wholeMonths(birthDate, asOf) / 12)
+}
+
+//calendarSet calendars by names (referred by a pointer, so
+//DefaultBuiltInFunctions is still comparable)
+type calendarSet struct {
+	byName map[string]model.Calendar
+}
+
+//weekendCalendar a calendar of business-day functions given no calendar
+var weekendCalendar = NewCalendar()
+
+//maxWorkdays the largest number of business days (either way) accepted by $WORKDAY
+const maxWorkdays = 100000
+
+//maxNetworkDaysSpan the largest number of calendar days (either way)
+//between dates accepted by $NETWORKDAYS, which checks every day
+const maxNetworkDaysSpan = 100000
+
+//WithCalendar getting a copy of the current BuiltInFunctions having the
+//given calendar registered under the given name (e.g., "TH") for
+//business-day functions e.g., $WORKDAY(start, 3, "TH")
+func (fs DefaultBuiltInFunctions) WithCalendar(name string, calendar model.Calendar) DefaultBuiltInFunctions {
+
+	calendars := &calendarSet{byName: make(map[string]model.Calendar)}
+
+	if fs.calendars != nil {
+		for n, c := range fs.calendars.byName {
+			calendars.byName[n] = c
+		}
+	}
+
+	calendars.byName[name] = calendar
+	fs.calendars = calendars
+
+	return fs
+}
+
+//Calendar getting the calendar registered under the given name
+func (fs DefaultBuiltInFunctions) Calendar(name string) (model.Calendar, bool) {
+
+	if fs.calendars == nil {
+		return nil, false
+	}
+
+	calendar, found := fs.calendars.byName[name]
+
+	return calendar, found
+}
+
+//getCalendar getting the calendar named by the (optional) argument at the
+//given index, weekendCalendar if it's omitted
+func (fs DefaultBuiltInFunctions) getCalendar(funcName string, vm VM, funcDef interface{}, index int) model.Calendar {
+
+	if index >= vm.GetFuncArgsCount(funcDef) {
+		return weekendCalendar
+	}
+
+	name := vm.GetFuncArgAsString(funcDef, index)
+
+	calendar, found := fs.Calendar(name)
+	if !found {
+		panic(model.NewFormulaError(funcName, index, model.ErrorKindRange, "unknown calendar "+name))
+	}
+
+	return calendar
+}
+
+func isBusinessDay(calendar model.Calendar, date time.Time) bool {
+
+	return !calendar.IsWeekend(date) && !calendar.IsHoliday(date)
+}
+
+func fWorkday(fs DefaultBuiltInFunctions, vm VM, funcDef interface{}) interface{} {
+
+	date := fs.getDate(vm, funcDef, 0)
+	days := vm.GetFuncArgAsInt(funcDef, 1)
+	calendar := fs.getCalendar("$WORKDAY", vm, funcDef, 2)
+
+	if days < -maxWorkdays || days > maxWorkdays {
+		errMsg := fmt.Sprintf("days should be between %d and %d", -maxWorkdays, maxWorkdays)
+		panic(model.NewFormulaError("$WORKDAY", 1, model.ErrorKindRange, errMsg))
+	}
+
+	step := 1
+	if days < 0 {
+		step, days = -1, -days
+	}
+
+	//Days in a row without a business day, for not looping forever
+	//with a calendar having no business day
+	idle := 0
+
+	for days > 0 {
+		date = date.AddDate(0, 0, step)
+
+		if !isBusinessDay(calendar, date) {
+			if idle++; idle > 366 {
+				panic(model.NewFormulaError("$WORKDAY", 2, model.ErrorKindRuntime, "no business day within a year"))
+			}
+			continue
+		}
+
+		idle = 0
+		days--
+	}
+
+	return vm.ToVMValue(model.FormatDate(date))
+}
+
+func fNetworkDays(fs DefaultBuiltInFunctions, vm VM, funcDef interface{}) interface{} {
+
+	start := fs.getDate(vm, funcDef, 0)
+	end := fs.getDate(vm, funcDef, 1)
+	calendar := fs.getCalendar("$NETWORKDAYS", vm, funcDef, 2)
+
+	sign := 1
+	if civilDays(end) < civilDays(start) {
+		start, end = end, start
+		sign = -1
+	}
+
+	if civilDays(end)-civilDays(start) > maxNetworkDaysSpan {
+		errMsg := fmt.Sprintf("start and end should be at most %d days apart", maxNetworkDaysSpan)
+		panic(model.NewFormulaError("$NETWORKDAYS", 1, model.ErrorKindRange, errMsg))
+	}
+
+	days := 0
+	for date := start; civilDays(date) <= civilDays(end); date = date.AddDate(0, 0, 1) {
+		if isBusinessDay(calendar, date) {
+			days++
+		}
+	}
+
+	return vm.ToVMValue(sign * days)
+}
+
+func fIsBusinessDay(fs DefaultBuiltInFunctions, vm VM, funcDef interface{}) interface{} {
+
+	date := fs.getDate(vm, funcDef, 0)
+	calendar := fs.getCalendar("$ISBUSINESSDAY", vm, funcDef, 1)
+
+	return vm.ToVMValue(isBusinessDay(calendar, date))
+}
@@ -0,0 +1,77 @@
+package vm_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lertrel/goforit/builder"
+	"github.com/lertrel/goforit/model"
+)
+
+func TestDateFunctions(t *testing.T) {
+
+	bangkok := time.FixedZone("ICT", 7*60*60)
+	now := time.Date(2020, 12, 31, 20, 30, 0, 0, time.UTC)
+
+	f := builder.NewFormulaBuilder().
+		SetClock(model.FixedClock(now)).
+		SetLocation(bangkok).
+		RegisterGoFunc("$QUARTER", func(date time.Time) int {
+			return (int(date.Month())-1)/3 + 1
+		}).
+		Get()
+
+	runScriptTests(t, f, []scriptTest{
+		{"$DATE(2020, 12, 31)", "2020-12-31"},
+		{"$DATE(2020, 13, 1)", "2021-01-01"},
+		{"$NOW()", "2021-01-01T03:30:00+07:00"},
+		{"$TODAY()", "2021-01-01"},
+		{"$DATEDIFF('2020-01-15', '2020-03-01')", "46"},
+		{"$DATEDIFF('2020-03-01', '2020-01-15')", "-46"},
+		{"$DATEDIFF('2020-01-31', '2020-02-29', 'months')", "0"},
+		{"$DATEDIFF('2020-01-15', '2021-03-15', 'M')", "14"},
+		{"$DATEDIFF('2020-01-01', '2020-01-15', 'weeks')", "2"},
+		{"$DATEDIFF('2020-12-31T20:00:00Z', $TODAY())", "0"},
+		{"$EDATE('2020-01-31', 1)", "2020-02-29"},
+		{"$EDATE('2020-03-31', -13)", "2019-02-28"},
+		{"$EOMONTH('2020-01-15', 1)", "2020-02-29"},
+		{"$EOMONTH('2020-01-15', -1)", "2019-12-31"},
+		{"$YEARFRAC('2020-01-01', '2020-07-01')", "0.5"},
+		{"$YEARFRAC('2020-01-31', '2020-03-31')", "0.16666666666666666"},
+		{"$YEARFRAC('2020-01-01', '2020-07-01', 1)", "0.4972677595628415"},
+		{"$YEARFRAC('2019-06-01', '2021-06-01', 1)", "2.0009124087591244"},
+		{"$YEARFRAC('2020-01-01', '2020-07-01', 2)", "0.5055555555555555"},
+		{"$YEARFRAC('2020-01-01', '2020-07-01', 3)", "0.4986301369863014"},
+		{"$WEEKDAY('2020-12-31')", "5"},
+		{"$WEEKDAY('2020-12-27', 2)", "7"},
+		{"$WEEKDAY('2020-12-27', 3)", "6"},
+		{"$AGE('1980-02-29')", "40"},
+		{"$AGE('1980-02-29', '2021-02-28')", "40"},
+		{"$AGE(new Date(Date.UTC(1980, 0, 1)), '2020-12-31')", "40"},
+		{"$QUARTER($DATE(2020, 8, 1))", "3"},
+	})
+
+	runErrorTests(t, f, []errorTest{
+		{"$DATE(0, 1, 1)", model.ErrorKindRange},
+		{"$EDATE('31/12/2020', 1)", model.ErrorKindType},
+		{"$DATEDIFF($TODAY(), $NOW(), 'hours')", model.ErrorKindRange},
+		{"$AGE($TODAY(), '2000-01-01')", model.ErrorKindRange},
+	})
+
+	//Dates travel between Go and JS as strings
+	c := newContext(t, f)
+	c.Set("start", time.Date(2020, 1, 31, 0, 0, 0, 0, bangkok))
+
+	c.Prepare("$EDATE(start, 1)")
+	v, err := c.Run("$EDATE(start, 1)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := v.ToTime()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !d.Equal(time.Date(2020, 2, 29, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expect %v but got %v\n", "2020-02-29", d)
+	}
+}
@@ -1,10 +1,14 @@
 package vm
 
 import (
-	"errors"
+	"fmt"
 	"math"
 	"math/big"
+	"sort"
 	"strconv"
+	"time"
+
+	"github.com/lertrel/goforit/model"
 )
 
 //NewBuiltInFunctions is returning a default implementation
@@ -15,76 +19,420 @@ func NewBuiltInFunctions() BuiltInFunctions {
 
 //DefaultBuiltInFunctions providing built-in functions shipped with goforit
 type DefaultBuiltInFunctions struct {
+	rounding   model.RoundingMode
+	clock      model.Clock
+	location   *time.Location
+	calendars  *calendarSet
+	tables     *tableSet
+	parameters *parameterSet
+	rates      *rateSet
 }
 
-//Has to check if the given function name is supported
-//by the current BuiltInFunctions
-func (fs DefaultBuiltInFunctions) Has(funcName string) bool {
+//WithRounding getting a copy of the current BuiltInFunctions using the
+//given rounding mode (model.RoundHalfUp by default) whenever a rounding
+//mode isn't given to a function e.g., $RND(2.5, 0)
+func (fs DefaultBuiltInFunctions) WithRounding(mode model.RoundingMode) DefaultBuiltInFunctions {
 
-	switch funcName {
+	fs.rounding = mode
 
-	case "$ABS":
-		return true
-	case "$RND":
-		return true
-	case "$FLOOR", "$FLR":
-		return true
-	case "$CEIL":
-		return true
-	case "$IF":
-		return true
-	case "$SUMI":
-		return true
-	case "$SUMF":
-		return true
-	case "$AVG":
-		return true
-	case "$MIN":
-		return true
-	case "$MAX":
-		return true
-	default:
-		return false
+	return fs
+}
+
+//Rounding getting the default rounding mode
+func (fs DefaultBuiltInFunctions) Rounding() model.RoundingMode {
+
+	return fs.rounding
+}
+
+//builtInFunction a built-in function described by its signature
+type builtInFunction struct {
+	signature model.FunctionSignature
+	execute   func(fs DefaultBuiltInFunctions, vm VM, funcDef interface{}) interface{}
+}
+
+//defaultBuiltIns every function of DefaultBuiltInFunctions
+var defaultBuiltIns = []builtInFunction{
+	{
+		model.FunctionSignature{
+			Name:        "$ABS",
+			Params:      []model.Param{{Name: "value", Type: model.TypeNumber}},
+			Returns:     model.TypeNumber,
+			Description: "Absolute value of a number",
+			Examples:    []string{"$ABS(-1.5)"},
+		},
+		fAbs,
+	},
+	{
+		model.FunctionSignature{
+			Name: "$RND",
+			Params: []model.Param{
+				{Name: "value", Type: model.TypeNumber},
+				{Name: "precision", Type: model.TypeInteger},
+				{Name: "mode", Type: model.TypeString, Optional: true},
+			},
+			Returns:     model.TypeNumber,
+			Description: "Rounding a number to the given decimal places (-10 to 10, negative for tens, hundreds, ...) by the given rounding mode (the Formula's default, half-up unless configured, if omitted)",
+			Examples:    []string{"$RND(3.14159, 2)", "$RND(2.5, 0, 'half-even')", "$RND(1250, -2)"},
+		},
+		fRnd,
+	},
+	{
+		model.FunctionSignature{
+			Name:        "$FLOOR",
+			Aliases:     []string{"$FLR"},
+			Params:      []model.Param{{Name: "value", Type: model.TypeNumber}, {Name: "precision", Type: model.TypeInteger}},
+			Returns:     model.TypeNumber,
+			Description: "Rounding a number down (toward negative infinity) to the given decimal places (-10 to 10)",
+			Examples:    []string{"$FLOOR(3.14159, 2)", "$FLR(3.9, 0)"},
+		},
+		fFloor,
+	},
+	{
+		model.FunctionSignature{
+			Name:        "$CEIL",
+			Params:      []model.Param{{Name: "value", Type: model.TypeNumber}, {Name: "precision", Type: model.TypeInteger}},
+			Returns:     model.TypeNumber,
+			Description: "Rounding a number up (toward positive infinity) to the given decimal places (-10 to 10)",
+			Examples:    []string{"$CEIL(3.14159, 2)"},
+		},
+		fCeil,
+	},
+	{
+		model.FunctionSignature{
+			Name: "$MROUND",
+			Params: []model.Param{
+				{Name: "value", Type: model.TypeNumber},
+				{Name: "multiple", Type: model.TypeNumber},
+				{Name: "mode", Type: model.TypeString, Optional: true},
+			},
+			Returns:     model.TypeNumber,
+			Description: "Rounding a number to the given multiple by the given rounding mode (the Formula's default if omitted), the number and the multiple must have the same sign",
+			Examples:    []string{"$MROUND(10.38, 0.25)", "$MROUND(1234, 50, 'floor')"},
+		},
+		fMRound,
+	},
+	{
+		model.FunctionSignature{
+			Name: "$IF",
+			Params: []model.Param{
+				{Name: "condition", Type: model.TypeBoolean},
+				{Name: "then", Type: model.TypeAny, Lazy: true},
+				{Name: "else", Type: model.TypeAny, Lazy: true},
+			},
+			Returns:     model.TypeAny,
+			Description: "Choosing between two values by the given condition, only the chosen value is evaluated",
+			Examples:    []string{"$IF(age > 60, 0.5, 1)", "$IF(x != 0, 100 / x, 0)"},
+		},
+		fIf,
+	},
+	{
+		model.FunctionSignature{
+			Name: "$IFS",
+			Params: []model.Param{
+				{Name: "condition", Type: model.TypeBoolean, Lazy: true},
+				{Name: "value", Type: model.TypeAny, Lazy: true},
+				{Name: "conditionsAndValues", Type: model.TypeAny, Optional: true, Variadic: true, Lazy: true},
+			},
+			Returns:     model.TypeAny,
+			Description: "The value of the first true condition (conditions are evaluated in order), an error if no condition is true",
+			Examples:    []string{"$IFS(score >= 80, 'A', score >= 70, 'B', true, 'C')"},
+		},
+		fIfs,
+	},
+	{
+		model.FunctionSignature{
+			Name: "$SWITCH",
+			Params: []model.Param{
+				{Name: "expression", Type: model.TypeAny},
+				{Name: "value", Type: model.TypeAny, Lazy: true},
+				{Name: "result", Type: model.TypeAny, Lazy: true},
+				{Name: "valuesAndResults", Type: model.TypeAny, Optional: true, Variadic: true, Lazy: true},
+			},
+			Returns:     model.TypeAny,
+			Description: "The result of the first value equal to the expression, or the last argument (default) if it's not paired, an error if nothing matches",
+			Examples:    []string{"$SWITCH(grade, 'A', 1.0, 'B', 0.8, 0.5)"},
+		},
+		fSwitch,
+	},
+	{
+		model.FunctionSignature{
+			Name:        "$AND",
+			Params:      []model.Param{{Name: "conditions", Type: model.TypeBoolean, Variadic: true, Lazy: true}},
+			Returns:     model.TypeBoolean,
+			Description: "True if all conditions are true, conditions after the first false one are not evaluated",
+			Examples:    []string{"$AND(age >= 20, age < 60)"},
+		},
+		fAnd,
+	},
+	{
+		model.FunctionSignature{
+			Name:        "$OR",
+			Params:      []model.Param{{Name: "conditions", Type: model.TypeBoolean, Variadic: true, Lazy: true}},
+			Returns:     model.TypeBoolean,
+			Description: "True if any condition is true, conditions after the first true one are not evaluated",
+			Examples:    []string{"$OR(age < 20, age >= 60)"},
+		},
+		fOr,
+	},
+	{
+		model.FunctionSignature{
+			Name: "$IFERROR",
+			Params: []model.Param{
+				{Name: "value", Type: model.TypeAny, Lazy: true},
+				{Name: "valueIfError", Type: model.TypeAny, Lazy: true},
+			},
+			Returns:     model.TypeAny,
+			Description: "The value, or valueIfError if evaluating the value fails (or results in NaN or Infinity)",
+			Examples:    []string{"$IFERROR(total / count, 0)"},
+		},
+		fIfError,
+	},
+	{
+		model.FunctionSignature{
+			Name:        "$COALESCE",
+			Params:      []model.Param{{Name: "values", Type: model.TypeAny, Variadic: true, Lazy: true}},
+			Returns:     model.TypeAny,
+			Description: "The first value which is neither null nor undefined, values after it are not evaluated",
+			Examples:    []string{"$COALESCE(discount, defaultDiscount, 0)"},
+		},
+		fCoalesce,
+	},
+	{
+		model.FunctionSignature{
+			Name:        "$SUMI",
+			Params:      []model.Param{{Name: "values", Type: model.TypeInteger, Optional: true, Variadic: true}},
+			Returns:     model.TypeInteger,
+			Description: "Sum of whole numbers (or arrays of them)",
+			Examples:    []string{"$SUMI(1, 2, 3)", "$SUMI([1, 2], 3)"},
+		},
+		fSumi,
+	},
+	{
+		model.FunctionSignature{
+			Name:        "$SUMF",
+			Params:      []model.Param{{Name: "values", Type: model.TypeNumber, Optional: true, Variadic: true}},
+			Returns:     model.TypeNumber,
+			Description: "Sum of numbers (or arrays of numbers)",
+			Examples:    []string{"$SUMF(1.5, 2.25)", "$SUMF(items.map(function(i) { return i.price }))"},
+		},
+		fSumf,
+	},
+	{
+		model.FunctionSignature{
+			Name:        "$AVG",
+			Params:      []model.Param{{Name: "values", Type: model.TypeNumber, Variadic: true}},
+			Returns:     model.TypeNumber,
+			Description: "Average of numbers (or arrays of numbers)",
+			Examples:    []string{"$AVG(1, 2, 3)", "$AVG([1, 2], 3)"},
+		},
+		fAvg,
+	},
+	{
+		model.FunctionSignature{
+			Name:        "$MIN",
+			Params:      []model.Param{{Name: "values", Type: model.TypeNumber, Variadic: true}},
+			Returns:     model.TypeNumber,
+			Description: "The smallest of numbers (or arrays of numbers)",
+			Examples:    []string{"$MIN(3, 1, 2)", "$MIN([3, 1], 2)"},
+		},
+		fMin,
+	},
+	{
+		model.FunctionSignature{
+			Name:        "$MAX",
+			Params:      []model.Param{{Name: "values", Type: model.TypeNumber, Variadic: true}},
+			Returns:     model.TypeNumber,
+			Description: "The largest of numbers (or arrays of numbers)",
+			Examples:    []string{"$MAX(3, 1, 2)", "$MAX([3, 1], 2)"},
+		},
+		fMax,
+	},
+	{
+		model.FunctionSignature{
+			Name:        "$DADD",
+			Params:      []model.Param{{Name: "values", Type: model.TypeDecimal, Variadic: true}},
+			Returns:     model.TypeDecimal,
+			Description: "Exact sum of decimals (numbers or decimal strings) as a decimal string",
+			Examples:    []string{"$DADD(0.1, 0.2)", "$DADD('1000.50', '0.25')"},
+		},
+		fDAdd,
+	},
+	{
+		model.FunctionSignature{
+			Name:        "$DSUB",
+			Params:      []model.Param{{Name: "minuend", Type: model.TypeDecimal}, {Name: "subtrahend", Type: model.TypeDecimal}},
+			Returns:     model.TypeDecimal,
+			Description: "Exact difference of two decimals as a decimal string",
+			Examples:    []string{"$DSUB('1.00', 0.99)"},
+		},
+		fDSub,
+	},
+	{
+		model.FunctionSignature{
+			Name:        "$DMUL",
+			Params:      []model.Param{{Name: "values", Type: model.TypeDecimal, Variadic: true}},
+			Returns:     model.TypeDecimal,
+			Description: "Exact product of decimals as a decimal string",
+			Examples:    []string{"$DMUL('19.99', 3)"},
+		},
+		fDMul,
+	},
+	{
+		model.FunctionSignature{
+			Name: "$DDIV",
+			Params: []model.Param{
+				{Name: "dividend", Type: model.TypeDecimal},
+				{Name: "divisor", Type: model.TypeDecimal},
+				{Name: "scale", Type: model.TypeInteger, Optional: true},
+				{Name: "mode", Type: model.TypeString, Optional: true},
+			},
+			Returns:     model.TypeDecimal,
+			Description: "Quotient of two decimals as a decimal string rounded to the given scale (by the given rounding mode, the Formula's default if omitted), an inexact quotient is rounded (half-even) to 16 places if scale is omitted",
+			Examples:    []string{"$DDIV(100, 3, 2)", "$DDIV('1', '8')", "$DDIV(10, 4, 0, 'half-even')"},
+		},
+		fDDiv,
+	},
+	{
+		model.FunctionSignature{
+			Name: "$DRND",
+			Params: []model.Param{
+				{Name: "value", Type: model.TypeDecimal},
+				{Name: "scale", Type: model.TypeInteger},
+				{Name: "mode", Type: model.TypeString, Optional: true},
+			},
+			Returns:     model.TypeDecimal,
+			Description: "Rounding a decimal to the given scale (decimal places, negative for tens, hundreds, ...) by the given rounding mode (the Formula's default if omitted) as a decimal string having exactly scale decimal places",
+			Examples:    []string{"$DRND('2.675', 2)", "$DRND('2.5', 0, 'half-even')", "$DRND(1250, -2)"},
+		},
+		fDRnd,
+	},
+}
+
+//allBuiltIns every function of DefaultBuiltInFunctions
+var allBuiltIns = joinBuiltIns(defaultBuiltIns, statisticalBuiltIns, stringBuiltIns, dateBuiltIns, financialBuiltIns, lookupBuiltIns, parameterBuiltIns, conversionBuiltIns, randomBuiltIns)
+
+//defaultBuiltInIndex allBuiltIns by names and aliases
+var defaultBuiltInIndex = indexBuiltIns(allBuiltIns)
+
+func joinBuiltIns(tables ...[]builtInFunction) []builtInFunction {
+
+	var funcs []builtInFunction
+	for _, table := range tables {
+		funcs = append(funcs, table...)
+	}
+
+	return funcs
+}
+
+func indexBuiltIns(funcs []builtInFunction) map[string]builtInFunction {
+
+	index := make(map[string]builtInFunction)
+
+	for _, f := range funcs {
+		index[f.signature.Name] = f
+		for _, alias := range f.signature.Aliases {
+			index[alias] = f
+		}
+	}
+
+	return index
+}
+
+//FunctionNames getting names (including aliases) of all built-in functions
+func (fs DefaultBuiltInFunctions) FunctionNames() []string {
+
+	names := make([]string, 0, len(defaultBuiltInIndex))
+	for funcName := range defaultBuiltInIndex {
+		names = append(names, funcName)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+//List getting signatures of all built-in functions
+func (fs DefaultBuiltInFunctions) List() []model.FunctionSignature {
+
+	signatures := make([]model.FunctionSignature, len(allBuiltIns))
+	for i, f := range allBuiltIns {
+		signatures[i] = f.signature
+	}
+
+	return signatures
+}
+
+//Describe getting signature of the given function (or alias)
+func (fs DefaultBuiltInFunctions) Describe(funcName string) (model.FunctionSignature, bool) {
 
+	f, found := defaultBuiltInIndex[funcName]
+
+	return f.signature, found
+}
+
+//Arity getting min and max number of arguments accepted by the given
+//function, max is -1 for variadic functions, found is false if unknown
+func (fs DefaultBuiltInFunctions) Arity(funcName string) (min int, max int, found bool) {
+
+	f, found := defaultBuiltInIndex[funcName]
+	if !found {
+		return 0, 0, false
 	}
 
+	min, max = f.signature.Arity()
+
+	return min, max, true
+}
+
+//Has to check if the given function name is supported
+//by the current BuiltInFunctions
+func (fs DefaultBuiltInFunctions) Has(funcName string) bool {
+
+	_, found := defaultBuiltInIndex[funcName]
+
+	return found
 }
 
 //Execute to execute a built-in function as per the given function name
 func (fs DefaultBuiltInFunctions) Execute(funcName string, vm VM, funcDef interface{}) (interface{}, bool) {
 
-	switch funcName {
-
-	case "$ABS":
-		return fAbs(vm, funcDef), true
-	case "$RND":
-		return fRnd(vm, funcDef), true
-	case "$FLOOR", "$FLR":
-		return fFloor(vm, funcDef), true
-	case "$CEIL":
-		return fCeil(vm, funcDef), true
-	case "$IF":
-		return fIf(vm, funcDef), true
-	case "$SUMI":
-		return fSumi(vm, funcDef), true
-	case "$SUMF":
-		return fSumf(vm, funcDef), true
-	case "$AVG":
-		return fAvg(vm, funcDef), true
-	case "$MIN":
-		return fMin(vm, funcDef), true
-	case "$MAX":
-		return fMax(vm, funcDef), true
-	default:
+	f, found := defaultBuiltInIndex[funcName]
+	if !found {
 		return nil, false
-
 	}
 
+	validateArity(funcName, f.signature, vm, funcDef)
+
+	return f.execute(fs, vm, funcDef), true
 }
 
-func fAbs(vm VM, funcDef interface{}) interface{} {
+//validateArity panicking with *model.FormulaError if number of arguments
+//doesn't match the given signature
+func validateArity(funcName string, signature model.FunctionSignature, vm VM, funcDef interface{}) {
+
+	min, max := signature.Arity()
+	cnt := vm.GetFuncArgsCount(funcDef)
+
+	if cnt >= min && (max < 0 || cnt <= max) {
+		return
+	}
+
+	var expecting string
 
-	vm.ValidateFuncArguments("$ABS", 1, funcDef)
+	switch {
+	case max < 0:
+		expecting = fmt.Sprintf("at least %d", min)
+	case min == max:
+		expecting = fmt.Sprintf("%d", min)
+	default:
+		expecting = fmt.Sprintf("%d to %d", min, max)
+	}
+
+	errMsg := fmt.Sprintf("wrong number of arguments (expecting %s)", expecting)
+	panic(model.NewFormulaError(funcName, -1, model.ErrorKindArity, errMsg))
+}
+
+func fAbs(fs DefaultBuiltInFunctions, vm VM, funcDef interface{}) interface{} {
 
 	v := vm.GetFuncArgAsFloat(funcDef, 0)
 	result := math.Abs(v)
@@ -92,60 +440,65 @@ func fAbs(vm VM, funcDef interface{}) interface{} {
 	return vm.ToVMValue(result)
 }
 
-func fRnd(vm VM, funcDef interface{}) interface{} {
-
-	vm.ValidateFuncArguments("$RND", 2, funcDef)
+func fRnd(fs DefaultBuiltInFunctions, vm VM, funcDef interface{}) interface{} {
 
 	v := vm.GetFuncArgAsFloat(funcDef, 0)
-	p := vm.GetFuncArgAsInt(funcDef, 1)
-	if 0 > p || p > 10 {
-		panic(errors.New("$RND - second parameter should be between 0 and 10"))
-	}
-
-	result := v
-	f := math.Pow10(int(p))
-	result = math.Round(v*f) / f
+	p := getPrecision("$RND", vm, funcDef, 1)
+	mode := fs.getRoundingMode("$RND", vm, funcDef, 2)
 
-	return vm.ToVMValue(result)
+	return vm.ToVMValue(model.RoundFloat(v, p, mode))
 }
 
-func fFloor(vm VM, funcDef interface{}) interface{} {
+func fFloor(fs DefaultBuiltInFunctions, vm VM, funcDef interface{}) interface{} {
+
+	v := vm.GetFuncArgAsFloat(funcDef, 0)
+	p := getPrecision("$FLOOR", vm, funcDef, 1)
+
+	return vm.ToVMValue(model.RoundFloat(v, p, model.RoundFloor))
+}
 
-	vm.ValidateFuncArguments("$FLOOR", 2, funcDef)
+func fCeil(fs DefaultBuiltInFunctions, vm VM, funcDef interface{}) interface{} {
 
 	v := vm.GetFuncArgAsFloat(funcDef, 0)
-	p := vm.GetFuncArgAsInt(funcDef, 1)
-	if 0 > p || p > 10 {
-		panic(errors.New("$RND - second parameter should be between 0 and 10"))
-	}
+	p := getPrecision("$CEIL", vm, funcDef, 1)
 
-	result := v
-	f := math.Pow10(int(p))
-	result = math.Floor(v*f) / f
+	return vm.ToVMValue(model.RoundFloat(v, p, model.RoundCeiling))
+}
 
-	return vm.ToVMValue(result)
+//getPrecision getting the argument at the given index as a number
+//of decimal places (-10 to 10) for rounding a float
+func getPrecision(funcName string, vm VM, funcDef interface{}, index int) int {
+
+	p := vm.GetFuncArgAsInt(funcDef, index)
+	if -10 > p || p > 10 {
+		panic(model.NewFormulaError(funcName, index, model.ErrorKindRange, "precision should be between -10 and 10"))
+	}
+
+	return int(p)
 }
 
-func fCeil(vm VM, funcDef interface{}) interface{} {
+func fMRound(fs DefaultBuiltInFunctions, vm VM, funcDef interface{}) interface{} {
 
-	vm.ValidateFuncArguments("$CEIL", 2, funcDef)
+	value := vm.GetFuncArgAsDecimal(funcDef, 0)
+	multiple := vm.GetFuncArgAsDecimal(funcDef, 1)
+	mode := fs.getRoundingMode("$MROUND", vm, funcDef, 2)
 
-	v := vm.GetFuncArgAsFloat(funcDef, 0)
-	p := vm.GetFuncArgAsInt(funcDef, 1)
-	if 0 > p || p > 10 {
-		panic(errors.New("$RND - second parameter should be between 0 and 10"))
+	if multiple.Sign() == 0 {
+		return vm.ToVMValue(0)
 	}
 
-	result := v
-	f := math.Pow10(int(p))
-	result = math.Ceil(v*f) / f
+	if value.Sign()*multiple.Sign() < 0 {
+		panic(model.NewFormulaError("$MROUND", 1, model.ErrorKindRange, "value and multiple must have the same sign"))
+	}
 
-	return vm.ToVMValue(result)
-}
+	result := new(big.Rat).Quo(value, multiple)
+	result = model.RoundDecimal(result, 0, mode)
+	f, _ := result.Mul(result, multiple).Float64()
 
-func fIf(vm VM, funcDef interface{}) interface{} {
+	return vm.ToVMValue(f)
+}
 
-	vm.ValidateFuncArguments("$IF", 3, funcDef)
+func fIf(fs DefaultBuiltInFunctions, vm VM, funcDef interface{}) interface{} {
 
 	b := vm.GetFuncArgAsBoolean(funcDef, 0)
 	var jsResult interface{}
@@ -159,49 +512,155 @@ func fIf(vm VM, funcDef interface{}) interface{} {
 	return jsResult
 }
 
-func fSumi(vm VM, funcDef interface{}) interface{} {
+func fIfs(fs DefaultBuiltInFunctions, vm VM, funcDef interface{}) interface{} {
 
-	var result int64
-	result = 0
+	cnt := vm.GetFuncArgsCount(funcDef)
+	if cnt%2 != 0 {
+		panic(model.NewFormulaError("$IFS", -1, model.ErrorKindArity, "expecting pairs of condition and value"))
+	}
+
+	for i := 0; i < cnt; i += 2 {
+		if vm.GetFuncArgAsBoolean(funcDef, i) {
+			return vm.GetFuncArgAsIs(funcDef, i+1)
+		}
+	}
+
+	panic(model.NewFormulaError("$IFS", -1, model.ErrorKindRuntime, "no condition is true"))
+}
+
+func fSwitch(fs DefaultBuiltInFunctions, vm VM, funcDef interface{}) interface{} {
+
+	expression := vm.GetFuncArgAsIs(funcDef, 0)
+	cnt := vm.GetFuncArgsCount(funcDef)
+
+	i := 1
+	for ; i+1 < cnt; i += 2 {
+		if equalVMValues(vm, expression, vm.GetFuncArgAsIs(funcDef, i)) {
+			return vm.GetFuncArgAsIs(funcDef, i+1)
+		}
+	}
+
+	//Default
+	if i < cnt {
+		return vm.GetFuncArgAsIs(funcDef, i)
+	}
+
+	panic(model.NewFormulaError("$SWITCH", 0, model.ErrorKindRuntime, "no value matched"))
+}
+
+//equalVMValues comparing primitive values (like ===, except NaN),
+//objects are never equal
+func equalVMValues(vm VM, a interface{}, b interface{}) bool {
+
+	switch {
+	case vm.IsNumber(a) && vm.IsNumber(b):
+		x, _ := vm.ToFloat(a)
+		y, _ := vm.ToFloat(b)
+		return x == y
+	case vm.IsString(a) && vm.IsString(b):
+		x, _ := vm.ToString(a)
+		y, _ := vm.ToString(b)
+		return x == y
+	case vm.IsBoolean(a) && vm.IsBoolean(b):
+		x, _ := vm.ToBoolean(a)
+		y, _ := vm.ToBoolean(b)
+		return x == y
+	case vm.IsNull(a) && vm.IsNull(b), vm.IsUndefined(a) && vm.IsUndefined(b):
+		return true
+	}
+
+	return false
+}
+
+func fAnd(fs DefaultBuiltInFunctions, vm VM, funcDef interface{}) interface{} {
 
 	for i := 0; i < vm.GetFuncArgsCount(funcDef); i++ {
+		if !vm.GetFuncArgAsBoolean(funcDef, i) {
+			return vm.ToVMValue(false)
+		}
+	}
+
+	return vm.ToVMValue(true)
+}
 
-		v := vm.GetFuncArgAsInt(funcDef, i)
-		result = result + v
+func fOr(fs DefaultBuiltInFunctions, vm VM, funcDef interface{}) interface{} {
 
+	for i := 0; i < vm.GetFuncArgsCount(funcDef); i++ {
+		if vm.GetFuncArgAsBoolean(funcDef, i) {
+			return vm.ToVMValue(true)
+		}
 	}
 
-	return vm.ToVMValue(result)
+	return vm.ToVMValue(false)
 }
 
-func fSumf(vm VM, funcDef interface{}) interface{} {
+func fIfError(fs DefaultBuiltInFunctions, vm VM, funcDef interface{}) interface{} {
 
-	var result float64
-	result = 0.0
+	value, err := vm.EvaluateFuncArg(funcDef, 0)
+	if err == nil && !isNaNOrInf(vm, value) {
+		return value
+	}
+
+	return vm.GetFuncArgAsIs(funcDef, 1)
+}
+
+func isNaNOrInf(vm VM, value interface{}) bool {
+
+	if !vm.IsNumber(value) {
+		return false
+	}
+
+	f, _ := vm.ToFloat(value)
+
+	return math.IsNaN(f) || math.IsInf(f, 0)
+}
+
+func fCoalesce(fs DefaultBuiltInFunctions, vm VM, funcDef interface{}) interface{} {
+
+	var value interface{}
 
 	for i := 0; i < vm.GetFuncArgsCount(funcDef); i++ {
+		value = vm.GetFuncArgAsIs(funcDef, i)
+		if !vm.IsNull(value) && !vm.IsUndefined(value) {
+			return value
+		}
+	}
 
-		v := vm.GetFuncArgAsFloat(funcDef, i)
-		result = result + v
+	return value
+}
+
+func fSumi(fs DefaultBuiltInFunctions, vm VM, funcDef interface{}) interface{} {
+
+	var result int64
 
+	for _, v := range getFloats(vm, funcDef, 0) {
+		result += int64(v)
 	}
 
 	return vm.ToVMValue(result)
 }
 
-func fAvg(vm VM, funcDef interface{}) interface{} {
+func fSumf(fs DefaultBuiltInFunctions, vm VM, funcDef interface{}) interface{} {
 
-	result := big.NewFloat(0.0)
-	var i int
+	var result float64
 
-	for i = 0; i < vm.GetFuncArgsCount(funcDef); i++ {
+	for _, v := range getFloats(vm, funcDef, 0) {
+		result += v
+	}
+
+	return vm.ToVMValue(result)
+}
+
+func fAvg(fs DefaultBuiltInFunctions, vm VM, funcDef interface{}) interface{} {
 
-		v := vm.GetFuncArgAsFloat(funcDef, i)
-		bigV := big.NewFloat(v)
-		result.Add(result, bigV)
+	values := getNonEmptyFloats("$AVG", vm, funcDef, 0)
+	result := big.NewFloat(0.0)
+
+	for _, v := range values {
+		result.Add(result, big.NewFloat(v))
 	}
 
-	result.Quo(result, big.NewFloat(float64(i)))
+	result.Quo(result, big.NewFloat(float64(len(values))))
 	f, err := strconv.ParseFloat(result.String(), 10)
 	if err != nil {
 		panic(err)
@@ -210,68 +669,116 @@ func fAvg(vm VM, funcDef interface{}) interface{} {
 	return vm.ToVMValue(f)
 }
 
-func fMin(vm VM, funcDef interface{}) interface{} {
+func fMin(fs DefaultBuiltInFunctions, vm VM, funcDef interface{}) interface{} {
 
-	hasLast := false
-	var last interface{} = nil
+	values := getNonEmptyFloats("$MIN", vm, funcDef, 0)
+	result := values[0]
 
-	for i := 0; i < vm.GetFuncArgsCount(funcDef); i++ {
+	for _, v := range values[1:] {
+		result = math.Min(result, v)
+	}
 
-		v := vm.GetFuncArgAsIs(funcDef, i)
-
-		if !hasLast {
-			last = v
-			hasLast = true
-		} else {
-			l, el := vm.ToFloat(last)
-			r, er := vm.ToFloat(v)
-
-			if el != nil {
-				panic(el)
-			}
-			if er != nil {
-				panic(er)
-			}
-
-			if l > r {
-				last = v
-			}
-		}
+	return vm.ToVMValue(result)
+}
+
+func fMax(fs DefaultBuiltInFunctions, vm VM, funcDef interface{}) interface{} {
 
+	values := getNonEmptyFloats("$MAX", vm, funcDef, 0)
+	result := values[0]
+
+	for _, v := range values[1:] {
+		result = math.Max(result, v)
 	}
 
-	return last
+	return vm.ToVMValue(result)
 }
 
-func fMax(vm VM, funcDef interface{}) interface{} {
+func fDAdd(fs DefaultBuiltInFunctions, vm VM, funcDef interface{}) interface{} {
 
-	hasLast := false
-	var last interface{} = nil
+	result := new(big.Rat)
 
 	for i := 0; i < vm.GetFuncArgsCount(funcDef); i++ {
+		result.Add(result, vm.GetFuncArgAsDecimal(funcDef, i))
+	}
 
-		v := vm.GetFuncArgAsIs(funcDef, i)
-
-		if !hasLast {
-			last = v
-			hasLast = true
-		} else {
-			l, el := vm.ToFloat(last)
-			r, er := vm.ToFloat(v)
-
-			if el != nil {
-				panic(el)
-			}
-			if er != nil {
-				panic(er)
-			}
-
-			if l < r {
-				last = v
-			}
-		}
+	return vm.ToVMValue(result)
+}
 
+func fDSub(fs DefaultBuiltInFunctions, vm VM, funcDef interface{}) interface{} {
+
+	result := new(big.Rat).Sub(vm.GetFuncArgAsDecimal(funcDef, 0), vm.GetFuncArgAsDecimal(funcDef, 1))
+
+	return vm.ToVMValue(result)
+}
+
+func fDMul(fs DefaultBuiltInFunctions, vm VM, funcDef interface{}) interface{} {
+
+	result := big.NewRat(1, 1)
+
+	for i := 0; i < vm.GetFuncArgsCount(funcDef); i++ {
+		result.Mul(result, vm.GetFuncArgAsDecimal(funcDef, i))
+	}
+
+	return vm.ToVMValue(result)
+}
+
+func fDDiv(fs DefaultBuiltInFunctions, vm VM, funcDef interface{}) interface{} {
+
+	dividend := vm.GetFuncArgAsDecimal(funcDef, 0)
+	divisor := vm.GetFuncArgAsDecimal(funcDef, 1)
+	if divisor.Sign() == 0 {
+		panic(model.NewFormulaError("$DDIV", 1, model.ErrorKindRange, "division by zero"))
+	}
+
+	result := new(big.Rat).Quo(dividend, divisor)
+
+	if vm.GetFuncArgsCount(funcDef) < 3 {
+		return vm.ToVMValue(result)
+	}
+
+	scale := getDecimalScale("$DDIV", vm, funcDef, 2)
+	mode := fs.getRoundingMode("$DDIV", vm, funcDef, 3)
+
+	return vm.ToVMValue(model.FormatDecimalScale(result, scale, mode))
+}
+
+func fDRnd(fs DefaultBuiltInFunctions, vm VM, funcDef interface{}) interface{} {
+
+	value := vm.GetFuncArgAsDecimal(funcDef, 0)
+	scale := getDecimalScale("$DRND", vm, funcDef, 1)
+	mode := fs.getRoundingMode("$DRND", vm, funcDef, 2)
+
+	return vm.ToVMValue(model.FormatDecimalScale(value, scale, mode))
+}
+
+//maxDecimalScale the largest scale (either way) accepted by decimal functions
+const maxDecimalScale = 100
+
+func getDecimalScale(funcName string, vm VM, funcDef interface{}, index int) int {
+
+	scale := vm.GetFuncArgAsInt(funcDef, index)
+	if scale < -maxDecimalScale || scale > maxDecimalScale {
+		errMsg := fmt.Sprintf("scale should be between %d and %d", -maxDecimalScale, maxDecimalScale)
+		panic(model.NewFormulaError(funcName, index, model.ErrorKindRange, errMsg))
+	}
+
+	return int(scale)
+}
+
+//getRoundingMode getting the (optional) argument at the given index as
+//model.RoundingMode, the default rounding mode if it's omitted
+func (fs DefaultBuiltInFunctions) getRoundingMode(funcName string, vm VM, funcDef interface{}, index int) model.RoundingMode {
+
+	if index >= vm.GetFuncArgsCount(funcDef) {
+		return fs.rounding
+	}
+
+	mode, err := model.ParseRoundingMode(vm.GetFuncArgAsString(funcDef, index))
+	if err != nil {
+		formulaErr := model.NewFormulaError(funcName, index, model.ErrorKindRange, err.Error())
+		formulaErr.Err = err
+		panic(formulaErr)
 	}
 
-	return last
+	return mode
 }
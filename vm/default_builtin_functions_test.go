@@ -0,0 +1,225 @@
+package vm_test
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/lertrel/goforit/builder"
+	"github.com/lertrel/goforit/model"
+)
+
+func TestLazyFunctions(t *testing.T) {
+
+	f := builder.NewFormulaBuilder().Get()
+	f.RegisterCustomFunction(
+		"$EXPENSIVE",
+		`
+		function $EXPENSIVE() {
+			calls++;
+			return 1;
+		}
+		`)
+
+	tests := []struct {
+		script   string
+		expected string
+		calls    int
+	}{
+		{"$IF(x != 0, 100 / x, $EXPENSIVE())", "50", 0},
+		{"$IF(x == 0, 100 / x, $EXPENSIVE())", "1", 1},
+		{"$IF(\n  x == 2,\n  $IF(false, $EXPENSIVE(), 'inner'),\n  $EXPENSIVE()\n)", "inner", 0},
+		{"$IFS(x > 5, 'high', x > 1, 'mid', $EXPENSIVE() == 1, 'low')", "mid", 0},
+		{"$SWITCH(x, 1, 'one', 2, 'two', $EXPENSIVE())", "two", 0},
+		{"$SWITCH(x, 1, 'one', 'other')", "other", 0},
+		{"$AND(x > 5, $EXPENSIVE())", "false", 0},
+		{"$OR(x == 2, $EXPENSIVE())", "true", 0},
+		{"$OR(x == 3, $EXPENSIVE() == 1)", "true", 1},
+		{"$IFERROR(missing.value, 'fallback')", "fallback", 0},
+		{"$IFERROR(1 / (x - 2), 0)", "0", 0},
+		{"$IFERROR($RND(1.5, 11), -1)", "-1", 0},
+		{"$IFERROR(x * 2, $EXPENSIVE())", "4", 0},
+		{"$COALESCE(null, undefined, x, $EXPENSIVE())", "2", 0},
+		{"$IF(/* cond */ x == 2, /* then */ 'two', /* else */ $EXPENSIVE())", "two", 0},
+		{"function g() { return $IF(true, arguments[0], 0) }; g(42)", "42", 0},
+		{"var o = {v: 7, m: function() { return $IF(true, this.v, 0) }}; o.m()", "7", 0},
+		{"var o = {v: 7, m: function() { return $IF(x, $COALESCE(null, this.v + arguments[0]), 0) }}; o.m(1)", "8", 0},
+	}
+
+	for _, test := range tests {
+
+		c := newContext(t, f)
+		c.Set("x", 2)
+		c.Set("calls", 0)
+
+		s, err := run(context.Background(), c, test.script)
+		if err != nil {
+			t.Errorf("%s - %v\n", test.script, err)
+			continue
+		}
+
+		if s != test.expected {
+			t.Errorf("%s - expect %v but got %v\n", test.script, test.expected, s)
+		}
+
+		if calls, _ := run(context.Background(), c, "calls"); calls != fmt.Sprint(test.calls) {
+			t.Errorf("%s - expect %v calls but got %v\n", test.script, test.calls, calls)
+		}
+	}
+
+	//Errors in lazy arguments are propagated, and can be caught by JS
+	c := newContext(t, f)
+
+	s, err := run(context.Background(), c, "try { $IF(true, missing.value, 0) } catch (e) { e.name }")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s != "ReferenceError" {
+		t.Errorf("Expect %v but got %v\n", "ReferenceError", s)
+	}
+
+	//Errors of built-in functions aren't JS exceptions, so they abort
+	//the run even within try/catch, but not within $IFERROR
+	formulaErr := formulaErrorOf(c, "try { $RND(1.5, 11) } catch (e) { 'caught' }")
+	if formulaErr == nil || formulaErr.Function != "$RND" || formulaErr.Kind != model.ErrorKindRange {
+		t.Errorf("Unexpected %v\n", formulaErr)
+	}
+
+	if s, err = run(context.Background(), c, "try { $IFERROR($RND(1.5, 11), 'fallback') } catch (e) { 'caught' }"); err != nil || s != "fallback" {
+		t.Errorf("Expect %v but got %v (%v)\n", "fallback", s, err)
+	}
+
+	formulaErr = formulaErrorOf(c, "$IFS(false, 1)")
+	if formulaErr == nil || formulaErr.Function != "$IFS" || formulaErr.Kind != model.ErrorKindRuntime {
+		t.Errorf("Unexpected %v\n", formulaErr)
+	}
+
+	//Errors are reported at positions of the formula as written
+	c.Set("y", 1)
+	formulaErr = formulaErrorOf(c, "$IF(true, y, 0) +\n  $IF(true, $RND(1.5, 11), 0)")
+	if formulaErr == nil || formulaErr.Function != "$RND" || formulaErr.Line != 2 || formulaErr.Column != 13 {
+		t.Errorf("Expect an error of $RND at 2:13 but got %v\n", formulaErr)
+	}
+
+	//Compiled formulas are lazy too
+	cf, err := f.Compile("$IF(x != 0, 100 / x, $EXPENSIVE())")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Set("x", 4)
+	c.Set("calls", 0)
+
+	v, err := c.RunCompiled(cf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if i, _ := v.ToInteger(); i != 25 {
+		t.Errorf("Expect %v but got %v\n", 25, i)
+	}
+	if calls, _ := run(context.Background(), c, "calls"); calls != "0" {
+		t.Errorf("Expect %v calls but got %v\n", 0, calls)
+	}
+}
+
+func TestDecimalFunctions(t *testing.T) {
+
+	f := builder.NewFormulaBuilder().
+		RegisterGoFunc("$VAT", func(amount *big.Rat) *big.Rat {
+			return new(big.Rat).Mul(amount, big.NewRat(7, 100))
+		}).
+		Get()
+
+	runScriptTests(t, f, []scriptTest{
+		{"$DADD(0.1, 0.2)", "0.3"},
+		{"typeof $DADD(0.1, 0.2)", "string"},
+		{"$DADD('1000.50', '0.25', 1)", "1001.75"},
+		{"$DSUB('1.00', 0.99)", "0.01"},
+		{"$DMUL('19.99', 3)", "59.97"},
+		{"$DDIV(100, 3, 2)", "33.33"},
+		{"$DDIV('1', '8')", "0.125"},
+		{"$DDIV(2, 3)", "0.6666666666666667"},
+		{"$DDIV(10, 4, 0, 'half-even')", "2"},
+		{"$DRND('2.675', 2)", "2.68"},
+		{"$DRND('1.2', 2)", "1.20"},
+		{"$DRND('2.5', 0, 'half-even')", "2"},
+		{"$DRND('-2.5', 0, 'HALF_DOWN')", "-2"},
+		{"$DRND('-2.1', 0, 'floor')", "-3"},
+		{"$DRND(1250, -2)", "1300"},
+		{"$DRND($DMUL('1234.5678', '0.035'), 2, 'down')", "43.20"},
+		{"$DADD('1e-3', '-.5')", "-0.499"},
+		{"$VAT('100.10')", "7.007"},
+	})
+
+	runErrorTests(t, f, []errorTest{
+		{"$DDIV(1, 0)", model.ErrorKindRange},
+		{"$DRND(1, 2, 'nearest')", model.ErrorKindRange},
+		{"$DADD(1, 'abc')", model.ErrorKindType},
+		{"$DADD(1, '1/3')", model.ErrorKindType},
+		{"$DADD(1, '0x10')", model.ErrorKindType},
+	})
+
+	//Decimals travel between Go and JS as decimal strings
+	c := newContext(t, f)
+	c.Set("total", big.NewRat(1001, 10))
+
+	c.Prepare("$DADD(total, 0.01)")
+	v, err := c.Run("$DADD(total, 0.01)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := v.ToDecimal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Cmp(big.NewRat(10011, 100)) != 0 {
+		t.Errorf("Expect %v but got %v\n", "100.11", d.FloatString(2))
+	}
+}
+
+func TestRoundingModes(t *testing.T) {
+
+	runScriptTests(t, builder.NewFormulaBuilder().Get(), []scriptTest{
+		{"$RND(2.5, 0)", "3"},
+		{"$RND(-2.5, 0)", "-3"},
+		{"$RND(1.005, 2)", "1.01"},
+		{"$RND(2.5, 0, 'half-even')", "2"},
+		{"$RND(3.5, 0, 'half-even')", "4"},
+		{"$RND(2.675, 2, 'half-down')", "2.67"},
+		{"$RND(2.671, 2, 'up')", "2.68"},
+		{"$RND(1250, -2)", "1300"},
+		{"$RND(1250, -2, 'half-even')", "1200"},
+		{"$FLOOR(-1234.5, -2)", "-1300"},
+		{"$CEIL(1201, -2)", "1300"},
+		{"$MROUND(10.38, 0.25)", "10.5"},
+		{"$MROUND(10.37, 0.25)", "10.25"},
+		{"$MROUND(-7, -2)", "-8"},
+		{"$MROUND(1234, 50, 'floor')", "1200"},
+		{"$MROUND(5, 0)", "0"},
+	})
+
+	//Default rounding mode per Formula
+	f := builder.NewFormulaBuilder().SetRoundingMode(model.RoundHalfEven).Get()
+
+	runScriptTests(t, f, []scriptTest{
+		{"$RND(2.5, 0)", "2"},
+		{"$RND(2.5, 0, 'half-up')", "3"},
+		{"$MROUND(0.75, 0.5)", "1"},
+		{"$DRND('0.125', 2)", "0.12"},
+	})
+
+	c := newContext(t, f)
+
+	for _, script := range []string{"$FLOOR(1, 11)", "$CEIL(1, -11)", "$MROUND(5, -1)", "$RND(1, 0, 'nearest')"} {
+
+		formulaErr := formulaErrorOf(c, script)
+		if formulaErr == nil || formulaErr.Kind != model.ErrorKindRange {
+			t.Errorf("%s - unexpected %v\n", script, formulaErr)
+			continue
+		}
+		if name := script[:strings.Index(script, "(")]; formulaErr.Function != name {
+			t.Errorf("%s - expect %v but got %v\n", script, name, formulaErr.Function)
+		}
+	}
+}
@@ -1,14 +1,21 @@
 package vm
 
+import (
+	"sort"
+	"sync/atomic"
+)
+
 //DefaultCustomFunctionRepository default implementation CustomFunctionRepository
 type DefaultCustomFunctionRepository struct {
 	customFuncs map[string]string
+	//version increased by every registration (see FunctionVersioner)
+	version *uint64
 }
 
 //NewCustomFunctionRepo is a public function to obtain a deafult
 //implementation of CustomFunctionRepository
 func NewCustomFunctionRepo() CustomFunctionRepository {
-	return DefaultCustomFunctionRepository{customFuncs: make(map[string]string)}
+	return DefaultCustomFunctionRepository{customFuncs: make(map[string]string), version: new(uint64)}
 }
 
 //RegisterFunction for registering custom function
@@ -28,6 +35,10 @@ func (r DefaultCustomFunctionRepository) RegisterFunction(funcName string, body
 
 	r.customFuncs[funcName] = body
 
+	if r.version != nil {
+		atomic.AddUint64(r.version, 1)
+	}
+
 	return found
 }
 
@@ -43,3 +54,27 @@ func (r DefaultCustomFunctionRepository) GetFunctionBody(funcName string) string
 	//Falls through
 	return ""
 }
+
+//FunctionNames getting names of all registered custom functions
+func (r DefaultCustomFunctionRepository) FunctionNames() []string {
+
+	names := make([]string, 0, len(r.customFuncs))
+
+	for funcName := range r.customFuncs {
+		names = append(names, funcName)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+//FunctionsVersion getting a number increased every time a function is registered
+func (r DefaultCustomFunctionRepository) FunctionsVersion() uint64 {
+
+	if r.version == nil {
+		return 0
+	}
+
+	return atomic.LoadUint64(r.version)
+}
@@ -0,0 +1,391 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/robertkrimen/otto/ast"
+	"github.com/robertkrimen/otto/parser"
+)
+
+//FileFunctionRepository a CustomFunctionRepository of functions stored in
+//JavaScript (.js) files of a directory, so functions can be edited (e.g.,
+//on a shared volume) without redeploying the program
+//
+//A file provides every function it declares at the top level whose name
+//starts with $ (e.g., $CIRCLE.js declaring $CIRCLE, or tax.js declaring
+//$VAT and $WHT), and the whole file is the body of each of them, so helper
+//functions and variables of the file are loaded together
+//
+//Changes of the directory are picked up by Reload (or periodically by
+//Watch), all functions are swapped at once, and a file failing to be
+//parsed is reported while the last good version of its functions is kept
+//
+//*NOTE* a FormulaContext keeps functions it has already loaded, so changes
+//are seen by contexts created (or functions loaded) after the reload
+type FileFunctionRepository struct {
+	dir string
+	//reloading serializing reloads
+	reloading sync.Mutex
+	mutex     sync.RWMutex
+	//files the last seen version of every file by file name
+	files map[string]functionFile
+	//funcs bodies of functions by function name
+	funcs   map[string]string
+	errors  map[string]error
+	version uint64
+	stop    chan struct{}
+	once    sync.Once
+}
+
+//functionFile a function file as of its modification time
+type functionFile struct {
+	modTime time.Time
+	size    int64
+	//names functions of the last good version
+	names []string
+	//body the last good version
+	body string
+	//err the error of loading the current version
+	err error
+}
+
+//LoadFileFunctionRepository loading a FileFunctionRepository from .js files
+//of the given directory, nil and an error are returned if the directory
+//can't be read
+//
+//Files which can't be loaded are reported (as Reload does) by the returned
+//error together with the repository of the other files, and are picked up
+//by a later reload once they're fixed
+//
+//Ex.
+//
+//		repo, err := vm.LoadFileFunctionRepository("functions")
+//		if repo == nil {
+//			panic(err)
+//		}
+//		if err != nil {
+//			log.Printf("some functions are not loaded - %v", err)
+//		}
+//		defer repo.Close()
+//
+//		repo.Watch(5*time.Second, func(path string, err error) {
+//			log.Printf("%s is kept as it was - %v", path, err)
+//		})
+//
+//		formula := goforit.NewFormulaBuilder().
+//			AddCustomFunctionRepository(repo).
+//			Get()
+//
+func LoadFileFunctionRepository(dir string) (*FileFunctionRepository, error) {
+
+	r := &FileFunctionRepository{
+		dir:    dir,
+		files:  make(map[string]functionFile),
+		funcs:  make(map[string]string),
+		errors: make(map[string]error),
+		stop:   make(chan struct{}),
+	}
+
+	errs, err := r.reload()
+	if err != nil {
+		return nil, err
+	}
+
+	return r, joinFileErrors(errs)
+}
+
+//Reload reloading files of the directory changed (by modification time
+//or size) since the last reload, functions of deleted files are removed
+//
+//An error is returned if the directory can't be read, or if any changed
+//file can't be loaded, in which case the last good version of the file is
+//kept (see Errors)
+func (r *FileFunctionRepository) Reload() error {
+
+	errs, err := r.reload()
+	if err != nil {
+		return err
+	}
+
+	return joinFileErrors(errs)
+}
+
+//joinFileErrors joining errors of files (sorted) into an error,
+//nil if there's no error
+func joinFileErrors(errs map[string]error) error {
+
+	if len(errs) == 0 {
+		return nil
+	}
+
+	msgs := make([]string, 0, len(errs))
+
+	for _, err := range errs {
+		msgs = append(msgs, err.Error())
+	}
+
+	sort.Strings(msgs)
+
+	return errors.New(strings.Join(msgs, "; "))
+}
+
+//reload reloading changed files, errors which weren't reported by the
+//last reload are returned by file name
+func (r *FileFunctionRepository) reload() (map[string]error, error) {
+
+	r.reloading.Lock()
+	defer r.reloading.Unlock()
+
+	infos, err := ioutil.ReadDir(r.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mutex.RLock()
+	oldFiles := r.files
+	oldErrors := r.errors
+	r.mutex.RUnlock()
+
+	files := make(map[string]functionFile, len(infos))
+	changed := false
+
+	for _, info := range infos {
+
+		name := info.Name()
+		if info.IsDir() || strings.ToLower(filepath.Ext(name)) != ".js" {
+			continue
+		}
+
+		old, found := oldFiles[name]
+		if found && old.modTime.Equal(info.ModTime()) && old.size == info.Size() {
+			files[name] = old
+			continue
+		}
+
+		changed = true
+
+		file, err := loadFunctionFile(filepath.Join(r.dir, name))
+		if err != nil {
+			//Keeping the last good version
+			file = old
+			file.err = err
+		}
+
+		file.modTime, file.size = info.ModTime(), info.Size()
+		files[name] = file
+	}
+
+	for name := range oldFiles {
+		if _, found := files[name]; !found {
+			changed = true
+		}
+	}
+
+	if !changed {
+		return nil, nil
+	}
+
+	funcs, errs := r.functionsOf(files)
+
+	r.mutex.Lock()
+	r.files = files
+	r.funcs = funcs
+	r.errors = errs
+	r.version++
+	r.mutex.Unlock()
+
+	newErrs := make(map[string]error)
+
+	for name, err := range errs {
+		if old := oldErrors[name]; old == nil || old.Error() != err.Error() {
+			newErrs[name] = err
+		}
+	}
+
+	return newErrs, nil
+}
+
+//loadFunctionFile reading and parsing the given file
+func loadFunctionFile(path string) (functionFile, error) {
+
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		return functionFile{}, err
+	}
+
+	program, err := parser.ParseFile(nil, path, src, 0)
+	if err != nil {
+		return functionFile{}, err
+	}
+
+	file := functionFile{body: string(src)}
+
+	for _, declaration := range program.DeclarationList {
+
+		fn, ok := declaration.(*ast.FunctionDeclaration)
+		if ok && fn.Function.Name != nil && strings.HasPrefix(fn.Function.Name.Name, "$") {
+			file.names = append(file.names, fn.Function.Name.Name)
+		}
+	}
+
+	base := filepath.Base(path)
+	if funcName := strings.TrimSuffix(base, filepath.Ext(base)); strings.HasPrefix(funcName, "$") {
+		found := false
+		for _, name := range file.names {
+			found = found || name == funcName
+		}
+		if !found {
+			return functionFile{}, fmt.Errorf("%s - %s isn't declared", path, funcName)
+		}
+	}
+
+	if len(file.names) == 0 {
+		return functionFile{}, fmt.Errorf("%s - no function is declared", path)
+	}
+
+	return file, nil
+}
+
+//functionsOf mapping functions to bodies of the given files, a function
+//declared by more than one file is taken from the first file (by name),
+//errors of the files are returned by file name
+func (r *FileFunctionRepository) functionsOf(files map[string]functionFile) (map[string]string, map[string]error) {
+
+	funcs := make(map[string]string)
+	errs := make(map[string]error)
+	declaredBy := make(map[string]string)
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+
+		file := files[name]
+		if file.err != nil {
+			errs[name] = file.err
+		}
+
+		for _, funcName := range file.names {
+
+			if first, found := declaredBy[funcName]; found {
+				if errs[name] == nil {
+					errs[name] = fmt.Errorf("%s - %s is already declared by %s", filepath.Join(r.dir, name), funcName, first)
+				}
+				continue
+			}
+
+			declaredBy[funcName] = name
+			funcs[funcName] = file.body
+		}
+	}
+
+	return funcs, errs
+}
+
+//Watch reloading the directory every given interval until Close is
+//called, errors of a reload are given to onError (if not nil) by file,
+//a file failing to be loaded is reported once until it's changed again
+func (r *FileFunctionRepository) Watch(interval time.Duration, onError func(path string, err error)) {
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-r.stop:
+				return
+			case <-ticker.C:
+			}
+
+			errs, err := r.reload()
+			if onError == nil {
+				continue
+			}
+
+			if err != nil {
+				onError(r.dir, err)
+			}
+
+			for name, err := range errs {
+				onError(filepath.Join(r.dir, name), err)
+			}
+		}
+	}()
+}
+
+//Close stopping Watch
+func (r *FileFunctionRepository) Close() {
+
+	r.once.Do(func() {
+		close(r.stop)
+	})
+}
+
+//Errors getting errors of files which can't be loaded (by file name),
+//the last good version of each of them is being used
+func (r *FileFunctionRepository) Errors() map[string]error {
+
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	errs := make(map[string]error, len(r.errors))
+	for name, err := range r.errors {
+		errs[name] = err
+	}
+
+	return errs
+}
+
+//RegisterFunction is not supported, functions are maintained by files,
+//so false is always returned
+func (r *FileFunctionRepository) RegisterFunction(funcName string, body string) bool {
+
+	return false
+}
+
+//GetFunctionBody to get custom function source code
+func (r *FileFunctionRepository) GetFunctionBody(funcName string) string {
+
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return r.funcs[funcName]
+}
+
+//FunctionNames getting names of all functions of the files
+func (r *FileFunctionRepository) FunctionNames() []string {
+
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	names := make([]string, 0, len(r.funcs))
+
+	for funcName := range r.funcs {
+		names = append(names, funcName)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+//FunctionsVersion getting a number increased every time functions are reloaded
+func (r *FileFunctionRepository) FunctionsVersion() uint64 {
+
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return r.version
+}
@@ -0,0 +1,401 @@
+package vm
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/lertrel/goforit/model"
+)
+
+//financialBuiltIns financial functions of DefaultBuiltInFunctions having
+//the same semantics as Excel, i.e., money paid out is negative, money
+//received is positive, type 0 (default) is payment at the end of periods,
+//type 1 is payment at the beginning of periods
+var financialBuiltIns = []builtInFunction{
+	{
+		model.FunctionSignature{
+			Name: "$PMT",
+			Params: []model.Param{
+				{Name: "rate", Type: model.TypeNumber},
+				{Name: "nper", Type: model.TypeNumber},
+				{Name: "pv", Type: model.TypeNumber},
+				{Name: "fv", Type: model.TypeNumber, Optional: true},
+				{Name: "type", Type: model.TypeInteger, Optional: true},
+			},
+			Returns:     model.TypeNumber,
+			Description: "Payment per period of a loan (or an annuity) by constant payments and a constant interest rate",
+			Examples:    []string{"$PMT(0.05 / 12, 60, 100000)"},
+		},
+		fPmt,
+	},
+	{
+		model.FunctionSignature{
+			Name: "$PV",
+			Params: []model.Param{
+				{Name: "rate", Type: model.TypeNumber},
+				{Name: "nper", Type: model.TypeNumber},
+				{Name: "pmt", Type: model.TypeNumber},
+				{Name: "fv", Type: model.TypeNumber, Optional: true},
+				{Name: "type", Type: model.TypeInteger, Optional: true},
+			},
+			Returns:     model.TypeNumber,
+			Description: "Present value of a series of constant payments",
+			Examples:    []string{"$PV(0.05 / 12, 60, -1887.12)"},
+		},
+		fPv,
+	},
+	{
+		model.FunctionSignature{
+			Name: "$FV",
+			Params: []model.Param{
+				{Name: "rate", Type: model.TypeNumber},
+				{Name: "nper", Type: model.TypeNumber},
+				{Name: "pmt", Type: model.TypeNumber},
+				{Name: "pv", Type: model.TypeNumber, Optional: true},
+				{Name: "type", Type: model.TypeInteger, Optional: true},
+			},
+			Returns:     model.TypeNumber,
+			Description: "Future value of an investment by constant payments and a constant interest rate",
+			Examples:    []string{"$FV(0.06 / 12, 10, -200, -500, 1)"},
+		},
+		fFv,
+	},
+	{
+		model.FunctionSignature{
+			Name: "$NPV",
+			Params: []model.Param{
+				{Name: "rate", Type: model.TypeNumber},
+				{Name: "values", Type: model.TypeNumber, Variadic: true},
+			},
+			Returns:     model.TypeNumber,
+			Description: "Net present value of cash flows (numbers or arrays of numbers) at the end of periods discounted by the given rate",
+			Examples:    []string{"$NPV(0.1, -10000, 3000, 4200, 6800)", "$NPV(0.1, cashFlows)"},
+		},
+		fNpv,
+	},
+	{
+		model.FunctionSignature{
+			Name: "$IRR",
+			Params: []model.Param{
+				{Name: "values", Type: model.TypeArray},
+				{Name: "guess", Type: model.TypeNumber, Optional: true},
+			},
+			Returns:     model.TypeNumber,
+			Description: "Internal rate of return of cash flows (having at least a negative and a positive value) by an iterative solver, an error if it doesn't converge",
+			Examples:    []string{"$IRR([-70000, 12000, 15000, 18000, 21000, 26000])"},
+		},
+		fIrr,
+	},
+	{
+		model.FunctionSignature{
+			Name: "$RATE",
+			Params: []model.Param{
+				{Name: "nper", Type: model.TypeNumber},
+				{Name: "pmt", Type: model.TypeNumber},
+				{Name: "pv", Type: model.TypeNumber},
+				{Name: "fv", Type: model.TypeNumber, Optional: true},
+				{Name: "type", Type: model.TypeInteger, Optional: true},
+				{Name: "guess", Type: model.TypeNumber, Optional: true},
+			},
+			Returns:     model.TypeNumber,
+			Description: "Interest rate per period of an annuity by an iterative solver, an error if it doesn't converge",
+			Examples:    []string{"$RATE(60, -1887.12, 100000) * 12"},
+		},
+		fRate,
+	},
+	{
+		model.FunctionSignature{
+			Name: "$NPER",
+			Params: []model.Param{
+				{Name: "rate", Type: model.TypeNumber},
+				{Name: "pmt", Type: model.TypeNumber},
+				{Name: "pv", Type: model.TypeNumber},
+				{Name: "fv", Type: model.TypeNumber, Optional: true},
+				{Name: "type", Type: model.TypeInteger, Optional: true},
+			},
+			Returns:     model.TypeNumber,
+			Description: "Number of periods of an investment by constant payments and a constant interest rate",
+			Examples:    []string{"$NPER(0.05 / 12, -1887.12, 100000)"},
+		},
+		fNper,
+	},
+	{
+		model.FunctionSignature{
+			Name: "$AMORTIZE",
+			Params: []model.Param{
+				{Name: "rate", Type: model.TypeNumber},
+				{Name: "nper", Type: model.TypeInteger},
+				{Name: "pv", Type: model.TypeNumber},
+				{Name: "fv", Type: model.TypeNumber, Optional: true},
+				{Name: "type", Type: model.TypeInteger, Optional: true},
+			},
+			Returns:     model.TypeArray,
+			Description: "Amortization schedule of a loan as an array of periods {period, payment, interest, principal, balance}, payment, interest and principal have the same sign as $PMT, balance is the outstanding balance after the payment",
+			Examples:    []string{"$AMORTIZE(0.05 / 12, 60, 100000)[0].interest"},
+		},
+		fAmortize,
+	},
+}
+
+//solverIterations maximum iterations of $IRR and $RATE
+const solverIterations = 100
+
+//solverTolerance a change of rate small enough to stop iterating
+const solverTolerance = 1e-10
+
+//maxAmortizePeriods the largest number of periods of $AMORTIZE
+const maxAmortizePeriods = 10000
+
+//amortizationPeriod a period of a schedule returned by $AMORTIZE
+type amortizationPeriod struct {
+	Period    int     `json:"period"`
+	Payment   float64 `json:"payment"`
+	Interest  float64 `json:"interest"`
+	Principal float64 `json:"principal"`
+	Balance   float64 `json:"balance"`
+}
+
+//getOptionalFloat getting the argument at the given index as float64,
+//or the given value if it's omitted
+func getOptionalFloat(vm VM, funcDef interface{}, index int, value float64) float64 {
+
+	if index >= vm.GetFuncArgsCount(funcDef) {
+		return value
+	}
+
+	return vm.GetFuncArgAsFloat(funcDef, index)
+}
+
+//getPaymentType getting the (optional) argument at the given index as
+//payment type, 0 (end of periods) or 1 (beginning of periods)
+func getPaymentType(vm VM, funcDef interface{}, index int) float64 {
+
+	if getOptionalFloat(vm, funcDef, index, 0) == 0 {
+		return 0
+	}
+
+	return 1
+}
+
+//finite panicking with *model.FormulaError if the given result
+//of the given function is not a finite number
+func finite(funcName string, v float64) float64 {
+
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		panic(model.NewFormulaError(funcName, -1, model.ErrorKindRange, "result is not a finite number"))
+	}
+
+	return v
+}
+
+//annuityFactor ((1 + rate)^nper - 1) / rate, which is nper if rate is 0
+func annuityFactor(rate float64, nper float64) float64 {
+
+	if rate == 0 {
+		return nper
+	}
+
+	return (math.Pow(1+rate, nper) - 1) / rate
+}
+
+func pmt(rate float64, nper float64, pv float64, fv float64, paymentType float64) float64 {
+
+	return -(pv*math.Pow(1+rate, nper) + fv) / ((1 + rate*paymentType) * annuityFactor(rate, nper))
+}
+
+func fPmt(fs DefaultBuiltInFunctions, vm VM, funcDef interface{}) interface{} {
+
+	rate := vm.GetFuncArgAsFloat(funcDef, 0)
+	nper := vm.GetFuncArgAsFloat(funcDef, 1)
+	pv := vm.GetFuncArgAsFloat(funcDef, 2)
+	fv := getOptionalFloat(vm, funcDef, 3, 0)
+	paymentType := getPaymentType(vm, funcDef, 4)
+
+	return vm.ToVMValue(finite("$PMT", pmt(rate, nper, pv, fv, paymentType)))
+}
+
+func fPv(fs DefaultBuiltInFunctions, vm VM, funcDef interface{}) interface{} {
+
+	rate := vm.GetFuncArgAsFloat(funcDef, 0)
+	nper := vm.GetFuncArgAsFloat(funcDef, 1)
+	payment := vm.GetFuncArgAsFloat(funcDef, 2)
+	fv := getOptionalFloat(vm, funcDef, 3, 0)
+	paymentType := getPaymentType(vm, funcDef, 4)
+
+	result := -(fv + payment*(1+rate*paymentType)*annuityFactor(rate, nper)) / math.Pow(1+rate, nper)
+
+	return vm.ToVMValue(finite("$PV", result))
+}
+
+func fFv(fs DefaultBuiltInFunctions, vm VM, funcDef interface{}) interface{} {
+
+	rate := vm.GetFuncArgAsFloat(funcDef, 0)
+	nper := vm.GetFuncArgAsFloat(funcDef, 1)
+	payment := vm.GetFuncArgAsFloat(funcDef, 2)
+	pv := getOptionalFloat(vm, funcDef, 3, 0)
+	paymentType := getPaymentType(vm, funcDef, 4)
+
+	result := -(pv*math.Pow(1+rate, nper) + payment*(1+rate*paymentType)*annuityFactor(rate, nper))
+
+	return vm.ToVMValue(finite("$FV", result))
+}
+
+func fNpv(fs DefaultBuiltInFunctions, vm VM, funcDef interface{}) interface{} {
+
+	rate := vm.GetFuncArgAsFloat(funcDef, 0)
+
+	var result float64
+	for i, value := range getFloats(vm, funcDef, 1) {
+		result += value / math.Pow(1+rate, float64(i+1))
+	}
+
+	return vm.ToVMValue(finite("$NPV", result))
+}
+
+func fIrr(fs DefaultBuiltInFunctions, vm VM, funcDef interface{}) interface{} {
+
+	values := appendArgFloats(nil, vm, funcDef, 0)
+	guess := getOptionalFloat(vm, funcDef, 1, 0.1)
+
+	positive, negative := false, false
+	for _, value := range values {
+		positive = positive || value > 0
+		negative = negative || value < 0
+	}
+
+	if !positive || !negative {
+		panic(model.NewFormulaError("$IRR", 0, model.ErrorKindRange, "expecting at least a negative and a positive value"))
+	}
+
+	//NPV (at period 0) and its derivative
+	npv := func(rate float64) (float64, float64) {
+		var f, df float64
+		for i, value := range values {
+			f += value / math.Pow(1+rate, float64(i))
+			df -= float64(i) * value / math.Pow(1+rate, float64(i+1))
+		}
+		return f, df
+	}
+
+	return vm.ToVMValue(solveRate("$IRR", guess, npv))
+}
+
+func fRate(fs DefaultBuiltInFunctions, vm VM, funcDef interface{}) interface{} {
+
+	nper := vm.GetFuncArgAsFloat(funcDef, 0)
+	payment := vm.GetFuncArgAsFloat(funcDef, 1)
+	pv := vm.GetFuncArgAsFloat(funcDef, 2)
+	fv := getOptionalFloat(vm, funcDef, 3, 0)
+	paymentType := getPaymentType(vm, funcDef, 4)
+	guess := getOptionalFloat(vm, funcDef, 5, 0.1)
+
+	//Future value of all cash flows (zero at the rate) and its derivative
+	balance := func(rate float64) (float64, float64) {
+		f := func(rate float64) float64 {
+			return pv*math.Pow(1+rate, nper) + payment*(1+rate*paymentType)*annuityFactor(rate, nper) + fv
+		}
+		h := 1e-7 * math.Max(1, math.Abs(rate))
+		return f(rate), (f(rate+h) - f(rate-h)) / (2 * h)
+	}
+
+	return vm.ToVMValue(solveRate("$RATE", guess, balance))
+}
+
+//solveRate finding a rate where the given function is zero by Newton's
+//method starting from the given guess, panicking with *model.FormulaError
+//if it doesn't converge
+func solveRate(funcName string, guess float64, f func(rate float64) (float64, float64)) float64 {
+
+	rate := guess
+
+	for i := 0; i < solverIterations; i++ {
+
+		value, derivative := f(rate)
+		if derivative == 0 || math.IsNaN(value) || math.IsInf(value, 0) {
+			break
+		}
+
+		next := rate - value/derivative
+		if next <= -1 || math.IsNaN(next) || math.IsInf(next, 0) {
+			break
+		}
+
+		if math.Abs(next-rate) < solverTolerance {
+			return next
+		}
+
+		rate = next
+	}
+
+	errMsg := fmt.Sprintf("no result found after %d iterations (try another guess)", solverIterations)
+	panic(model.NewFormulaError(funcName, -1, model.ErrorKindRuntime, errMsg))
+}
+
+func fNper(fs DefaultBuiltInFunctions, vm VM, funcDef interface{}) interface{} {
+
+	rate := vm.GetFuncArgAsFloat(funcDef, 0)
+	payment := vm.GetFuncArgAsFloat(funcDef, 1)
+	pv := vm.GetFuncArgAsFloat(funcDef, 2)
+	fv := getOptionalFloat(vm, funcDef, 3, 0)
+	paymentType := getPaymentType(vm, funcDef, 4)
+
+	var result float64
+
+	if rate == 0 {
+		result = -(pv + fv) / payment
+	} else {
+		adjusted := payment * (1 + rate*paymentType)
+		result = math.Log((adjusted-fv*rate)/(adjusted+pv*rate)) / math.Log(1+rate)
+	}
+
+	return vm.ToVMValue(finite("$NPER", result))
+}
+
+func fAmortize(fs DefaultBuiltInFunctions, vm VM, funcDef interface{}) interface{} {
+
+	rate := vm.GetFuncArgAsFloat(funcDef, 0)
+	nper := vm.GetFuncArgAsInt(funcDef, 1)
+	pv := vm.GetFuncArgAsFloat(funcDef, 2)
+	fv := getOptionalFloat(vm, funcDef, 3, 0)
+	paymentType := getPaymentType(vm, funcDef, 4)
+
+	if nper < 1 || nper > maxAmortizePeriods {
+		errMsg := fmt.Sprintf("nper should be between 1 and %d", maxAmortizePeriods)
+		panic(model.NewFormulaError("$AMORTIZE", 1, model.ErrorKindRange, errMsg))
+	}
+
+	payment := finite("$AMORTIZE", pmt(rate, float64(nper), pv, fv, paymentType))
+	schedule := make([]amortizationPeriod, nper)
+	balance := pv
+
+	for i := range schedule {
+
+		var interest float64
+		//No interest is due at the beginning of the first period
+		if paymentType == 0 || i > 0 {
+			interest = -balance * rate
+		}
+
+		principal := payment - interest
+		periodPayment := payment
+
+		if i == len(schedule)-1 {
+			//Settling the remaining balance, so rounding errors
+			//accumulated by the periods don't leave e.g., 6.82e-13
+			principal = -fv - balance
+			periodPayment = principal + interest
+		}
+
+		balance += principal
+
+		schedule[i] = amortizationPeriod{
+			Period:    i + 1,
+			Payment:   periodPayment,
+			Interest:  interest,
+			Principal: principal,
+			Balance:   balance,
+		}
+	}
+
+	return vm.ToVMValue(schedule)
+}
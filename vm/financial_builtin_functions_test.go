@@ -0,0 +1,48 @@
+package vm_test
+
+import (
+	"testing"
+
+	"github.com/lertrel/goforit/builder"
+	"github.com/lertrel/goforit/model"
+)
+
+func TestFinancialFunctions(t *testing.T) {
+
+	f := builder.NewFormulaBuilder().Get()
+
+	runScriptTests(t, f, []scriptTest{
+		{"$RND($PMT(0.08 / 12, 10, 10000), 2)", "-1037.03"},
+		{"$RND($PMT(0.06 / 12, 18 * 12, 0, 50000), 2)", "-129.08"},
+		{"$PMT(0, 10, 1000)", "-100"},
+		{"$RND($PV(0.08 / 12, 12 * 20, 500), 2)", "-59777.15"},
+		{"$RND($FV(0.06 / 12, 10, -200, -500, 1), 2)", "2581.4"},
+		{"$RND($NPV(0.1, -10000, 3000, 4200, 6800), 2)", "1188.44"},
+		{"$RND($NPV(0.1, [-10000, 3000], [4200, 6800]), 2)", "1188.44"},
+		{"$RND($IRR([-70000, 12000, 15000, 18000, 21000, 26000]), 4)", "0.0866"},
+		{"$RND($IRR([-70000, 12000, 15000, 18000, 21000], -0.1), 4)", "-0.0212"},
+		{"$RND($RATE(4 * 12, -200, 8000), 6)", "0.007701"},
+		{"$RND($NPER(0.12 / 12, -100, -1000, 10000, 1), 4)", "59.6739"},
+		{"$NPER(0, -100, 1000)", "10"},
+	})
+
+	//Schedules settle the balance exactly in the last period
+	runScriptTests(t, f, []scriptTest{
+		{"$AMORTIZE(0.01, 3, 300).length", "3"},
+		{"var p = $AMORTIZE(0.01, 3, 300)[0]; [p.period, $RND(p.payment, 2), p.interest, $RND(p.principal, 2), $RND(p.balance, 2)].join()", "1,-102.01,-3,-99.01,200.99"},
+		{"$AMORTIZE(0.01, 3, 300)[2].balance", "0"},
+		{"$AMORTIZE(0.05, 360, 250000)[359].balance", "0"},
+		{"$AMORTIZE(0.01, 12, 1000, -200)[11].balance", "200"},
+		{"$AMORTIZE(0.01, 3, 300, 0, 1)[0].interest", "0"},
+		{"$AMORTIZE(0.01, 3, 300, 0, 1)[2].balance", "0"},
+		{"var p = $AMORTIZE(0.01, 3, 300)[2]; p.payment == p.interest + p.principal", "true"},
+	})
+
+	runErrorTests(t, f, []errorTest{
+		{"$IRR([100, 200])", model.ErrorKindRange},
+		{"$IRR([-100, 'abc'])", model.ErrorKindType},
+		{"$RATE(10, 100, 100)", model.ErrorKindRuntime},
+		{"$PMT(0.01, 0, 1000)", model.ErrorKindRange},
+		{"$AMORTIZE(0.01, 0, 1000)", model.ErrorKindRange},
+	})
+}
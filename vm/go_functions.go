@@ -0,0 +1,610 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lertrel/goforit/model"
+)
+
+//NewGoFunctions is returning an empty GoFunctions
+func NewGoFunctions() *GoFunctions {
+
+	return &GoFunctions{funcs: make(map[string]goFunction)}
+}
+
+//GoFunctions BuiltInFunctions calling ordinary Go functions through
+//reflection, so a built-in function doesn't need to deal with VM
+//
+//Arguments are converted into types of the Go function parameters
+//(including slices, maps and structs), results are converted back
+//into VM values, and an error returned by the Go function becomes
+//a *model.FormulaError (unless it's already one)
+//
+//Ex.
+//
+//		funcs := vm.NewGoFunctions()
+//		err := funcs.Register("$VAT", func(amount float64, rate float64) (float64, error) {
+//			if rate < 0 {
+//				return 0, errors.New("negative rate")
+//			}
+//			return amount * rate, nil
+//		})
+//
+type GoFunctions struct {
+	funcs map[string]goFunction
+}
+
+type goFunction struct {
+	fn        reflect.Value
+	signature model.FunctionSignature
+	//hasResult the first result is a value (rather than error)
+	hasResult bool
+	//hasError the last result is error
+	hasError bool
+}
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+var decimalType = reflect.TypeOf((*big.Rat)(nil))
+
+var timeType = reflect.TypeOf(time.Time{})
+
+//errGoOutOfRange a number not fitting into a parameter type
+var errGoOutOfRange = errors.New("is out of range")
+
+//Register registering the given Go function by the given name,
+//an error is returned if the function is not supported, which is
+//a function having parameters of types other than numbers, string,
+//bool, *big.Rat (decimal), time.Time (date in UTC unless it's given
+//with time zone offset), interface{}, slices, maps (of string keys)
+//and structs, or
+//having results other than (), (T), (error) or (T, error)
+func (fs *GoFunctions) Register(funcName string, fn interface{}) error {
+
+	if !strings.HasPrefix(funcName, "$") {
+		return fmt.Errorf("%s - function name must start with $", funcName)
+	}
+
+	fnValue := reflect.ValueOf(fn)
+	if fnValue.Kind() != reflect.Func || fnValue.IsNil() {
+		return fmt.Errorf("%s - expecting a function but got %T", funcName, fn)
+	}
+
+	fnType := fnValue.Type()
+	f := goFunction{fn: fnValue}
+
+	switch fnType.NumOut() {
+	case 0:
+	case 1:
+		f.hasError = fnType.Out(0) == errorType
+		f.hasResult = !f.hasError
+	case 2:
+		if fnType.Out(1) != errorType {
+			return fmt.Errorf("%s - the second result must be error", funcName)
+		}
+		f.hasResult = true
+		f.hasError = true
+	default:
+		return fmt.Errorf("%s - too many results", funcName)
+	}
+
+	params := make([]model.Param, fnType.NumIn())
+
+	for i := 0; i < fnType.NumIn(); i++ {
+
+		paramType := fnType.In(i)
+		variadic := fnType.IsVariadic() && i == fnType.NumIn()-1
+		if variadic {
+			paramType = paramType.Elem()
+		}
+
+		valueType, ok := goValueType(paramType)
+		if !ok {
+			return fmt.Errorf("%s - unsupported type of parameter #%d (%v)", funcName, i+1, paramType)
+		}
+
+		params[i] = model.Param{
+			Name:     fmt.Sprintf("arg%d", i+1),
+			Type:     valueType,
+			Optional: variadic,
+			Variadic: variadic,
+		}
+	}
+
+	f.signature = model.FunctionSignature{
+		Name:    funcName,
+		Params:  params,
+		Returns: model.TypeAny,
+	}
+
+	if f.hasResult {
+		f.signature.Returns, _ = goValueType(fnType.Out(0))
+	}
+
+	fs.funcs[funcName] = f
+
+	return nil
+}
+
+//FunctionNames getting names of all registered functions
+func (fs *GoFunctions) FunctionNames() []string {
+
+	names := make([]string, 0, len(fs.funcs))
+	for funcName := range fs.funcs {
+		names = append(names, funcName)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+//List getting signatures of all registered functions (parameters are
+//named arg1, arg2, ... as Go doesn't keep parameter names)
+func (fs *GoFunctions) List() []model.FunctionSignature {
+
+	signatures := make([]model.FunctionSignature, 0, len(fs.funcs))
+	for _, funcName := range fs.FunctionNames() {
+		signatures = append(signatures, fs.funcs[funcName].signature)
+	}
+
+	return signatures
+}
+
+//Describe getting signature of the given function
+func (fs *GoFunctions) Describe(funcName string) (model.FunctionSignature, bool) {
+
+	f, found := fs.funcs[funcName]
+
+	return f.signature, found
+}
+
+//Arity getting min and max number of arguments accepted by the given
+//function, max is -1 for variadic functions, found is false if unknown
+func (fs *GoFunctions) Arity(funcName string) (min int, max int, found bool) {
+
+	f, found := fs.funcs[funcName]
+	if !found {
+		return 0, 0, false
+	}
+
+	min, max = f.signature.Arity()
+
+	return min, max, true
+}
+
+//Has to check if the given function name is supported
+//by the current BuiltInFunctions
+func (fs *GoFunctions) Has(funcName string) bool {
+
+	_, found := fs.funcs[funcName]
+
+	return found
+}
+
+//Execute to execute a built-in function as per the given function name
+func (fs *GoFunctions) Execute(funcName string, vm VM, funcDef interface{}) (interface{}, bool) {
+
+	f, found := fs.funcs[funcName]
+	if !found {
+		return nil, false
+	}
+
+	validateArity(funcName, f.signature, vm, funcDef)
+
+	fnType := f.fn.Type()
+	cnt := vm.GetFuncArgsCount(funcDef)
+	args := make([]reflect.Value, cnt)
+
+	for i := 0; i < cnt; i++ {
+
+		var paramType reflect.Type
+		if fnType.IsVariadic() && i >= fnType.NumIn()-1 {
+			paramType = fnType.In(fnType.NumIn() - 1).Elem()
+		} else {
+			paramType = fnType.In(i)
+		}
+
+		args[i] = goArg(vm, funcDef, i, paramType)
+	}
+
+	results := f.fn.Call(args)
+
+	if f.hasError {
+		if err, _ := results[len(results)-1].Interface().(error); err != nil {
+			panic(toFormulaError(funcName, err))
+		}
+	}
+
+	if !f.hasResult {
+		return vm.ToVMValue(nil), true
+	}
+
+	return vm.ToVMValue(results[0].Interface()), true
+}
+
+//toFormulaError an error returned by a Go function as *model.FormulaError
+func toFormulaError(funcName string, err error) *model.FormulaError {
+
+	var formulaErr *model.FormulaError
+	if errors.As(err, &formulaErr) {
+		return formulaErr
+	}
+
+	formulaErr = model.NewFormulaError(funcName, -1, model.ErrorKindRuntime, err.Error())
+	formulaErr.Err = err
+
+	return formulaErr
+}
+
+//goArg getting the argument at the given index as the given type
+func goArg(vm VM, funcDef interface{}, index int, t reflect.Type) reflect.Value {
+
+	var value interface{}
+
+	switch t {
+	case decimalType:
+		return reflect.ValueOf(vm.GetFuncArgAsDecimal(funcDef, index))
+	case timeType:
+		return reflect.ValueOf(vm.GetFuncArgAsTime(funcDef, index, time.UTC))
+	}
+
+	switch t.Kind() {
+	case reflect.Float32, reflect.Float64,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		//Integers are checked for fractions and ranges by toGoValue
+		value = vm.GetFuncArgAsFloat(funcDef, index)
+	case reflect.String:
+		value = vm.GetFuncArgAsString(funcDef, index)
+	case reflect.Bool:
+		value = vm.GetFuncArgAsBoolean(funcDef, index)
+	default:
+		exported, err := vm.Export(vm.GetFuncArgAsIs(funcDef, index))
+		if err != nil {
+			panic(newGoArgError(index, err))
+		}
+		value = exported
+	}
+
+	arg, err := toGoValue(value, t)
+	if err != nil {
+		panic(newGoArgError(index, err))
+	}
+
+	return arg
+}
+
+func newGoArgError(index int, err error) *model.FormulaError {
+
+	kind := model.ErrorKindType
+	if errors.Is(err, errGoOutOfRange) {
+		kind = model.ErrorKindRange
+	}
+
+	formulaErr := model.NewFormulaError("", index, kind, err.Error())
+	formulaErr.Err = err
+
+	return formulaErr
+}
+
+//toGoValue converting a value exported from VM into the given type
+func toGoValue(value interface{}, t reflect.Type) (reflect.Value, error) {
+
+	if value == nil {
+		return reflect.Zero(t), nil
+	}
+
+	v := reflect.ValueOf(value)
+
+	if v.Type().AssignableTo(t) {
+		return v, nil
+	}
+
+	switch t {
+	case decimalType:
+		return toGoDecimal(value)
+	case timeType:
+		if s, ok := value.(string); ok {
+			tm, err := model.ParseTime(s, time.UTC)
+			return reflect.ValueOf(tm), err
+		}
+	}
+
+	switch t.Kind() {
+	case reflect.Float32, reflect.Float64,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if isNumberKind(v.Kind()) {
+			if hasFraction(v, t) {
+				return reflect.Value{}, fmt.Errorf("%v has a fraction, expecting %v", value, t)
+			}
+			if overflows(v, t) {
+				return reflect.Value{}, fmt.Errorf("%v %w of %v", value, errGoOutOfRange, t)
+			}
+			return v.Convert(t), nil
+		}
+	case reflect.String:
+		if v.Kind() == reflect.String {
+			return v.Convert(t), nil
+		}
+	case reflect.Bool:
+		if v.Kind() == reflect.Bool {
+			return v.Convert(t), nil
+		}
+	case reflect.Slice:
+		if v.Kind() == reflect.Slice || v.Kind() == reflect.Array {
+			result := reflect.MakeSlice(t, v.Len(), v.Len())
+			for i := 0; i < v.Len(); i++ {
+				elem, err := toGoValue(v.Index(i).Interface(), t.Elem())
+				if err != nil {
+					return reflect.Value{}, fmt.Errorf("[%d]: %w", i, err)
+				}
+				result.Index(i).Set(elem)
+			}
+			return result, nil
+		}
+	case reflect.Array:
+		if v.Kind() == reflect.Slice || v.Kind() == reflect.Array {
+			if v.Len() != t.Len() {
+				return reflect.Value{}, fmt.Errorf("expecting %d elements but got %d", t.Len(), v.Len())
+			}
+			result := reflect.New(t).Elem()
+			for i := 0; i < v.Len(); i++ {
+				elem, err := toGoValue(v.Index(i).Interface(), t.Elem())
+				if err != nil {
+					return reflect.Value{}, fmt.Errorf("[%d]: %w", i, err)
+				}
+				result.Index(i).Set(elem)
+			}
+			return result, nil
+		}
+	case reflect.Map:
+		if v.Kind() == reflect.Map && v.Type().Key().Kind() == reflect.String {
+			result := reflect.MakeMapWithSize(t, v.Len())
+			iter := v.MapRange()
+			for iter.Next() {
+				key, err := toGoValue(iter.Key().Interface(), t.Key())
+				if err != nil {
+					return reflect.Value{}, err
+				}
+				elem, err := toGoValue(iter.Value().Interface(), t.Elem())
+				if err != nil {
+					return reflect.Value{}, fmt.Errorf("%v: %w", iter.Key(), err)
+				}
+				result.SetMapIndex(key, elem)
+			}
+			return result, nil
+		}
+	case reflect.Struct:
+		if fields, ok := value.(map[string]interface{}); ok {
+			return toGoStruct(fields, t)
+		}
+	case reflect.Ptr:
+		elem, err := toGoValue(value, t.Elem())
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		ptr := reflect.New(t.Elem())
+		ptr.Elem().Set(elem)
+		return ptr, nil
+	}
+
+	return reflect.Value{}, fmt.Errorf("expecting %v but got %T", t, value)
+}
+
+//toGoDecimal converting a number or a decimal string into *big.Rat
+func toGoDecimal(value interface{}) (reflect.Value, error) {
+
+	var s string
+
+	switch value := value.(type) {
+	case string:
+		s = value
+	case float64:
+		s = strconv.FormatFloat(value, 'g', -1, 64)
+	default:
+		if !isNumberKind(reflect.ValueOf(value).Kind()) {
+			return reflect.Value{}, fmt.Errorf("expecting a decimal but got %T", value)
+		}
+		s = fmt.Sprint(value)
+	}
+
+	d, err := model.ParseDecimal(s)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+
+	return reflect.ValueOf(d), nil
+}
+
+//toGoStruct converting an object (exported as map) into the given struct
+//type, properties are matched with fields by names given by json tags
+//(if any), or field names (case-insensitive)
+func toGoStruct(fields map[string]interface{}, t reflect.Type) (reflect.Value, error) {
+
+	result := reflect.New(t).Elem()
+
+	for i := 0; i < t.NumField(); i++ {
+
+		field := t.Field(i)
+		name, ok := goFieldName(field)
+		if !ok {
+			continue
+		}
+
+		value, found := fields[name]
+		if !found {
+			for key, v := range fields {
+				if strings.EqualFold(key, name) {
+					value, found = v, true
+					break
+				}
+			}
+		}
+
+		if !found {
+			continue
+		}
+
+		fieldValue, err := toGoValue(value, field.Type)
+		if err != nil {
+			return reflect.Value{}, fmt.Errorf("%s: %w", name, err)
+		}
+
+		result.Field(i).Set(fieldValue)
+	}
+
+	return result, nil
+}
+
+//goFieldName name of the given struct field seen by VM (json tag if any),
+//false if the field is not exported (or ignored by json tag "-")
+func goFieldName(field reflect.StructField) (string, bool) {
+
+	if field.PkgPath != "" {
+		return "", false
+	}
+
+	tag := strings.Split(field.Tag.Get("json"), ",")[0]
+
+	switch tag {
+	case "-":
+		return "", false
+	case "":
+		return field.Name, true
+	default:
+		return tag, true
+	}
+}
+
+func isNumberKind(kind reflect.Kind) bool {
+
+	switch kind {
+	case reflect.Float32, reflect.Float64,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+
+	return false
+}
+
+//hasFraction telling if the given number has a fractional part which
+//would be lost by being converted into the given integer type
+func hasFraction(v reflect.Value, t reflect.Type) bool {
+
+	if !isIntKind(t.Kind()) && !isUintKind(t.Kind()) {
+		return false
+	}
+
+	switch v.Kind() {
+	case reflect.Float32, reflect.Float64:
+		f := v.Float()
+		return !math.IsInf(f, 0) && f != math.Trunc(f)
+	}
+
+	return false
+}
+
+//overflows telling if the given number doesn't fit into the given number
+//type (a fraction is checked by hasFraction)
+func overflows(v reflect.Value, t reflect.Type) bool {
+
+	target := reflect.New(t).Elem()
+
+	switch v.Kind() {
+	case reflect.Float32, reflect.Float64:
+		f := v.Float()
+		switch {
+		case isIntKind(t.Kind()):
+			return math.IsNaN(f) || f < math.MinInt64 || f >= -math.MinInt64 || target.OverflowInt(int64(f))
+		case isUintKind(t.Kind()):
+			return math.IsNaN(f) || f < 0 || f >= 2*-math.MinInt64 || target.OverflowUint(uint64(f))
+		}
+		return target.OverflowFloat(f)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i := v.Int()
+		switch {
+		case isIntKind(t.Kind()):
+			return target.OverflowInt(i)
+		case isUintKind(t.Kind()):
+			return i < 0 || target.OverflowUint(uint64(i))
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u := v.Uint()
+		switch {
+		case isIntKind(t.Kind()):
+			return u > math.MaxInt64 || target.OverflowInt(int64(u))
+		case isUintKind(t.Kind()):
+			return target.OverflowUint(u)
+		}
+	}
+
+	return false
+}
+
+func isIntKind(kind reflect.Kind) bool {
+
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return true
+	}
+
+	return false
+}
+
+func isUintKind(kind reflect.Kind) bool {
+
+	switch kind {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+
+	return false
+}
+
+//goValueType ValueType of the given Go type, false if not supported
+func goValueType(t reflect.Type) (model.ValueType, bool) {
+
+	switch t {
+	case decimalType:
+		return model.TypeDecimal, true
+	case timeType:
+		return model.TypeDate, true
+	}
+
+	switch t.Kind() {
+	case reflect.Float32, reflect.Float64:
+		return model.TypeNumber, true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return model.TypeInteger, true
+	case reflect.String:
+		return model.TypeString, true
+	case reflect.Bool:
+		return model.TypeBoolean, true
+	case reflect.Slice, reflect.Array:
+		_, ok := goValueType(t.Elem())
+		return model.TypeArray, ok
+	case reflect.Map:
+		_, ok := goValueType(t.Elem())
+		return model.TypeObject, ok && t.Key().Kind() == reflect.String
+	case reflect.Struct:
+		return model.TypeObject, true
+	case reflect.Ptr:
+		return goValueType(t.Elem())
+	case reflect.Interface:
+		return model.TypeAny, true
+	}
+
+	return model.TypeAny, false
+}
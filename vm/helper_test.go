@@ -0,0 +1,99 @@
+package vm_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/lertrel/goforit/model"
+)
+
+//scriptTest a script and its expected result (as a string)
+type scriptTest struct {
+	script   string
+	expected string
+}
+
+//errorTest a script and the kind of *model.FormulaError it raises
+type errorTest struct {
+	script string
+	kind   model.ErrorKind
+}
+
+//newContext getting an empty context of the given formula
+func newContext(t *testing.T, f model.Formula) model.FormulaContext {
+
+	t.Helper()
+
+	c, err := f.NewContext("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return c
+}
+
+//run preparing the given context for the given script, then running it
+//by the given ctx, the result is converted into a string
+func run(ctx context.Context, c model.FormulaContext, script string) (string, error) {
+
+	if err := c.Prepare(script); err != nil {
+		return "", err
+	}
+
+	v, err := c.RunContext(ctx, script)
+	if err != nil {
+		return "", err
+	}
+
+	return v.ToString()
+}
+
+//runScriptTests running every test by a new context of the given formula
+func runScriptTests(t *testing.T, f model.Formula, tests []scriptTest) {
+
+	t.Helper()
+
+	for _, test := range tests {
+
+		s, err := run(context.Background(), newContext(t, f), test.script)
+		if err != nil {
+			t.Errorf("%s - %v\n", test.script, err)
+			continue
+		}
+
+		if s != test.expected {
+			t.Errorf("%s - expect %v but got %v\n", test.script, test.expected, s)
+		}
+	}
+}
+
+//runErrorTests running every test by a context of the given formula,
+//expecting a *model.FormulaError of the kind of the test
+func runErrorTests(t *testing.T, f model.Formula, tests []errorTest) {
+
+	t.Helper()
+
+	c := newContext(t, f)
+
+	for _, test := range tests {
+
+		if formulaErr := formulaErrorOf(c, test.script); formulaErr == nil || formulaErr.Kind != test.kind {
+			t.Errorf("%s - expect a %v error but got %v\n", test.script, test.kind, formulaErr)
+		}
+	}
+}
+
+//formulaErrorOf running the given script by the given context, nil if
+//it doesn't fail with a *model.FormulaError
+func formulaErrorOf(c model.FormulaContext, script string) *model.FormulaError {
+
+	_, err := run(context.Background(), c, script)
+
+	var formulaErr *model.FormulaError
+	if !errors.As(err, &formulaErr) {
+		return nil
+	}
+
+	return formulaErr
+}
@@ -1,6 +1,11 @@
 package vm
 
-import "github.com/lertrel/goforit/model"
+import (
+	"math/big"
+	"time"
+
+	"github.com/lertrel/goforit/model"
+)
 
 //JSValue a placeholder for a java script value
 type JSValue struct {
@@ -106,6 +111,16 @@ func (j JSValue) ToString() (string, error) {
 	return j.vm.ToString(j.impl)
 }
 
+//ToDecimal get value (a number or a decimal string) as an exact number
+func (j JSValue) ToDecimal() (*big.Rat, error) {
+	return j.vm.ToDecimal(j.impl)
+}
+
+//ToTime get value (a date string, a date-time string or a JS Date) as time
+func (j JSValue) ToTime() (time.Time, error) {
+	return j.vm.ToTime(j.impl, time.UTC)
+}
+
 //Export js value to Go value type
 func (j JSValue) Export() (interface{}, error) {
 	// return j.impl.Export()
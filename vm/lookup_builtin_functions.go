@@ -0,0 +1,452 @@
+package vm
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/lertrel/goforit/model"
+)
+
+//lookupBuiltIns lookup functions of DefaultBuiltInFunctions querying
+//tables of TableRepository (see WithTables), and arrays
+var lookupBuiltIns = []builtInFunction{
+	{
+		model.FunctionSignature{
+			Name: "$VLOOKUP",
+			Params: []model.Param{
+				{Name: "key", Type: model.TypeAny},
+				{Name: "table", Type: model.TypeString},
+				{Name: "column", Type: model.TypeAny},
+				{Name: "approximate", Type: model.TypeBoolean, Optional: true},
+			},
+			Returns:     model.TypeAny,
+			Description: "The value of the given column (a name or 1 for the first column) of the row having the given key in the first column of the given table, or the row having the largest key not greater than the given one if approximate is true (keys must be ascending), an error if there's no such row",
+			Examples:    []string{"$VLOOKUP(plan, 'rates', 'rate')", "$VLOOKUP(age, 'rates', 'rate', true)"},
+		},
+		fVLookup,
+	},
+	{
+		model.FunctionSignature{
+			Name: "$BRACKET",
+			Params: []model.Param{
+				{Name: "amount", Type: model.TypeNumber},
+				{Name: "table", Type: model.TypeString},
+				{Name: "column", Type: model.TypeAny},
+			},
+			Returns:     model.TypeNumber,
+			Description: "Sum of portions of the given amount within tiers multiplied by rates of the tiers (the given column) e.g., progressive tax, a tier starts from the value of the first column (which must be ascending) of its row up to the next row",
+			Examples:    []string{"$BRACKET(income, 'tax', 'rate')"},
+		},
+		fBracket,
+	},
+	{
+		model.FunctionSignature{
+			Name: "$INDEX",
+			Params: []model.Param{
+				{Name: "table", Type: model.TypeAny},
+				{Name: "row", Type: model.TypeInteger},
+				{Name: "column", Type: model.TypeAny, Optional: true},
+			},
+			Returns:     model.TypeAny,
+			Description: "The value at the given row (1 is the first row) and column (a name or 1 for the first column, the first column by default) of the given table, or of the given array (of arrays)",
+			Examples:    []string{"$INDEX('rates', 2, 'rate')", "$INDEX([[1, 2], [3, 4]], 2, 1)"},
+		},
+		fIndex,
+	},
+	{
+		model.FunctionSignature{
+			Name: "$MATCH",
+			Params: []model.Param{
+				{Name: "key", Type: model.TypeAny},
+				{Name: "table", Type: model.TypeAny},
+				{Name: "column", Type: model.TypeAny, Optional: true},
+				{Name: "type", Type: model.TypeInteger, Optional: true},
+			},
+			Returns:     model.TypeInteger,
+			Description: "The position (1 is the first one) of the given key in the given column (the first column by default) of the given table, or in the given array (without column), type 0 (by default) for the exact key, 1 for the largest value not greater than the key (values must be ascending), -1 for the smallest value not less than the key (values must be descending), an error if not found",
+			Examples:    []string{"$MATCH('B', 'rates', 'plan')", "$MATCH(35, [20, 30, 40], 1)"},
+		},
+		fMatch,
+	},
+	{
+		model.FunctionSignature{
+			Name:        "$TABLE",
+			Params:      []model.Param{{Name: "table", Type: model.TypeString}, {Name: "column", Type: model.TypeAny, Optional: true}},
+			Returns:     model.TypeArray,
+			Description: "Rows (objects of columns) of the given table, or values of the given column only",
+			Examples:    []string{"$TABLE('rates')", "$SUMF($TABLE('rates', 'rate'))"},
+		},
+		fTable,
+	},
+}
+
+//tableSet table repositories looked up in order (referred by a pointer,
+//so DefaultBuiltInFunctions is still comparable)
+type tableSet struct {
+	repos []TableRepository
+}
+
+//WithTables getting a copy of the current BuiltInFunctions looking up
+//tables of lookup functions also in the given repository (after the
+//ones given before)
+func (fs DefaultBuiltInFunctions) WithTables(repo TableRepository) DefaultBuiltInFunctions {
+
+	tables := &tableSet{}
+
+	if fs.tables != nil {
+		tables.repos = append(tables.repos, fs.tables.repos...)
+	}
+
+	tables.repos = append(tables.repos, repo)
+	fs.tables = tables
+
+	return fs
+}
+
+//Table getting the table of the given name from the first repository having it
+func (fs DefaultBuiltInFunctions) Table(name string) (*Table, bool) {
+
+	if fs.tables == nil {
+		return nil, false
+	}
+
+	for _, repo := range fs.tables.repos {
+		if t, found := repo.GetTable(name); found {
+			return t, true
+		}
+	}
+
+	return nil, false
+}
+
+//getTable getting the table named by the argument at the given index
+func (fs DefaultBuiltInFunctions) getTable(funcName string, vm VM, funcDef interface{}, index int) *Table {
+
+	name := vm.GetFuncArgAsString(funcDef, index)
+
+	t, found := fs.Table(name)
+	if !found {
+		panic(model.NewFormulaError(funcName, index, model.ErrorKindRange, "unknown table "+name))
+	}
+
+	return t
+}
+
+//getColumn getting (0-based) index of the column referred by the argument
+//at the given index either by its name or its position (1 is the first one)
+func getColumn(funcName string, vm VM, funcDef interface{}, index int, t *Table) int {
+
+	arg := vm.GetFuncArgAsIs(funcDef, index)
+
+	if vm.IsNumber(arg) {
+		i := vm.GetFuncArgAsInt(funcDef, index)
+		if i < 1 || i > int64(len(t.columns)) {
+			errMsg := fmt.Sprintf("column should be between 1 and %d", len(t.columns))
+			panic(model.NewFormulaError(funcName, index, model.ErrorKindRange, errMsg))
+		}
+		return int(i - 1)
+	}
+
+	name := vm.GetFuncArgAsString(funcDef, index)
+
+	i, found := t.Column(name)
+	if !found {
+		panic(model.NewFormulaError(funcName, index, model.ErrorKindRange, "unknown column "+name))
+	}
+
+	return i
+}
+
+//getKey getting the argument at the given index as a key comparable with
+//values of tables (see compareKeys)
+func getKey(vm VM, funcDef interface{}, index int) interface{} {
+
+	return toKey(vm, index, vm.GetFuncArgAsIs(funcDef, index))
+}
+
+func toKey(vm VM, index int, value interface{}) interface{} {
+
+	var key interface{}
+	var err error
+
+	switch {
+	case vm.IsNull(value) || vm.IsUndefined(value):
+		return nil
+	case vm.IsNumber(value):
+		key, err = vm.ToFloat(value)
+	case vm.IsBoolean(value):
+		key, err = vm.ToBoolean(value)
+	default:
+		key, err = vm.ToString(value)
+	}
+
+	if err != nil {
+		panic(newJSTypeError(index, err))
+	}
+
+	return key
+}
+
+//compareKeys comparing the given keys (float64, string, bool or nil),
+//numeric strings (e.g., decimals) are compared as numbers, and other
+//strings are compared case-insensitively, false if they're not comparable
+func compareKeys(a interface{}, b interface{}) (int, bool) {
+
+	a, b = normalizeKey(a), normalizeKey(b)
+
+	switch a := a.(type) {
+	case float64:
+		if b, ok := b.(float64); ok {
+			switch {
+			case a < b:
+				return -1, true
+			case a > b:
+				return 1, true
+			}
+			return 0, true
+		}
+	case string:
+		if b, ok := b.(string); ok {
+			return strings.Compare(a, b), true
+		}
+	case bool:
+		if b, ok := b.(bool); ok && a == b {
+			return 0, true
+		}
+	}
+
+	return 0, false
+}
+
+func normalizeKey(key interface{}) interface{} {
+
+	s, ok := key.(string)
+	if !ok {
+		return key
+	}
+
+	if f, err := strconv.ParseFloat(strings.TrimSpace(s), 64); err == nil {
+		return f
+	}
+
+	return strings.ToLower(s)
+}
+
+//matchKey position of the given key among the given values by the given
+//match type (see $MATCH), -1 if not found
+func matchKey(key interface{}, values []interface{}, matchType int64) int {
+
+	found := -1
+
+	for i, value := range values {
+
+		c, ok := compareKeys(value, key)
+		if !ok {
+			continue
+		}
+
+		switch {
+		case matchType == 0 && c == 0:
+			return i
+		case matchType > 0 && c <= 0, matchType < 0 && c >= 0:
+			found = i
+		case matchType != 0:
+			//Values are sorted, so there's no more candidate
+			return found
+		}
+	}
+
+	return found
+}
+
+func (t *Table) columnValues(column int) []interface{} {
+
+	values := make([]interface{}, len(t.rows))
+	for i, row := range t.rows {
+		values[i] = row[column]
+	}
+
+	return values
+}
+
+func fVLookup(fs DefaultBuiltInFunctions, vm VM, funcDef interface{}) interface{} {
+
+	key := getKey(vm, funcDef, 0)
+	t := fs.getTable("$VLOOKUP", vm, funcDef, 1)
+	column := getColumn("$VLOOKUP", vm, funcDef, 2, t)
+
+	var matchType int64
+	if vm.GetFuncArgsCount(funcDef) > 3 && vm.GetFuncArgAsBoolean(funcDef, 3) {
+		matchType = 1
+	}
+
+	row := matchKey(key, t.columnValues(0), matchType)
+	if row < 0 {
+		errMsg := fmt.Sprintf("no row of key %v in table %s", key, vm.GetFuncArgAsString(funcDef, 1))
+		panic(model.NewFormulaError("$VLOOKUP", 0, model.ErrorKindRuntime, errMsg))
+	}
+
+	return vm.ToVMValue(t.Value(row, column))
+}
+
+//toTableDecimal converting the given value of a table into a decimal
+func toTableDecimal(value interface{}) (*big.Rat, bool) {
+
+	switch value := value.(type) {
+	case float64:
+		d, err := model.ParseDecimal(strconv.FormatFloat(value, 'f', -1, 64))
+		return d, err == nil
+	case string:
+		d, err := model.ParseDecimal(strings.TrimSpace(value))
+		return d, err == nil
+	}
+
+	return nil, false
+}
+
+func fBracket(fs DefaultBuiltInFunctions, vm VM, funcDef interface{}) interface{} {
+
+	amount := vm.GetFuncArgAsDecimal(funcDef, 0)
+	t := fs.getTable("$BRACKET", vm, funcDef, 1)
+	column := getColumn("$BRACKET", vm, funcDef, 2, t)
+
+	result := new(big.Rat)
+	var prev *big.Rat
+
+	for i := 0; i < t.Len(); i++ {
+
+		from, ok := toTableDecimal(t.Value(i, 0))
+		if !ok || prev != nil && from.Cmp(prev) <= 0 {
+			errMsg := fmt.Sprintf("first column of row %d should be a number greater than the previous one", i+1)
+			panic(model.NewFormulaError("$BRACKET", 1, model.ErrorKindRuntime, errMsg))
+		}
+
+		rate, ok := toTableDecimal(t.Value(i, column))
+		if !ok {
+			errMsg := fmt.Sprintf("column %s of row %d should be a number", t.columns[column], i+1)
+			panic(model.NewFormulaError("$BRACKET", 2, model.ErrorKindRuntime, errMsg))
+		}
+
+		if amount.Cmp(from) <= 0 {
+			break
+		}
+		prev = from
+
+		to := amount
+		if i+1 < t.Len() {
+			if next, ok := toTableDecimal(t.Value(i+1, 0)); ok && next.Cmp(amount) < 0 {
+				to = next
+			}
+		}
+
+		portion := new(big.Rat).Sub(to, from)
+		result.Add(result, portion.Mul(portion, rate))
+	}
+
+	f, _ := result.Float64()
+
+	return vm.ToVMValue(f)
+}
+
+func fIndex(fs DefaultBuiltInFunctions, vm VM, funcDef interface{}) interface{} {
+
+	row := vm.GetFuncArgAsInt(funcDef, 1)
+
+	if vm.IsArray(vm.GetFuncArgAsIs(funcDef, 0)) {
+		value := indexArray(vm, 1, vm.GetFuncArgAsArray(funcDef, 0), row)
+		if vm.GetFuncArgsCount(funcDef) < 3 {
+			return value
+		}
+
+		elements, err := vm.ToArray(value)
+		if err != nil || !vm.IsArray(value) {
+			panic(model.NewFormulaError("$INDEX", 1, model.ErrorKindType, "expecting an array of arrays"))
+		}
+
+		return indexArray(vm, 2, elements, vm.GetFuncArgAsInt(funcDef, 2))
+	}
+
+	t := fs.getTable("$INDEX", vm, funcDef, 0)
+
+	column := 0
+	if vm.GetFuncArgsCount(funcDef) > 2 {
+		column = getColumn("$INDEX", vm, funcDef, 2, t)
+	}
+
+	if row < 1 || row > int64(t.Len()) {
+		errMsg := fmt.Sprintf("row should be between 1 and %d", t.Len())
+		panic(model.NewFormulaError("$INDEX", 1, model.ErrorKindRange, errMsg))
+	}
+
+	return vm.ToVMValue(t.Value(int(row-1), column))
+}
+
+//indexArray the element at the given position (1 is the first one)
+//of the given array
+func indexArray(vm VM, index int, elements []interface{}, position int64) interface{} {
+
+	if position < 1 || position > int64(len(elements)) {
+		errMsg := fmt.Sprintf("position should be between 1 and %d", len(elements))
+		panic(model.NewFormulaError("$INDEX", index, model.ErrorKindRange, errMsg))
+	}
+
+	return elements[position-1]
+}
+
+func fMatch(fs DefaultBuiltInFunctions, vm VM, funcDef interface{}) interface{} {
+
+	key := getKey(vm, funcDef, 0)
+
+	var values []interface{}
+	typeIndex := 3
+
+	if vm.IsArray(vm.GetFuncArgAsIs(funcDef, 1)) {
+		for _, element := range vm.GetFuncArgAsArray(funcDef, 1) {
+			values = append(values, toKey(vm, 1, element))
+		}
+		typeIndex = 2
+	} else {
+		t := fs.getTable("$MATCH", vm, funcDef, 1)
+		column := 0
+		if vm.GetFuncArgsCount(funcDef) > 2 {
+			column = getColumn("$MATCH", vm, funcDef, 2, t)
+		}
+		values = t.columnValues(column)
+	}
+
+	var matchType int64
+	if vm.GetFuncArgsCount(funcDef) > typeIndex {
+		matchType = vm.GetFuncArgAsInt(funcDef, typeIndex)
+		if matchType < -1 || matchType > 1 {
+			panic(model.NewFormulaError("$MATCH", typeIndex, model.ErrorKindRange, "type should be -1, 0 or 1"))
+		}
+	}
+
+	position := matchKey(key, values, matchType)
+	if position < 0 {
+		panic(model.NewFormulaError("$MATCH", 0, model.ErrorKindRuntime, fmt.Sprintf("%v not found", key)))
+	}
+
+	return vm.ToVMValue(position + 1)
+}
+
+func fTable(fs DefaultBuiltInFunctions, vm VM, funcDef interface{}) interface{} {
+
+	t := fs.getTable("$TABLE", vm, funcDef, 0)
+
+	if vm.GetFuncArgsCount(funcDef) > 1 {
+		return vm.ToVMValue(t.columnValues(getColumn("$TABLE", vm, funcDef, 1, t)))
+	}
+
+	rows := make([]map[string]interface{}, t.Len())
+	for i, row := range t.rows {
+		rows[i] = make(map[string]interface{}, len(t.columns))
+		for j, column := range t.columns {
+			rows[i][column] = row[j]
+		}
+	}
+
+	return vm.ToVMValue(rows)
+}
@@ -0,0 +1,108 @@
+package vm_test
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lertrel/goforit/builder"
+	"github.com/lertrel/goforit/model"
+	"github.com/lertrel/goforit/vm"
+)
+
+func TestLookupFunctions(t *testing.T) {
+
+	dir := t.TempDir()
+
+	files := map[string]string{
+		"plans.csv": `plan,name,premium,active
+# Discontinued plans are kept for renewals
+A,Basic,1000,true
+B,Plus,1500.5,false
+C,Max,2500,
+`,
+		"ages.json": `[
+			{"age": 0, "rate": 1.1},
+			{"age": 20, "rate": 1.5},
+			{"age": 40, "rate": 2.5, "note": "senior"}
+		]`,
+		"tax.json": `{
+			"columns": ["from", "rate"],
+			"rows": [[0, 0], [150000, 0.05], [300000, 0.1], [500000, 0.15]]
+		}`,
+		"README.txt": "not a table",
+	}
+
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tables, err := vm.LoadTableRepository(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := tables.TableNames(); strings.Join(names, ",") != "ages,plans,tax" {
+		t.Errorf("Expect %v but got %v\n", "ages,plans,tax", names)
+	}
+
+	override := vm.NewTableRepository()
+	table, err := vm.NewTable([]string{"plan", "premium"}, [][]interface{}{{"A", 900.0}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	override.RegisterTable("promotions", table)
+
+	f := builder.NewFormulaBuilder().
+		AddTableRepository(tables).
+		AddTableRepository(override).
+		Get()
+
+	runScriptTests(t, f, []scriptTest{
+		{"$VLOOKUP('B', 'plans', 'premium')", "1500.5"},
+		{"$VLOOKUP('b', 'plans', 'name')", "Plus"},
+		{"$VLOOKUP('A', 'plans', 4)", "true"},
+		{"$VLOOKUP('C', 'plans', 'active')", "undefined"},
+		{"$VLOOKUP('A', 'promotions', 'premium')", "900"},
+		{"$VLOOKUP(35, 'ages', 'rate', true)", "1.5"},
+		{"$VLOOKUP(40, 'ages', 'rate', true)", "2.5"},
+		{"$VLOOKUP('20', 'ages', 'rate')", "1.5"},
+		{"$IFERROR($VLOOKUP('X', 'plans', 'premium'), 0)", "0"},
+		{"$BRACKET(400000, 'tax', 'rate')", "17500"},
+		{"$BRACKET(600000, 'tax', 2)", "42500"},
+		{"$BRACKET(100000, 'tax', 'rate')", "0"},
+		{"$INDEX('plans', 2, 'name')", "Plus"},
+		{"$INDEX('plans', 3)", "C"},
+		{"$INDEX([[1, 2], [3, 4]], 2, 1)", "3"},
+		{"$INDEX(['a', 'b'], 2)", "b"},
+		{"$MATCH('C', 'plans')", "3"},
+		{"$MATCH('Plus', 'plans', 'name')", "2"},
+		{"$MATCH(35, 'ages', 'age', 1)", "2"},
+		{"$MATCH(35, [20, 30, 40], 1)", "2"},
+		{"$MATCH(35, [50, 40, 30], -1)", "2"},
+		{"$MATCH('b', ['A', 'B'])", "2"},
+		{"$TABLE('plans').length", "3"},
+		{"$TABLE('ages')[2].note", "senior"},
+		{"JSON.stringify($TABLE('plans')[0])", `{"active":true,"name":"Basic","plan":"A","premium":1000}`},
+		{"$SUMF($TABLE('plans', 'premium'))", "5000.5"},
+	})
+
+	runErrorTests(t, f, []errorTest{
+		{"$VLOOKUP('X', 'plans', 'premium')", model.ErrorKindRuntime},
+		{"$VLOOKUP(-5, 'ages', 'rate', true)", model.ErrorKindRuntime},
+		{"$VLOOKUP('A', 'unknown', 'premium')", model.ErrorKindRange},
+		{"$VLOOKUP('A', 'plans', 'unknown')", model.ErrorKindRange},
+		{"$VLOOKUP('A', 'plans', 5)", model.ErrorKindRange},
+		{"$BRACKET(1000, 'plans', 'premium')", model.ErrorKindRuntime},
+		{"$INDEX('plans', 4)", model.ErrorKindRange},
+		{"$INDEX([1, 2], 1, 1)", model.ErrorKindType},
+		{"$MATCH(1, [1], 2)", model.ErrorKindRange},
+		{"$MATCH(5, [1, 2])", model.ErrorKindRuntime},
+	})
+
+	if _, err := vm.LoadTableCSV(strings.NewReader("a,b\n1,2,3\n")); err == nil {
+		t.Error("Expect an error of a row having too many values")
+	}
+}
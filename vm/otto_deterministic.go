@@ -0,0 +1,134 @@
+package vm
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"github.com/lertrel/goforit/model"
+	"github.com/robertkrimen/otto"
+)
+
+//ottoDeterminism random numbers and the clock of a deterministic OttoVM
+type ottoDeterminism struct {
+	clock model.Clock
+	//seed the seed of the current (or the last) run
+	seed   int64
+	random *rand.Rand
+}
+
+//ottoFixedDate replacing Date of otto with a constructor reading the
+//current time from the given function, the original Date is kept as the
+//prototype, so instanceof Date and Date.prototype still work
+const ottoFixedDate = `(function(OriginalDate, now) {
+	function FixedDate(a, b, c, d, e, f, g) {
+		if (!(this instanceof FixedDate)) {
+			return new OriginalDate(now()).toString();
+		}
+		switch (arguments.length) {
+		case 0: return new OriginalDate(now());
+		case 1: return new OriginalDate(a);
+		case 2: return new OriginalDate(a, b);
+		case 3: return new OriginalDate(a, b, c);
+		case 4: return new OriginalDate(a, b, c, d);
+		case 5: return new OriginalDate(a, b, c, d, e);
+		case 6: return new OriginalDate(a, b, c, d, e, f);
+		default: return new OriginalDate(a, b, c, d, e, f, g);
+		}
+	}
+	FixedDate.prototype = OriginalDate.prototype;
+	FixedDate.parse = OriginalDate.parse;
+	FixedDate.UTC = OriginalDate.UTC;
+	FixedDate.now = function() { return now(); };
+	return FixedDate;
+})`
+
+//SetDeterministic making every subsequent run reproducible, Math.random
+//and $RAND are drawn from a PRNG seeded per run by the seed carried by
+//ctx (model.WithSeed) or a newly generated one, and Date.now and
+//new Date() are reading the given clock (model.SystemClock if nil)
+func (v OttoVM) SetDeterministic(clock model.Clock) error {
+
+	if clock == nil {
+		clock = model.SystemClock
+	}
+
+	//Date.prototype.constructor is the original Date even after being
+	//replaced (e.g., in a copy of a deterministic VM)
+	original, err := v.vm.Run("Date.prototype.constructor")
+	if err != nil {
+		return err
+	}
+
+	factory, err := v.vm.Run(ottoFixedDate)
+	if err != nil {
+		return err
+	}
+
+	state := v.state
+	now := func(call otto.FunctionCall) otto.Value {
+		millis := float64(state.deterministic.clock.Now().UnixNano() / int64(time.Millisecond))
+		value, _ := otto.ToValue(millis)
+		return value
+	}
+
+	fixedDate, err := factory.Call(otto.UndefinedValue(), original, now)
+	if err != nil {
+		return err
+	}
+
+	if err = v.vm.Set("Date", fixedDate); err != nil {
+		return err
+	}
+
+	seed := model.NewSeed()
+	v.state.deterministic = &ottoDeterminism{clock: clock, seed: seed, random: rand.New(rand.NewSource(seed))}
+	v.bindRandomSource()
+
+	return nil
+}
+
+//bindRandomSource drawing Math.random of the current VM from
+//the PRNG of the current run
+func (v OttoVM) bindRandomSource() {
+
+	state := v.state
+	v.vm.SetRandomSource(func() float64 {
+		return state.deterministic.random.Float64()
+	})
+}
+
+//reseed seeding the PRNG for a run by the seed carried by ctx,
+//or by a newly generated one
+func (v OttoVM) reseed(ctx context.Context) {
+
+	seed, found := model.Seed(ctx)
+	if !found {
+		seed = model.NewSeed()
+	}
+
+	v.state.deterministic.seed = seed
+	v.state.deterministic.random = rand.New(rand.NewSource(seed))
+}
+
+//Seed getting the random seed of the current (or the last) run,
+//zero if the VM isn't deterministic
+func (v OttoVM) Seed() int64 {
+
+	if v.state.deterministic == nil {
+		return 0
+	}
+
+	return v.state.deterministic.seed
+}
+
+//Random getting the next random number in [0, 1) of the current run,
+//the same sequence as Math.random
+func (v OttoVM) Random() float64 {
+
+	if v.state.deterministic == nil {
+		return rand.Float64()
+	}
+
+	return v.state.deterministic.random.Float64()
+}
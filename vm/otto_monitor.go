@@ -0,0 +1,84 @@
+package vm
+
+import (
+	"context"
+
+	"github.com/lertrel/goforit/model"
+	"github.com/robertkrimen/otto"
+)
+
+//ottoMonitor watching a running otto VM
+//
+//otto polls its Interrupt channel before evaluating every statement and
+//expression, so the monitor puts itself into the channel and re-arms itself
+//every time it's polled, that allows the monitor to count steps and to check
+//if the execution should be interrupted without spawning another goroutine
+type ottoMonitor struct {
+	ctx       context.Context
+	limits    model.Limits
+	interrupt chan func()
+	check     func()
+	steps     int64
+}
+
+//ottoInterruption a panic value raised by ottoMonitor to unwind otto
+type ottoInterruption struct {
+	err error
+}
+
+func newOttoMonitor(ctx context.Context, limits model.Limits) *ottoMonitor {
+
+	m := &ottoMonitor{
+		ctx:       ctx,
+		limits:    limits,
+		interrupt: make(chan func(), 1),
+	}
+	m.check = m.poll
+
+	return m
+}
+
+//needOttoMonitor telling if a run under the given ctx and limits
+//has to be watched by ottoMonitor
+func needOttoMonitor(ctx context.Context, limits model.Limits) bool {
+
+	return ctx.Done() != nil || limits.MaxSteps > 0
+}
+
+//attach installing the monitor into the given VM
+func (m *ottoMonitor) attach(vm *otto.Otto) {
+
+	m.interrupt <- m.check
+	vm.Interrupt = m.interrupt
+}
+
+//detach removing the monitor from the given VM
+func (m *ottoMonitor) detach(vm *otto.Otto) {
+
+	vm.Interrupt = nil
+
+	select {
+	case <-m.interrupt:
+	default:
+	}
+}
+
+func (m *ottoMonitor) poll() {
+
+	select {
+	case <-m.ctx.Done():
+		panic(ottoInterruption{&model.InterruptedError{Err: m.ctx.Err()}})
+	default:
+	}
+
+	m.steps++
+
+	if m.limits.MaxSteps > 0 && m.steps > m.limits.MaxSteps {
+		panic(ottoInterruption{&model.LimitError{
+			Limit: model.LimitSteps,
+			Max:   uint64(m.limits.MaxSteps),
+		}})
+	}
+
+	m.interrupt <- m.check
+}
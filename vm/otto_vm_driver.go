@@ -1,50 +1,94 @@
 package vm
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/lertrel/goforit/model"
 	"github.com/lertrel/goforit/parse"
 	"github.com/robertkrimen/otto"
+	"github.com/robertkrimen/otto/ast"
 )
 
 // var r, _ = regexp.Compile("(\\$[^\\$()\\s]+)\\(")
 var r = parse.New()
 
+var backgroundContext = context.Background()
+
+var compiler struct {
+	once sync.Once
+	vm   *otto.Otto
+}
+
+//ottoCompiler getting an otto instance used only for compiling scripts,
+//compiling is stateless so the instance is safe for concurrent use
+func ottoCompiler() *otto.Otto {
+
+	compiler.once.Do(func() {
+		compiler.vm = otto.New()
+	})
+
+	return compiler.vm
+}
+
 //OttoDriver otto implementation of VMDriver
 type OttoDriver struct {
 	templateVM VM
 	// funcs      map[int]BuiltInFunctions
+	mutex sync.RWMutex
 }
 
 //Get getting VM implementation of this driver
-func (d OttoDriver) Get() (VM, error) {
+func (d *OttoDriver) Get() (VM, error) {
+
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
 
 	if d.templateVM != nil {
 
 		nativeVM := d.templateVM.(OttoVM)
 
 		// return OttoVM{vm: nativeVM.vm.Copy(), funcs: nativeVM.funcs}, nil
-		return OttoVM{vm: nativeVM.vm.Copy()}, nil
+		return nativeVM.copy(), nil
 	}
 
 	//Falls through
 	// return OttoVM{vm: otto.New(), funcs: d.funcs}, nil
-	return OttoVM{vm: otto.New()}, nil
+	return newOttoVM(otto.New()), nil
 }
 
 //SetTemplate set template VM, this VM will be used for cloning
-//another VM to reduce constructing overhead
+//another VM to reduce constructing overhead, nil for removing
+//the current template
 func (d *OttoDriver) SetTemplate(template VM) {
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
 	d.templateVM = template
 }
 
+//Compile parsing the given script/formula once into *otto.Script,
+//which can be run by any VM of this driver through VM.RunCompiled
+func (d *OttoDriver) Compile(formulaString string) (interface{}, error) {
+
+	return ottoCompiler().Compile("", formulaString)
+}
+
 //ExtractFunctionNames extracting functions names
 //from the given script/formular so that the function can be loaded
 //by Formula.LoadContext() before being executed, otherwise the
 //unloaded functions will not be known to the scripting/VM engine
-func (d OttoDriver) ExtractFunctionNames(formulaStr string) []string {
+func (d *OttoDriver) ExtractFunctionNames(formulaStr string) []string {
 
 	return r.ExtractFunctionNames(formulaStr)
 	// matches := r.FindAllStringSubmatch(formulaStr, -1)
@@ -69,19 +113,169 @@ func (d OttoDriver) ExtractFunctionNames(formulaStr string) []string {
 type OttoVM struct {
 	vm *otto.Otto
 	// funcs map[int]BuiltInFunctions
+	state *ottoState
+}
+
+//ottoState mutable states shared by all copies of the same OttoVM
+type ottoState struct {
+	limits model.Limits
+	//ctx given to the current run
+	ctx context.Context
+	//builtIns built-in functions registered into the VM
+	builtIns map[string][]BuiltInFunctions
+	//deterministic random numbers and the clock if SetDeterministic is called
+	deterministic *ottoDeterminism
+}
+
+func newOttoVM(vm *otto.Otto) OttoVM {
+
+	return OttoVM{vm: vm, state: &ottoState{builtIns: make(map[string][]BuiltInFunctions)}}
+}
+
+//copy cloning the current VM (including loaded functions)
+func (v OttoVM) copy() OttoVM {
+
+	c := newOttoVM(v.vm.Copy())
+
+	//Built-in functions copied from the current VM are still bound to
+	//the current VM, so they have to be re-bound to the new one
+	for funcName, funcs := range v.state.builtIns {
+		c.setBuiltInFunc(funcName, funcs)
+	}
+
+	//So do the random numbers and the clock
+	if v.state.deterministic != nil {
+		if err := c.SetDeterministic(v.state.deterministic.clock); err != nil {
+			panic(err)
+		}
+	}
+
+	return c
+}
+
+//Copy cloning the VM including variables and loaded functions
+func (v OttoVM) Copy() (VM, error) {
+
+	return v.copy(), nil
 }
 
 //Run for running a given script/formual
 func (v OttoVM) Run(formulaString string) (model.Value, error) {
 
-	value, err := v.vm.Run(formulaString)
+	return v.RunContext(backgroundContext, formulaString)
+}
+
+//RunContext for running a given script/formula, the execution will be
+//interrupted with *model.InterruptedError once the given ctx is done
+//
+//The execution will also be aborted with *model.LimitError once any
+//limit given by SetLimits is hit
+func (v OttoVM) RunContext(ctx context.Context, formulaString string) (model.Value, error) {
+
+	return v.run(ctx, formulaString)
+}
+
+//RunCompiled the same as RunContext, but running *otto.Script
+//compiled by OttoDriver.Compile, or a syntax tree (*ast.Program)
+//e.g., of parse.ThunkLazyArguments
+func (v OttoVM) RunCompiled(ctx context.Context, program interface{}) (model.Value, error) {
+
+	switch program.(type) {
+	case *otto.Script, *ast.Program:
+		return v.run(ctx, program)
+	}
+
+	return NewValue(nil, nil), fmt.Errorf("OttoVM.RunCompiled() - expecting *otto.Script but got %T", program)
+}
+
+//run running either a script (string), *otto.Script or *ast.Program
+func (v OttoVM) run(ctx context.Context, src interface{}) (value model.Value, err error) {
+
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return NewValue(nil, nil), &model.InterruptedError{Err: ctxErr}
+	}
+
+	v.state.ctx = ctx
+	defer func() { v.state.ctx = nil }()
+
+	if v.state.deterministic != nil {
+		v.reseed(ctx)
+	}
+
+	limits := v.state.limits
+
+	if limits.MaxCallDepth > 0 {
+		//otto counts the global scope as the first level
+		v.vm.SetStackDepthLimit(limits.MaxCallDepth + 1)
+		defer v.vm.SetStackDepthLimit(0)
+	}
+
+	var m *ottoMonitor
+
+	if needOttoMonitor(ctx, limits) {
+		m = newOttoMonitor(ctx, limits)
+		m.attach(v.vm)
+	}
+
+	//Errors raised by built-in functions and by the monitor are not
+	//recognized by otto, so they are unwinding otto as Go panics
+	defer func() {
+		if m != nil {
+			m.detach(v.vm)
+		}
+
+		if caught := recover(); caught != nil {
+			switch caught := caught.(type) {
+
+			case ottoInterruption:
+				value, err = NewValue(nil, nil), caught.err
+			case *model.FormulaError:
+				value, err = NewValue(nil, nil), caught
+			default:
+				panic(caught)
+
+			}
+		}
+	}()
+
+	jsValue, err := v.vm.Run(src)
 	if err != nil {
+		if limits.MaxCallDepth > 0 && isOttoStackOverflow(err) {
+			err = &model.LimitError{
+				Limit: model.LimitCallDepth,
+				Max:   uint64(limits.MaxCallDepth),
+			}
+		}
+
 		return NewValue(nil, nil), err
 	}
 
 	//Falls through
 	// return JSValue{impl: value}, nil
-	return NewValue(v, value), nil
+	return NewValue(v, jsValue), nil
+}
+
+//Context getting ctx given to the current run,
+//context.Background() if it's not running
+func (v OttoVM) Context() context.Context {
+
+	if v.state.ctx == nil {
+		return context.Background()
+	}
+
+	return v.state.ctx
+}
+
+//SetLimits setting resource budgets applied to every subsequent run
+func (v OttoVM) SetLimits(limits model.Limits) {
+
+	v.state.limits = limits
+}
+
+//Limits getting resource budgets applied to every run
+func (v OttoVM) Limits() model.Limits {
+
+	return v.state.limits
 }
 
 //Get getting value of a variable out of scripting context
@@ -98,9 +292,19 @@ func (v OttoVM) Get(varname string) (model.Value, error) {
 	return NewValue(v, value), nil
 }
 
-//Set setting value of a valiable inside scripting context
+//Set setting value of a valiable inside scripting context,
+//*big.Rat is set as a decimal string, and time.Time as a date-time string
 func (v OttoVM) Set(varname string, value interface{}) error {
 
+	switch goValue := value.(type) {
+	case *big.Rat:
+		if goValue != nil {
+			value = model.FormatDecimal(goValue)
+		}
+	case time.Time:
+		value = model.FormatDateTime(goValue)
+	}
+
 	err := v.vm.Set(varname, value)
 	if err != nil {
 		return err
@@ -110,6 +314,37 @@ func (v OttoVM) Set(varname string, value interface{}) error {
 	return nil
 }
 
+//Globals getting names of all (user-visible) global variables
+//inside scripting context, including loaded functions
+func (v OttoVM) Globals() ([]string, error) {
+
+	global, err := v.vm.Object("this")
+	if err != nil {
+		return nil, err
+	}
+
+	return global.Keys(), nil
+}
+
+//Unset removing the given global variables from scripting context
+func (v OttoVM) Unset(varnames ...string) error {
+
+	if len(varnames) == 0 {
+		return nil
+	}
+
+	//Variables declared by var are not deletable, so they are reset instead
+	_, err := v.vm.Call(`(function(names) {
+		for (var i = 0; i < names.length; i++) {
+			if (!delete this[names[i]]) {
+				this[names[i]] = undefined;
+			}
+		}
+	})`, nil, varnames)
+
+	return err
+}
+
 //ValidateFuncArguments validting if a given scripting function has
 //number of arguments equal to the given cnt
 func (v OttoVM) ValidateFuncArguments(funcName string, cnt int, funcDef interface{}) {
@@ -149,17 +384,70 @@ func (v OttoVM) GetFuncArgAsBoolean(funcDef interface{}, index int) bool {
 	return getJSBoolean(funcDef.(otto.FunctionCall), index)
 }
 
+//GetFuncArgAsDecimal getting function argument refering by the index
+//as an exact number
+func (v OttoVM) GetFuncArgAsDecimal(funcDef interface{}, index int) *big.Rat {
+
+	return getJSDecimal(funcDef.(otto.FunctionCall), index)
+}
+
+//GetFuncArgAsTime getting function argument refering by the index as time
+func (v OttoVM) GetFuncArgAsTime(funcDef interface{}, index int, loc *time.Location) time.Time {
+
+	return getJSTime(funcDef.(otto.FunctionCall), index, loc)
+}
+
+//GetFuncArgAsArray getting function argument refering by the index
+//as elements of an array
+func (v OttoVM) GetFuncArgAsArray(funcDef interface{}, index int) []interface{} {
+
+	return getJSArray(funcDef.(otto.FunctionCall), index)
+}
+
 //GetFuncArgAsIs getting function argument refering by the index as raw type
 //depending on each scripting/VM engine e.g., otto.Value for otto
 func (v OttoVM) GetFuncArgAsIs(funcDef interface{}, index int) interface{} {
 
-	return funcDef.(otto.FunctionCall).ArgumentList[index]
+	return getJSArg(funcDef.(otto.FunctionCall), index)
+}
+
+//EvaluateFuncArg the same as GetFuncArgAsIs, but an error raised while
+//evaluating a lazy argument is returned rather than propagated
+func (v OttoVM) EvaluateFuncArg(funcDef interface{}, index int) (value interface{}, err error) {
+
+	call := funcDef.(otto.FunctionCall)
+
+	if index >= len(call.ArgumentList) {
+		panic(model.NewFormulaError("", index, model.ErrorKindArity, "missing argument"))
+	}
+
+	defer func() {
+		if caught := recover(); caught != nil {
+			formulaErr, ok := caught.(*model.FormulaError)
+			if !ok {
+				panic(caught)
+			}
+			err = formulaErr
+		}
+	}()
+
+	jsValue, err := evaluateJSArg(call, index)
+	if err != nil && isOttoStackOverflow(err) {
+		//Not to hide call depth limit
+		panic(toJSException(call, err))
+	}
+
+	return jsValue, err
 }
 
 //ToVMValue converting go variable into scriing/VM value e.g., otto.Value for otto
+//
+//Slices, maps (of string keys) and structs (having exported fields) are
+//converted into JS arrays and objects, struct fields are named by their
+//json tags (if any), and map keys are sorted
 func (v OttoVM) ToVMValue(goValue interface{}) interface{} {
 
-	jsResult, err := v.vm.ToValue(goValue)
+	jsResult, err := v.toJSValue(goValue)
 	if err != nil {
 		panic(err)
 	}
@@ -167,6 +455,131 @@ func (v OttoVM) ToVMValue(goValue interface{}) interface{} {
 	return jsResult
 }
 
+func (v OttoVM) toJSValue(goValue interface{}) (otto.Value, error) {
+
+	switch goValue := goValue.(type) {
+	case nil, otto.Value, *otto.Object:
+		return v.vm.ToValue(goValue)
+	case *big.Rat:
+		if goValue == nil {
+			return otto.NullValue(), nil
+		}
+		return v.vm.ToValue(model.FormatDecimal(goValue))
+	case time.Time:
+		return v.vm.ToValue(model.FormatDateTime(goValue))
+	}
+
+	rv := reflect.ValueOf(goValue)
+	if rv.Kind() == reflect.Ptr && !rv.IsNil() && rv.Elem().Kind() == reflect.Struct {
+		rv = rv.Elem()
+	}
+
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		if rv.Kind() == reflect.Slice && rv.IsNil() {
+			return otto.NullValue(), nil
+		}
+
+		array, err := v.newJSObject("Array")
+		if err != nil {
+			return otto.UndefinedValue(), err
+		}
+
+		for i := 0; i < rv.Len(); i++ {
+			elem, err := v.toJSValue(rv.Index(i).Interface())
+			if err != nil {
+				return otto.UndefinedValue(), err
+			}
+			if _, err = array.Call("push", elem); err != nil {
+				return otto.UndefinedValue(), err
+			}
+		}
+
+		return array.Value(), nil
+
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			break
+		}
+		if rv.IsNil() {
+			return otto.NullValue(), nil
+		}
+
+		object, err := v.newJSObject("Object")
+		if err != nil {
+			return otto.UndefinedValue(), err
+		}
+
+		//Keys are sorted, so the order of properties is deterministic
+		keys := rv.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+
+		for _, key := range keys {
+			if err = v.setJSProperty(object, key.String(), rv.MapIndex(key).Interface()); err != nil {
+				return otto.UndefinedValue(), err
+			}
+		}
+
+		return object.Value(), nil
+
+	case reflect.Struct:
+		var object *otto.Object
+
+		for i := 0; i < rv.NumField(); i++ {
+
+			name, ok := goFieldName(rv.Type().Field(i))
+			if !ok {
+				continue
+			}
+
+			if object == nil {
+				var err error
+				if object, err = v.newJSObject("Object"); err != nil {
+					return otto.UndefinedValue(), err
+				}
+			}
+
+			if err := v.setJSProperty(object, name, rv.Field(i).Interface()); err != nil {
+				return otto.UndefinedValue(), err
+			}
+		}
+
+		//Structs without exported fields are left to otto
+		if object != nil {
+			return object.Value(), nil
+		}
+	}
+
+	return v.vm.ToValue(goValue)
+}
+
+//newJSObject creating a new object by calling the given constructor
+//(e.g., Array or Object) as a function
+func (v OttoVM) newJSObject(constructor string) (*otto.Object, error) {
+
+	ctor, err := v.vm.Get(constructor)
+	if err != nil {
+		return nil, err
+	}
+
+	object, err := ctor.Call(otto.UndefinedValue())
+	if err != nil {
+		return nil, err
+	}
+
+	return object.Object(), nil
+}
+
+func (v OttoVM) setJSProperty(object *otto.Object, name string, goValue interface{}) error {
+
+	value, err := v.toJSValue(goValue)
+	if err != nil {
+		return err
+	}
+
+	return object.Set(name, value)
+}
+
 //GetBuiltInFunc getting a function for registering / connecting
 func (v OttoVM) GetBuiltInFunc(funcName string, funcs []BuiltInFunctions) func(context *model.FormulaContext) {
 
@@ -183,19 +596,7 @@ func (v OttoVM) GetBuiltInFunc(funcName string, funcs []BuiltInFunctions) func(c
 				// 	panic(errors.New("The given FormulaContext does not connect to the current OttoVM"))
 				// }
 
-				v.vm.Set(funcName, func(call otto.FunctionCall) otto.Value {
-
-					// for _, f := range v.funcs {
-					for _, f := range funcs {
-						result, found := f.Execute(funcName, v, call)
-
-						if found {
-							return v.ToVMValue(result).(otto.Value)
-						}
-					}
-
-					panic(errors.New("Runtime error: Function not found - " + funcName))
-				})
+				v.setBuiltInFunc(funcName, funcs)
 			}
 		}
 	}
@@ -204,6 +605,27 @@ func (v OttoVM) GetBuiltInFunc(funcName string, funcs []BuiltInFunctions) func(c
 	return nil
 }
 
+func (v OttoVM) setBuiltInFunc(funcName string, funcs []BuiltInFunctions) {
+
+	v.state.builtIns[funcName] = funcs
+
+	v.vm.Set(funcName, func(call otto.FunctionCall) otto.Value {
+
+		defer recoverFormulaError(funcName, call)
+
+		// for _, f := range v.funcs {
+		for _, f := range funcs {
+			result, found := f.Execute(funcName, v, call)
+
+			if found {
+				return v.ToVMValue(result).(otto.Value)
+			}
+		}
+
+		panic(model.NewFormulaError(funcName, -1, model.ErrorKindRuntime, "function not found"))
+	})
+}
+
 //IsDefined check if the current JS value is defined
 func (v OttoVM) IsDefined(vmValue interface{}) bool {
 
@@ -264,6 +686,12 @@ func (v OttoVM) IsFunction(vmValue interface{}) bool {
 	return vmValue.(otto.Value).IsFunction()
 }
 
+//IsArray check if the current JS value is array (including Go slices and arrays)
+func (v OttoVM) IsArray(vmValue interface{}) bool {
+
+	return isJSArray(vmValue.(otto.Value))
+}
+
 //ToBoolean get value as bool
 func (v OttoVM) ToBoolean(vmValue interface{}) (bool, error) {
 
@@ -288,26 +716,175 @@ func (v OttoVM) ToString(vmValue interface{}) (string, error) {
 	return vmValue.(otto.Value).ToString()
 }
 
+//ToArray get elements of an array
+func (v OttoVM) ToArray(vmValue interface{}) ([]interface{}, error) {
+
+	return toJSArray(vmValue.(otto.Value))
+}
+
+//ToDecimal get value as an exact number
+func (v OttoVM) ToDecimal(vmValue interface{}) (*big.Rat, error) {
+
+	return toDecimal(vmValue.(otto.Value))
+}
+
+//ToTime get value as time
+func (v OttoVM) ToTime(vmValue interface{}, loc *time.Location) (time.Time, error) {
+
+	return toTime(vmValue.(otto.Value), loc)
+}
+
 //Export js value to Go value type as specified in a given interface
 func (v OttoVM) Export(vmValue interface{}) (interface{}, error) {
 
 	return vmValue.(otto.Value).Export()
 }
 
+//isOttoStackOverflow telling if the given error is raised by otto
+//because of exceeding its stack depth limit
+func isOttoStackOverflow(err error) bool {
+
+	jsErr, ok := err.(*otto.Error)
+
+	return ok && strings.Contains(jsErr.Error(), "Maximum call stack size exceeded")
+}
+
 func validateJSFuncArguments(funcName string, cnt int, call otto.FunctionCall) {
 
 	if len(call.ArgumentList) != cnt {
-		errMsg := fmt.Sprintf("%s - wrong number of arguments (expecting %d)", funcName, cnt)
-		panic(errors.New(errMsg))
+		errMsg := fmt.Sprintf("wrong number of arguments (expecting %d)", cnt)
+		panic(model.NewFormulaError(funcName, -1, model.ErrorKindArity, errMsg))
+	}
+
+}
+
+//recoverFormulaError (deferred by every built-in function) converting
+//a panic raised by a built-in function into *model.FormulaError
+//carrying the function name and the position of the calling script
+func recoverFormulaError(funcName string, call otto.FunctionCall) {
+
+	caught := recover()
+	if caught == nil {
+		return
+	}
+
+	var formulaErr *model.FormulaError
+
+	switch caught := caught.(type) {
+
+	case *model.FormulaError:
+		formulaErr = caught
+	case *otto.Error:
+		panic(caught)
+	case error:
+		formulaErr = model.NewFormulaError(funcName, -1, model.ErrorKindRuntime, caught.Error())
+		formulaErr.Err = caught
+	case string:
+		formulaErr = model.NewFormulaError(funcName, -1, model.ErrorKindRuntime, caught)
+	default:
+		//otto's own exceptions, interruptions, etc.
+		panic(caught)
+
+	}
+
+	if formulaErr.Function == "" {
+		formulaErr.Function = funcName
+	}
+
+	if formulaErr.Line == 0 {
+		ctx := call.Otto.Context()
+		formulaErr.Line = ctx.Line
+		formulaErr.Column = ctx.Column
+	}
+
+	panic(formulaErr)
+}
+
+func getJSArg(call otto.FunctionCall, index int) otto.Value {
+
+	if index >= len(call.ArgumentList) {
+		panic(model.NewFormulaError("", index, model.ErrorKindArity, "missing argument"))
+	}
+
+	value, err := evaluateJSArg(call, index)
+	if err != nil {
+		panic(toJSException(call, err))
+	}
+
+	return value
+}
+
+//evaluateJSArg evaluating the argument at the given index if it's a thunk
+//(a lazy argument wrapped by parse.ThunkLazyArguments), the result replaces
+//the thunk so it's evaluated only once
+func evaluateJSArg(call otto.FunctionCall, index int) (otto.Value, error) {
+
+	arg := call.ArgumentList[index]
+	if !isJSThunk(arg) {
+		return arg, nil
+	}
+
+	value, err := arg.Call(otto.UndefinedValue())
+	if err != nil {
+		return otto.UndefinedValue(), err
+	}
+
+	call.ArgumentList[index] = value
+
+	return value, nil
+}
+
+func isJSThunk(value otto.Value) bool {
+
+	if !value.IsFunction() {
+		return false
+	}
+
+	name, err := value.Object().Get("name")
+
+	//A thunk bound to this of its enclosing function is named bound <name>
+	return err == nil && name.IsString() && strings.TrimPrefix(name.String(), "bound ") == parse.ThunkName
+}
+
+//toJSException converting an error raised by evaluating a thunk back into
+//a JS exception (to be panicked), so it can be caught by try/catch
+func toJSException(call otto.FunctionCall, err error) otto.Value {
+
+	jsErr, ok := err.(*otto.Error)
+	if !ok {
+		value, _ := call.Otto.ToValue(err.Error())
+		return value
+	}
+
+	//e.g., TypeError: 'x' is not a function
+	parts := strings.SplitN(jsErr.Error(), ": ", 2)
+	if len(parts) < 2 {
+		return call.Otto.MakeCustomError("Error", jsErr.Error())
 	}
 
+	switch parts[0] {
+	case "TypeError":
+		return call.Otto.MakeTypeError(parts[1])
+	case "RangeError":
+		return call.Otto.MakeRangeError(parts[1])
+	case "SyntaxError":
+		return call.Otto.MakeSyntaxError(parts[1])
+	default:
+		return call.Otto.MakeCustomError(parts[0], parts[1])
+	}
 }
 
 func getJSFloat(call otto.FunctionCall, index int) float64 {
 
-	v, err := call.ArgumentList[index].ToFloat()
+	arg := getJSArg(call, index)
+
+	v, err := arg.ToFloat()
 	if err != nil {
-		panic(err)
+		panic(newJSTypeError(index, err))
+	}
+
+	if math.IsNaN(v) && !arg.IsNumber() {
+		panic(model.NewFormulaError("", index, model.ErrorKindType, "expecting a number but got "+arg.String()))
 	}
 
 	return v
@@ -315,19 +892,136 @@ func getJSFloat(call otto.FunctionCall, index int) float64 {
 
 func getJSInt(call otto.FunctionCall, index int) int64 {
 
+	getJSFloat(call, index)
+
 	v, err := call.ArgumentList[index].ToInteger()
 	if err != nil {
-		panic(err)
+		panic(newJSTypeError(index, err))
+	}
+
+	return v
+}
+
+func getJSArray(call otto.FunctionCall, index int) []interface{} {
+
+	v, err := toJSArray(getJSArg(call, index))
+	if err != nil {
+		panic(newJSTypeError(index, err))
+	}
+
+	return v
+}
+
+func isJSArray(value otto.Value) bool {
+
+	class := value.Class()
+
+	return class == "Array" || class == "GoArray"
+}
+
+func toJSArray(value otto.Value) ([]interface{}, error) {
+
+	if !isJSArray(value) {
+		return nil, fmt.Errorf("expecting an array but got %s", value.String())
+	}
+
+	object := value.Object()
+
+	length, err := object.Get("length")
+	if err != nil {
+		return nil, err
+	}
+
+	n, err := length.ToInteger()
+	if err != nil {
+		return nil, err
+	}
+
+	elements := make([]interface{}, n)
+	for i := range elements {
+		if elements[i], err = object.Get(strconv.Itoa(i)); err != nil {
+			return nil, err
+		}
+	}
+
+	return elements, nil
+}
+
+func getJSDecimal(call otto.FunctionCall, index int) *big.Rat {
+
+	v, err := toDecimal(getJSArg(call, index))
+	if err != nil {
+		panic(newJSTypeError(index, err))
 	}
 
 	return v
 }
 
+func toDecimal(value otto.Value) (*big.Rat, error) {
+
+	switch {
+	case value.IsNumber():
+		f, err := value.ToFloat()
+		if err != nil {
+			return nil, err
+		}
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil, fmt.Errorf("expecting a decimal but got %v", f)
+		}
+		return model.ParseDecimal(strconv.FormatFloat(f, 'g', -1, 64))
+	case value.IsString():
+		return model.ParseDecimal(value.String())
+	}
+
+	return nil, fmt.Errorf("expecting a decimal but got %s", value.String())
+}
+
+func getJSTime(call otto.FunctionCall, index int, loc *time.Location) time.Time {
+
+	v, err := toTime(getJSArg(call, index), loc)
+	if err != nil {
+		panic(newJSTypeError(index, err))
+	}
+
+	return v
+}
+
+func toTime(value otto.Value, loc *time.Location) (time.Time, error) {
+
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	ms := value
+	if value.Class() == "Date" {
+		var err error
+		if ms, err = value.Object().Call("getTime"); err != nil {
+			return time.Time{}, err
+		}
+	}
+
+	switch {
+	case ms.IsNumber():
+		f, err := ms.ToFloat()
+		if err != nil {
+			return time.Time{}, err
+		}
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return time.Time{}, errors.New("invalid date")
+		}
+		return time.Unix(0, int64(f)*int64(time.Millisecond)).In(loc), nil
+	case value.IsString():
+		return model.ParseTime(value.String(), loc)
+	}
+
+	return time.Time{}, fmt.Errorf("expecting a date but got %s", value.String())
+}
+
 func getJSString(call otto.FunctionCall, index int) string {
 
-	v, err := call.ArgumentList[index].ToString()
+	v, err := getJSArg(call, index).ToString()
 	if err != nil {
-		panic(err)
+		panic(newJSTypeError(index, err))
 	}
 
 	return v
@@ -335,14 +1029,22 @@ func getJSString(call otto.FunctionCall, index int) string {
 
 func getJSBoolean(call otto.FunctionCall, index int) bool {
 
-	v, err := call.ArgumentList[index].ToBoolean()
+	v, err := getJSArg(call, index).ToBoolean()
 	if err != nil {
-		panic(err)
+		panic(newJSTypeError(index, err))
 	}
 
 	return v
 }
 
+func newJSTypeError(index int, err error) *model.FormulaError {
+
+	formulaErr := model.NewFormulaError("", index, model.ErrorKindType, err.Error())
+	formulaErr.Err = err
+
+	return formulaErr
+}
+
 // func toJSValue(context *FormulaContext, value interface{}) otto.Value {
 
 // 	jsResult, err := context.VM.ToValue(value)
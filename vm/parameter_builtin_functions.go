@@ -0,0 +1,94 @@
+package vm
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/lertrel/goforit/model"
+)
+
+//parameterBuiltIns parameter functions of DefaultBuiltInFunctions
+//resolving parameters of ParameterRepository (see WithParameters)
+var parameterBuiltIns = []builtInFunction{
+	{
+		model.FunctionSignature{
+			Name:        "$PARAM",
+			Params:      []model.Param{{Name: "name", Type: model.TypeString}, {Name: "date", Type: model.TypeDate, Optional: true}},
+			Returns:     model.TypeAny,
+			Description: "The value of the given parameter effective on the given date, or on the as-of date of the run (see model.WithAsOf), or on the current date of the Formula's clock",
+			Examples:    []string{"$PARAM('VAT_RATE')", "$PARAM('VAT_RATE', invoiceDate)"},
+		},
+		fParam,
+	},
+}
+
+//parameterSet parameter repositories looked up in order (referred by
+//a pointer, so DefaultBuiltInFunctions is still comparable)
+type parameterSet struct {
+	repos []ParameterRepository
+}
+
+//WithParameters getting a copy of the current BuiltInFunctions resolving
+//parameters of $PARAM also from the given repository (after the ones
+//given before)
+func (fs DefaultBuiltInFunctions) WithParameters(repo ParameterRepository) DefaultBuiltInFunctions {
+
+	parameters := &parameterSet{}
+
+	if fs.parameters != nil {
+		parameters.repos = append(parameters.repos, fs.parameters.repos...)
+	}
+
+	parameters.repos = append(parameters.repos, repo)
+	fs.parameters = parameters
+
+	return fs
+}
+
+//Parameter getting the value of the given parameter effective on the
+//(calendar) date of asOf from the first repository having it
+func (fs DefaultBuiltInFunctions) Parameter(name string, asOf time.Time) (interface{}, bool) {
+
+	if fs.parameters == nil {
+		return nil, false
+	}
+
+	for _, repo := range fs.parameters.repos {
+		if value, found := repo.GetParameter(name, asOf); found {
+			return value, true
+		}
+	}
+
+	return nil, false
+}
+
+//asOf getting the as-of date of the current run (see model.WithAsOf),
+//the current time if the run doesn't have one
+func (fs DefaultBuiltInFunctions) asOf(vm VM) time.Time {
+
+	if asOf, found := model.AsOf(vm.Context()); found {
+		return asOf.In(fs.Location())
+	}
+
+	return fs.now()
+}
+
+func fParam(fs DefaultBuiltInFunctions, vm VM, funcDef interface{}) interface{} {
+
+	name := vm.GetFuncArgAsString(funcDef, 0)
+
+	var asOf time.Time
+	if vm.GetFuncArgsCount(funcDef) > 1 {
+		asOf = fs.getDate(vm, funcDef, 1)
+	} else {
+		asOf = fs.asOf(vm)
+	}
+
+	value, found := fs.Parameter(name, asOf)
+	if !found {
+		errMsg := fmt.Sprintf("parameter %s has no value effective on %s", name, model.FormatDate(asOf))
+		panic(model.NewFormulaError("$PARAM", 0, model.ErrorKindRange, errMsg))
+	}
+
+	return vm.ToVMValue(value)
+}
@@ -0,0 +1,320 @@
+package vm
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lertrel/goforit/model"
+)
+
+//ParameterRepository repository inside Formula to maintain global
+//parameters (e.g., VAT rate, minimum wage) resolved by $PARAM, so a value
+//repeated by many formulas is maintained in one place
+type ParameterRepository interface {
+
+	//GetParameter getting the value of the given parameter effective on
+	//the (calendar) date of asOf, false if the parameter isn't found or
+	//it has no value effective on the date
+	GetParameter(name string, asOf time.Time) (interface{}, bool)
+}
+
+//ParameterVersion a value of a parameter effective during a period
+type ParameterVersion struct {
+	//Value the value e.g., 0.07, "THB"
+	Value interface{}
+	//From the first (calendar) date the value is effective, zero for ever since
+	From time.Time
+	//To the last (calendar) date the value is effective, zero for onwards
+	To time.Time
+}
+
+//effectiveOn telling if the version is effective on the (calendar) date of the given time
+func (v ParameterVersion) effectiveOn(date time.Time) bool {
+
+	days := civilDays(date)
+
+	return (v.From.IsZero() || civilDays(v.From) <= days) && (v.To.IsZero() || days <= civilDays(v.To))
+}
+
+//overlaps telling if periods of the versions overlap
+func (v ParameterVersion) overlaps(other ParameterVersion) bool {
+
+	startsBeforeOtherEnds := v.From.IsZero() || other.To.IsZero() || civilDays(v.From) <= civilDays(other.To)
+	endsAfterOtherStarts := v.To.IsZero() || other.From.IsZero() || civilDays(other.From) <= civilDays(v.To)
+
+	return startsBeforeOtherEnds && endsAfterOtherStarts
+}
+
+//DefaultParameterRepository default implementation of ParameterRepository,
+//which is safe for changing parameters while formulas are running
+type DefaultParameterRepository struct {
+	mutex      sync.RWMutex
+	parameters map[string][]ParameterVersion
+}
+
+//NewParameterRepository is a public function to obtain an empty
+//DefaultParameterRepository
+func NewParameterRepository() *DefaultParameterRepository {
+
+	return &DefaultParameterRepository{parameters: make(map[string][]ParameterVersion)}
+}
+
+//SetParameter setting the given value effective at all times to the
+//given parameter, replacing all of its versions
+func (r *DefaultParameterRepository) SetParameter(name string, value interface{}) {
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.parameters[name] = []ParameterVersion{{Value: value}}
+}
+
+//AddParameterVersion adding a version of the given parameter, an error
+//is returned if its period is invalid or overlapping another version
+//
+//Ex.
+//
+//		r.AddParameterVersion("VAT_RATE", vm.ParameterVersion{Value: 0.07, To: lastDayOf7})
+//		r.AddParameterVersion("VAT_RATE", vm.ParameterVersion{Value: 0.1, From: firstDayOf10})
+//
+func (r *DefaultParameterRepository) AddParameterVersion(name string, version ParameterVersion) error {
+
+	if !version.From.IsZero() && !version.To.IsZero() && civilDays(version.To) < civilDays(version.From) {
+		return fmt.Errorf("%s - effective to %s is before effective from %s",
+			name, model.FormatDate(version.To), model.FormatDate(version.From))
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	versions := r.parameters[name]
+
+	for _, v := range versions {
+		if v.overlaps(version) {
+			return fmt.Errorf("%s - overlapping versions %s and %s", name, formatPeriod(v), formatPeriod(version))
+		}
+	}
+
+	versions = append(versions[:len(versions):len(versions)], version)
+	sort.SliceStable(versions, func(i, j int) bool {
+		return versions[i].From.IsZero() || !versions[j].From.IsZero() && versions[i].From.Before(versions[j].From)
+	})
+
+	r.parameters[name] = versions
+
+	return nil
+}
+
+func formatPeriod(v ParameterVersion) string {
+
+	from, to := "", ""
+	if !v.From.IsZero() {
+		from = model.FormatDate(v.From)
+	}
+	if !v.To.IsZero() {
+		to = model.FormatDate(v.To)
+	}
+
+	return "[" + from + ", " + to + "]"
+}
+
+//GetParameter getting the value of the given parameter effective on
+//the (calendar) date of asOf, false if the parameter isn't found or
+//it has no value effective on the date
+func (r *DefaultParameterRepository) GetParameter(name string, asOf time.Time) (interface{}, bool) {
+
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	for _, v := range r.parameters[name] {
+		if v.effectiveOn(asOf) {
+			return v.Value, true
+		}
+	}
+
+	return nil, false
+}
+
+//Versions getting versions of the given parameter ordered by effective from
+func (r *DefaultParameterRepository) Versions(name string) []ParameterVersion {
+
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return append([]ParameterVersion(nil), r.parameters[name]...)
+}
+
+//ParameterNames getting names of all parameters
+func (r *DefaultParameterRepository) ParameterNames() []string {
+
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	names := make([]string, 0, len(r.parameters))
+
+	for name := range r.parameters {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+//LoadParameterFile loading a DefaultParameterRepository from a CSV (.csv)
+//or JSON (.json) file (see LoadParameterCSV and LoadParameterJSON)
+func LoadParameterFile(path string) (*DefaultParameterRepository, error) {
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var r *DefaultParameterRepository
+
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".csv":
+		r, err = LoadParameterCSV(file)
+	case ".json":
+		r, err = LoadParameterJSON(file)
+	default:
+		return nil, fmt.Errorf("%s - unsupported parameter file (expecting .csv or .json)", path)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("%s - %w", path, err)
+	}
+
+	return r, nil
+}
+
+//LoadParameterCSV loading a DefaultParameterRepository from CSV of name,
+//value, and (optional) effective from and to dates of versions of
+//parameters, a header line and lines starting with # are skipped,
+//numbers are read as numbers, and true and false as booleans
+//
+//Ex.
+//
+//		name,value,from,to
+//		VAT_RATE,0.07,,2021-09-30
+//		VAT_RATE,0.1,2021-10-01,
+//		CURRENCY,THB
+//
+func LoadParameterCSV(r io.Reader) (*DefaultParameterRepository, error) {
+
+	reader := csv.NewReader(r)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	repo := NewParameterRepository()
+
+	for line := 1; ; line++ {
+
+		record, err := reader.Read()
+		if err == io.EOF {
+			return repo, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if line == 1 && len(record) > 1 && strings.EqualFold(strings.TrimSpace(record[1]), "value") {
+			//Header
+			continue
+		}
+		if len(record) < 2 {
+			return nil, fmt.Errorf("line %d: expecting name and value", line)
+		}
+
+		var dates [2]string
+		copy(dates[:], record[2:])
+
+		version, err := newParameterVersion(parseTableValue(strings.TrimSpace(record[1])), dates[0], dates[1])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		if err := repo.AddParameterVersion(strings.TrimSpace(record[0]), version); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+}
+
+func newParameterVersion(value interface{}, from string, to string) (ParameterVersion, error) {
+
+	version := ParameterVersion{Value: value}
+
+	var err error
+
+	if from = strings.TrimSpace(from); from != "" {
+		if version.From, err = model.ParseTime(from, time.UTC); err != nil {
+			return version, err
+		}
+	}
+
+	if to = strings.TrimSpace(to); to != "" {
+		if version.To, err = model.ParseTime(to, time.UTC); err != nil {
+			return version, err
+		}
+	}
+
+	return version, nil
+}
+
+//parameterJSON a version of a parameter in JSON
+type parameterJSON struct {
+	Name  string      `json:"name"`
+	Value interface{} `json:"value"`
+	From  string      `json:"from"`
+	To    string      `json:"to"`
+}
+
+//LoadParameterJSON loading a DefaultParameterRepository from JSON array
+//of versions of parameters, each has name, value (any JSON value), and
+//(optional) effective from and to dates
+//
+//Ex.
+//
+//		[
+//			{"name": "VAT_RATE", "value": 0.07, "to": "2021-09-30"},
+//			{"name": "VAT_RATE", "value": 0.1, "from": "2021-10-01"},
+//			{"name": "CURRENCY", "value": "THB"}
+//		]
+//
+func LoadParameterJSON(r io.Reader) (*DefaultParameterRepository, error) {
+
+	var parameters []parameterJSON
+	if err := json.NewDecoder(r).Decode(&parameters); err != nil {
+		return nil, err
+	}
+
+	repo := NewParameterRepository()
+
+	for i, p := range parameters {
+
+		if p.Name == "" {
+			return nil, fmt.Errorf("[%d]: missing name", i)
+		}
+
+		version, err := newParameterVersion(p.Value, p.From, p.To)
+		if err != nil {
+			return nil, fmt.Errorf("[%d]: %w", i, err)
+		}
+
+		if err := repo.AddParameterVersion(p.Name, version); err != nil {
+			return nil, fmt.Errorf("[%d]: %w", i, err)
+		}
+	}
+
+	return repo, nil
+}
@@ -0,0 +1,100 @@
+package vm_test
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lertrel/goforit/builder"
+	"github.com/lertrel/goforit/model"
+	"github.com/lertrel/goforit/vm"
+)
+
+func TestParameterFunctions(t *testing.T) {
+
+	params, err := vm.LoadParameterCSV(strings.NewReader(`name,value,from,to
+# VAT was raised on 2021-10-01
+VAT_RATE,0.07,,2021-09-30
+VAT_RATE,0.1,2021-10-01,
+CURRENCY,THB
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "wages.json")
+	err = ioutil.WriteFile(path, []byte(`[
+		{"name": "MIN_WAGE", "value": 313, "from": "2020-01-01", "to": "2022-09-30"},
+		{"name": "MIN_WAGE", "value": 328, "from": "2022-10-01"},
+		{"name": "BANDS", "value": [100, 200]}
+	]`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wages, err := vm.LoadParameterFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := wages.ParameterNames(); strings.Join(names, ",") != "BANDS,MIN_WAGE" {
+		t.Errorf("Expect %v but got %v\n", "BANDS,MIN_WAGE", names)
+	}
+
+	err = wages.AddParameterVersion("MIN_WAGE", vm.ParameterVersion{
+		Value: 330,
+		From:  time.Date(2022, 12, 1, 0, 0, 0, 0, time.UTC),
+	})
+	if err == nil {
+		t.Error("Expect an error of overlapping versions")
+	}
+
+	now := time.Date(2021, 12, 31, 20, 0, 0, 0, time.UTC)
+
+	f := builder.NewFormulaBuilder().
+		SetClock(model.FixedClock(now)).
+		SetLocation(time.FixedZone("ICT", 7*60*60)).
+		AddParameterRepository(params).
+		AddParameterRepository(wages).
+		Get()
+
+	tests := []struct {
+		script   string
+		asOf     time.Time
+		expected string
+	}{
+		{"$PARAM('VAT_RATE')", time.Time{}, "0.1"},
+		{"$PARAM('VAT_RATE', '2021-09-30')", time.Time{}, "0.07"},
+		{"$PARAM('VAT_RATE')", time.Date(2021, 9, 30, 16, 59, 0, 0, time.UTC), "0.07"},
+		{"$PARAM('VAT_RATE')", time.Date(2021, 9, 30, 17, 0, 0, 0, time.UTC), "0.1"},
+		{"$PARAM('CURRENCY')", time.Time{}, "THB"},
+		{"$PARAM('MIN_WAGE')", time.Date(2022, 10, 1, 0, 0, 0, 0, time.UTC), "328"},
+		{"$PARAM('BANDS')[1]", time.Time{}, "200"},
+		{"$IFERROR($PARAM('MIN_WAGE', '2019-12-31'), 0)", time.Time{}, "0"},
+	}
+
+	for _, test := range tests {
+
+		ctx := context.Background()
+		if !test.asOf.IsZero() {
+			ctx = model.WithAsOf(ctx, test.asOf)
+		}
+
+		s, err := run(ctx, newContext(t, f), test.script)
+		if err != nil {
+			t.Errorf("%s - %v\n", test.script, err)
+			continue
+		}
+
+		if s != test.expected {
+			t.Errorf("%s as of %v - expect %v but got %v\n", test.script, test.asOf, test.expected, s)
+		}
+	}
+
+	runErrorTests(t, f, []errorTest{
+		{"$PARAM('UNKNOWN')", model.ErrorKindRange},
+		{"$PARAM('MIN_WAGE', '2019-12-31')", model.ErrorKindRange},
+	})
+}
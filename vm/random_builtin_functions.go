@@ -0,0 +1,60 @@
+package vm
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/lertrel/goforit/model"
+)
+
+//randomBuiltIns random number functions of DefaultBuiltInFunctions, drawing
+//from the same sequence as Math.random, which is reproducible by the seed
+//of the run if the Formula is deterministic (FormulaBuilder.SetDeterministic)
+var randomBuiltIns = []builtInFunction{
+	{
+		model.FunctionSignature{
+			Name:        "$RAND",
+			Returns:     model.TypeNumber,
+			Description: "A random number greater than or equal to 0 and less than 1, replayable by the seed of the run if the Formula is deterministic",
+			Examples:    []string{"$RAND()"},
+		},
+		fRand,
+	},
+	{
+		model.FunctionSignature{
+			Name: "$RANDBETWEEN",
+			Params: []model.Param{
+				{Name: "low", Type: model.TypeInteger},
+				{Name: "high", Type: model.TypeInteger},
+			},
+			Returns:     model.TypeInteger,
+			Description: "A random integer between the given integers (inclusive), replayable by the seed of the run if the Formula is deterministic",
+			Examples:    []string{"$RANDBETWEEN(1, 6)"},
+		},
+		fRandBetween,
+	},
+}
+
+func fRand(fs DefaultBuiltInFunctions, vm VM, funcDef interface{}) interface{} {
+
+	return vm.ToVMValue(vm.Random())
+}
+
+func fRandBetween(fs DefaultBuiltInFunctions, vm VM, funcDef interface{}) interface{} {
+
+	low := vm.GetFuncArgAsInt(funcDef, 0)
+	high := vm.GetFuncArgAsInt(funcDef, 1)
+
+	if high < low {
+		errMsg := fmt.Sprintf("high (%d) is less than low (%d)", high, low)
+		panic(model.NewFormulaError("$RANDBETWEEN", 1, model.ErrorKindRange, errMsg))
+	}
+
+	n := low + int64(math.Floor(vm.Random()*float64(high-low+1)))
+	if n > high {
+		//Rounded up by float64 for a very wide range
+		n = high
+	}
+
+	return vm.ToVMValue(n)
+}
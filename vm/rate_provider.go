@@ -0,0 +1,175 @@
+package vm
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lertrel/goforit/model"
+)
+
+//RateProvider providing exchange rates of currencies to $FX
+type RateProvider interface {
+
+	//Rate getting the rate (units of to per unit of from) on the
+	//(calendar) date of the given time, false if it's missing
+	Rate(from string, to string, date time.Time) (*big.Rat, bool)
+}
+
+//MemoryRateProvider a RateProvider of rates kept in memory, a rate is
+//either of a date or of any date (e.g., a pegged currency), and the
+//inverse of a rate is used for the opposite direction
+type MemoryRateProvider struct {
+	mutex sync.RWMutex
+	//rates by from/to, then by date (an empty date for any date)
+	rates map[string]map[string]*big.Rat
+}
+
+//NewMemoryRateProvider is a public function to obtain an empty MemoryRateProvider
+func NewMemoryRateProvider() *MemoryRateProvider {
+
+	return &MemoryRateProvider{rates: make(map[string]map[string]*big.Rat)}
+}
+
+func ratePair(from string, to string) string {
+
+	return strings.ToUpper(from) + "/" + strings.ToUpper(to)
+}
+
+//SetRate setting the rate (units of to per unit of from) on the (calendar)
+//date of the given time, or on any date if date is zero
+//
+//Ex.
+//
+//		p.SetRate("USD", "THB", time.Date(2021, 1, 4, 0, 0, 0, 0, time.UTC), big.NewRat(3001, 100))
+//
+func (p *MemoryRateProvider) SetRate(from string, to string, date time.Time, rate *big.Rat) *MemoryRateProvider {
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	pair := ratePair(from, to)
+	if p.rates[pair] == nil {
+		p.rates[pair] = make(map[string]*big.Rat)
+	}
+
+	p.rates[pair][rateDate(date)] = new(big.Rat).Set(rate)
+
+	return p
+}
+
+func rateDate(date time.Time) string {
+
+	if date.IsZero() {
+		return ""
+	}
+
+	return model.FormatDate(date)
+}
+
+//Rate getting the rate (units of to per unit of from) on the (calendar)
+//date of the given time, the rate of the date is preferred to the rate
+//of any date, false if neither the rate nor its inverse is found
+func (p *MemoryRateProvider) Rate(from string, to string, date time.Time) (*big.Rat, bool) {
+
+	if strings.EqualFold(from, to) {
+		return big.NewRat(1, 1), true
+	}
+
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	for _, day := range []string{rateDate(date), ""} {
+
+		if rate, found := p.rates[ratePair(from, to)][day]; found {
+			return new(big.Rat).Set(rate), true
+		}
+
+		if rate, found := p.rates[ratePair(to, from)][day]; found && rate.Sign() != 0 {
+			return new(big.Rat).Inv(rate), true
+		}
+	}
+
+	return nil, false
+}
+
+//LoadRateFile loading a MemoryRateProvider from a CSV file (see LoadRateCSV)
+func LoadRateFile(path string) (*MemoryRateProvider, error) {
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	p, err := LoadRateCSV(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s - %w", path, err)
+	}
+
+	return p, nil
+}
+
+//LoadRateCSV loading a MemoryRateProvider from CSV of date (empty for
+//any date), from currency, to currency and rate (an exact decimal),
+//a header line and lines starting with # are skipped
+//
+//Ex.
+//
+//		date,from,to,rate
+//		2021-01-04,USD,THB,30.01
+//		2021-01-05,USD,THB,30.02
+//		# Pegged
+//		,HKD,USD,0.128
+//
+func LoadRateCSV(r io.Reader) (*MemoryRateProvider, error) {
+
+	reader := csv.NewReader(r)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = 4
+	reader.TrimLeadingSpace = true
+
+	p := NewMemoryRateProvider()
+
+	for line := 1; ; line++ {
+
+		record, err := reader.Read()
+		if err == io.EOF {
+			return p, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		for i := range record {
+			record[i] = strings.TrimSpace(record[i])
+		}
+
+		rate, err := model.ParseDecimal(record[3])
+		if err != nil {
+			if line == 1 {
+				//Header
+				continue
+			}
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		var date time.Time
+		if record[0] != "" {
+			if date, err = model.ParseTime(record[0], time.UTC); err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+		}
+
+		if rate.Sign() <= 0 {
+			return nil, fmt.Errorf("line %d: rate should be positive", line)
+		}
+
+		p.SetRate(record[1], record[2], date, rate)
+	}
+}
@@ -0,0 +1,342 @@
+package vm
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/lertrel/goforit/model"
+)
+
+//statisticalBuiltIns statistical functions of DefaultBuiltInFunctions,
+//arrays given to them (like to other aggregate functions) are flattened
+var statisticalBuiltIns = []builtInFunction{
+	{
+		model.FunctionSignature{
+			Name:        "$COUNT",
+			Params:      []model.Param{{Name: "values", Type: model.TypeAny, Optional: true, Variadic: true}},
+			Returns:     model.TypeInteger,
+			Description: "Number of numbers (in arrays too), other values are not counted",
+			Examples:    []string{"$COUNT(1, 'a', [2, 3])"},
+		},
+		fCount,
+	},
+	{
+		model.FunctionSignature{
+			Name:        "$MEDIAN",
+			Params:      []model.Param{{Name: "values", Type: model.TypeNumber, Variadic: true}},
+			Returns:     model.TypeNumber,
+			Description: "The middle of numbers (or arrays of numbers), the average of the two middle ones if there's an even number of numbers",
+			Examples:    []string{"$MEDIAN(3, 1, 2)", "$MEDIAN([1, 2, 3, 4])"},
+		},
+		fMedian,
+	},
+	{
+		model.FunctionSignature{
+			Name:        "$MODE",
+			Params:      []model.Param{{Name: "values", Type: model.TypeNumber, Variadic: true}},
+			Returns:     model.TypeNumber,
+			Description: "The most frequent of numbers (or arrays of numbers), the first one if there're many, an error if no number repeats",
+			Examples:    []string{"$MODE(1, 2, 2, 3)"},
+		},
+		fMode,
+	},
+	{
+		model.FunctionSignature{
+			Name:        "$STDEV",
+			Params:      []model.Param{{Name: "values", Type: model.TypeNumber, Variadic: true}},
+			Returns:     model.TypeNumber,
+			Description: "Standard deviation of a sample of (at least 2) numbers (or arrays of numbers)",
+			Examples:    []string{"$STDEV(2, 4, 4, 4, 5, 5, 7, 9)"},
+		},
+		fStdev,
+	},
+	{
+		model.FunctionSignature{
+			Name:        "$VAR",
+			Params:      []model.Param{{Name: "values", Type: model.TypeNumber, Variadic: true}},
+			Returns:     model.TypeNumber,
+			Description: "Variance of a sample of (at least 2) numbers (or arrays of numbers)",
+			Examples:    []string{"$VAR(2, 4, 4, 4, 5, 5, 7, 9)"},
+		},
+		fVar,
+	},
+	{
+		model.FunctionSignature{
+			Name:        "$PERCENTILE",
+			Params:      []model.Param{{Name: "values", Type: model.TypeArray}, {Name: "k", Type: model.TypeNumber}},
+			Returns:     model.TypeNumber,
+			Description: "The k-th percentile (k is 0 to 1 inclusive) of numbers, interpolated between the closest ones (as Excel's PERCENTILE.INC)",
+			Examples:    []string{"$PERCENTILE([1, 2, 3, 4], 0.3)"},
+		},
+		fPercentile,
+	},
+	{
+		model.FunctionSignature{
+			Name:        "$QUARTILE",
+			Params:      []model.Param{{Name: "values", Type: model.TypeArray}, {Name: "quart", Type: model.TypeInteger}},
+			Returns:     model.TypeNumber,
+			Description: "The given quartile of numbers: 0 minimum, 1 first quartile, 2 median, 3 third quartile, 4 maximum",
+			Examples:    []string{"$QUARTILE([1, 2, 4, 7, 8, 9, 10, 12], 1)"},
+		},
+		fQuartile,
+	},
+	{
+		model.FunctionSignature{
+			Name:        "$CORREL",
+			Params:      []model.Param{{Name: "values1", Type: model.TypeArray}, {Name: "values2", Type: model.TypeArray}},
+			Returns:     model.TypeNumber,
+			Description: "Pearson correlation coefficient of two arrays of numbers of the same length",
+			Examples:    []string{"$CORREL([3, 2, 4, 5, 6], [9, 7, 12, 15, 17])"},
+		},
+		fCorrel,
+	},
+}
+
+//getFloats getting arguments from the given index as float64(s),
+//arrays (of numbers) are flattened
+func getFloats(vm VM, funcDef interface{}, from int) []float64 {
+
+	var values []float64
+
+	for i := from; i < vm.GetFuncArgsCount(funcDef); i++ {
+		values = appendArgFloats(values, vm, funcDef, i)
+	}
+
+	return values
+}
+
+//getNonEmptyFloats the same as getFloats, but panicking with
+//*model.FormulaError if there's no number
+func getNonEmptyFloats(funcName string, vm VM, funcDef interface{}, from int) []float64 {
+
+	values := getFloats(vm, funcDef, from)
+	if len(values) == 0 {
+		panic(model.NewFormulaError(funcName, -1, model.ErrorKindRange, "expecting at least a number"))
+	}
+
+	return values
+}
+
+//appendArgFloats appending the argument at the given index as float64(s)
+//to the given values, an array (of numbers) is flattened
+func appendArgFloats(values []float64, vm VM, funcDef interface{}, index int) []float64 {
+
+	arg := vm.GetFuncArgAsIs(funcDef, index)
+	if !vm.IsArray(arg) {
+		return append(values, vm.GetFuncArgAsFloat(funcDef, index))
+	}
+
+	for _, element := range flattenArray(vm, index, vm.GetFuncArgAsArray(funcDef, index)) {
+
+		f, err := vm.ToFloat(element)
+		if err == nil && math.IsNaN(f) && !vm.IsNumber(element) {
+			s, _ := vm.ToString(element)
+			err = fmt.Errorf("expecting a number but got %s", s)
+		}
+		if err != nil {
+			panic(newJSTypeError(index, err))
+		}
+
+		values = append(values, f)
+	}
+
+	return values
+}
+
+//flattenArray elements of the given array of the argument at the given
+//index, elements of nested arrays are taken in place of the arrays
+func flattenArray(vm VM, index int, elements []interface{}) []interface{} {
+
+	var flattened []interface{}
+
+	for _, element := range elements {
+
+		if !vm.IsArray(element) {
+			flattened = append(flattened, element)
+			continue
+		}
+
+		nested, err := vm.ToArray(element)
+		if err != nil {
+			panic(newJSTypeError(index, err))
+		}
+
+		flattened = append(flattened, flattenArray(vm, index, nested)...)
+	}
+
+	return flattened
+}
+
+func fCount(fs DefaultBuiltInFunctions, vm VM, funcDef interface{}) interface{} {
+
+	count := 0
+
+	for i := 0; i < vm.GetFuncArgsCount(funcDef); i++ {
+
+		elements := []interface{}{vm.GetFuncArgAsIs(funcDef, i)}
+		elements = flattenArray(vm, i, elements)
+
+		for _, element := range elements {
+			if vm.IsNumber(element) && !vm.IsNaN(element) {
+				count++
+			}
+		}
+	}
+
+	return vm.ToVMValue(count)
+}
+
+//sortedFloats getting arguments as sorted float64(s), panicking with
+//*model.FormulaError if there's no number
+func sortedFloats(funcName string, vm VM, funcDef interface{}, from int, to int) []float64 {
+
+	var values []float64
+	for i := from; i < to; i++ {
+		values = appendArgFloats(values, vm, funcDef, i)
+	}
+
+	if len(values) == 0 {
+		panic(model.NewFormulaError(funcName, from, model.ErrorKindRange, "expecting at least a number"))
+	}
+
+	sort.Float64s(values)
+
+	return values
+}
+
+func fMedian(fs DefaultBuiltInFunctions, vm VM, funcDef interface{}) interface{} {
+
+	values := sortedFloats("$MEDIAN", vm, funcDef, 0, vm.GetFuncArgsCount(funcDef))
+
+	return vm.ToVMValue(percentile(values, 0.5))
+}
+
+func fMode(fs DefaultBuiltInFunctions, vm VM, funcDef interface{}) interface{} {
+
+	values := getNonEmptyFloats("$MODE", vm, funcDef, 0)
+	counts := make(map[float64]int)
+
+	for _, v := range values {
+		counts[v]++
+	}
+
+	//Among the most frequent numbers, the first one appearing wins
+	mode, maxCount := 0.0, 1
+	for _, v := range values {
+		if counts[v] > maxCount {
+			mode, maxCount = v, counts[v]
+		}
+	}
+
+	if maxCount == 1 {
+		panic(model.NewFormulaError("$MODE", -1, model.ErrorKindRuntime, "no number repeats"))
+	}
+
+	return vm.ToVMValue(mode)
+}
+
+//sampleVariance variance of a sample of the given numbers
+func sampleVariance(funcName string, values []float64) float64 {
+
+	if len(values) < 2 {
+		panic(model.NewFormulaError(funcName, -1, model.ErrorKindRange, "expecting at least 2 numbers"))
+	}
+
+	var mean float64
+	for _, v := range values {
+		mean += v
+	}
+	mean /= float64(len(values))
+
+	var squares float64
+	for _, v := range values {
+		squares += (v - mean) * (v - mean)
+	}
+
+	return squares / float64(len(values)-1)
+}
+
+func fStdev(fs DefaultBuiltInFunctions, vm VM, funcDef interface{}) interface{} {
+
+	return vm.ToVMValue(math.Sqrt(sampleVariance("$STDEV", getFloats(vm, funcDef, 0))))
+}
+
+func fVar(fs DefaultBuiltInFunctions, vm VM, funcDef interface{}) interface{} {
+
+	return vm.ToVMValue(sampleVariance("$VAR", getFloats(vm, funcDef, 0)))
+}
+
+//percentile the k-th (0 to 1) percentile of the given sorted numbers
+//interpolated between the closest ones
+func percentile(sorted []float64, k float64) float64 {
+
+	rank := k * float64(len(sorted)-1)
+	lower := math.Floor(rank)
+	i := int(lower)
+
+	if i+1 >= len(sorted) {
+		return sorted[i]
+	}
+
+	return sorted[i] + (rank-lower)*(sorted[i+1]-sorted[i])
+}
+
+func fPercentile(fs DefaultBuiltInFunctions, vm VM, funcDef interface{}) interface{} {
+
+	values := sortedFloats("$PERCENTILE", vm, funcDef, 0, 1)
+
+	k := vm.GetFuncArgAsFloat(funcDef, 1)
+	if k < 0 || k > 1 {
+		panic(model.NewFormulaError("$PERCENTILE", 1, model.ErrorKindRange, "k should be between 0 and 1"))
+	}
+
+	return vm.ToVMValue(percentile(values, k))
+}
+
+func fQuartile(fs DefaultBuiltInFunctions, vm VM, funcDef interface{}) interface{} {
+
+	values := sortedFloats("$QUARTILE", vm, funcDef, 0, 1)
+
+	quart := vm.GetFuncArgAsInt(funcDef, 1)
+	if quart < 0 || quart > 4 {
+		panic(model.NewFormulaError("$QUARTILE", 1, model.ErrorKindRange, "quart should be between 0 and 4"))
+	}
+
+	return vm.ToVMValue(percentile(values, float64(quart)/4))
+}
+
+func fCorrel(fs DefaultBuiltInFunctions, vm VM, funcDef interface{}) interface{} {
+
+	xs := appendArgFloats(nil, vm, funcDef, 0)
+	ys := appendArgFloats(nil, vm, funcDef, 1)
+
+	if len(xs) != len(ys) {
+		panic(model.NewFormulaError("$CORREL", 1, model.ErrorKindRange, "arrays should have the same length"))
+	}
+	if len(xs) < 2 {
+		panic(model.NewFormulaError("$CORREL", -1, model.ErrorKindRange, "expecting at least 2 pairs of numbers"))
+	}
+
+	var meanX, meanY float64
+	for i := range xs {
+		meanX += xs[i]
+		meanY += ys[i]
+	}
+	meanX /= float64(len(xs))
+	meanY /= float64(len(ys))
+
+	var sumXY, sumXX, sumYY float64
+	for i := range xs {
+		dx, dy := xs[i]-meanX, ys[i]-meanY
+		sumXY += dx * dy
+		sumXX += dx * dx
+		sumYY += dy * dy
+	}
+
+	if sumXX == 0 || sumYY == 0 {
+		panic(model.NewFormulaError("$CORREL", -1, model.ErrorKindRange, "numbers of an array are all the same"))
+	}
+
+	return vm.ToVMValue(sumXY / math.Sqrt(sumXX*sumYY))
+}
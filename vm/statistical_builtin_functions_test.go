@@ -0,0 +1,44 @@
+package vm_test
+
+import (
+	"testing"
+
+	"github.com/lertrel/goforit/builder"
+	"github.com/lertrel/goforit/model"
+)
+
+func TestStatisticalFunctions(t *testing.T) {
+
+	f := builder.NewFormulaBuilder().Get()
+
+	runScriptTests(t, f, []scriptTest{
+		{"$SUMI([1, 2], 3, [[4], 5])", "15"},
+		{"$SUMF([{p: 1.5}, {p: 2.25}].map(function(i) { return i.p; }))", "3.75"},
+		{"$AVG([1, 2, 3], 6)", "3"},
+		{"$MIN([3, 1], 2)", "1"},
+		{"$MAX([3, [9]], 2)", "9"},
+		{"$COUNT(1, 'a', [2, null, [3]], NaN)", "3"},
+		{"$COUNT()", "0"},
+		{"$MEDIAN(3, 1, 2)", "2"},
+		{"$MEDIAN([4, 1, 3, 2])", "2.5"},
+		{"$MODE(1, 2, 3, 3, 2)", "2"},
+		{"$RND($STDEV(2, 4, 4, 4, 5, 5, 7, 9), 10)", "2.1380899353"},
+		{"$RND($VAR([2, 4, 4, 4], [5, 5, 7, 9]), 10)", "4.5714285714"},
+		{"$PERCENTILE([1, 2, 3, 4], 0.3)", "1.9"},
+		{"$PERCENTILE([1, 2, 3, 4], 1)", "4"},
+		{"$QUARTILE([1, 2, 4, 7, 8, 9, 10, 12], 1)", "3.5"},
+		{"$QUARTILE([1, 2, 4, 7, 8, 9, 10, 12], 4)", "12"},
+		{"$RND($CORREL([3, 2, 4, 5, 6], [9, 7, 12, 15, 17]), 6)", "0.997054"},
+	})
+
+	runErrorTests(t, f, []errorTest{
+		{"$SUMF([1, 'abc'])", model.ErrorKindType},
+		{"$AVG([])", model.ErrorKindRange},
+		{"$MODE(1, 2, 3)", model.ErrorKindRuntime},
+		{"$STDEV(1)", model.ErrorKindRange},
+		{"$PERCENTILE([1, 2], 1.5)", model.ErrorKindRange},
+		{"$QUARTILE([1, 2], 5)", model.ErrorKindRange},
+		{"$CORREL([1, 2], [1, 2, 3])", model.ErrorKindRange},
+		{"$CORREL([1, 1], [1, 2])", model.ErrorKindRange},
+	})
+}
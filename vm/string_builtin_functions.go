@@ -0,0 +1,436 @@
+package vm
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/lertrel/goforit/model"
+)
+
+//stringBuiltIns string functions of DefaultBuiltInFunctions, positions
+//and lengths are counted by characters (not bytes), and positions start from 1
+var stringBuiltIns = []builtInFunction{
+	{
+		model.FunctionSignature{
+			Name:        "$CONCAT",
+			Params:      []model.Param{{Name: "values", Type: model.TypeAny, Optional: true, Variadic: true}},
+			Returns:     model.TypeString,
+			Description: "Joining the given values (or arrays of values) as a string, null and undefined are skipped",
+			Examples:    []string{"$CONCAT('Dear ', title, ' ', name)", "$CONCAT(names)"},
+		},
+		fConcat,
+	},
+	{
+		model.FunctionSignature{
+			Name:        "$LEFT",
+			Params:      []model.Param{{Name: "text", Type: model.TypeString}, {Name: "count", Type: model.TypeInteger, Optional: true}},
+			Returns:     model.TypeString,
+			Description: "The first count (1 by default) characters of the given text",
+			Examples:    []string{"$LEFT('ABC-123', 3)"},
+		},
+		fLeft,
+	},
+	{
+		model.FunctionSignature{
+			Name:        "$RIGHT",
+			Params:      []model.Param{{Name: "text", Type: model.TypeString}, {Name: "count", Type: model.TypeInteger, Optional: true}},
+			Returns:     model.TypeString,
+			Description: "The last count (1 by default) characters of the given text",
+			Examples:    []string{"$RIGHT('ABC-123', 3)"},
+		},
+		fRight,
+	},
+	{
+		model.FunctionSignature{
+			Name: "$MID",
+			Params: []model.Param{
+				{Name: "text", Type: model.TypeString},
+				{Name: "start", Type: model.TypeInteger},
+				{Name: "count", Type: model.TypeInteger},
+			},
+			Returns:     model.TypeString,
+			Description: "Count characters of the given text from the given start (1 is the first character)",
+			Examples:    []string{"$MID('ABC-123', 5, 2)"},
+		},
+		fMid,
+	},
+	{
+		model.FunctionSignature{
+			Name:        "$LEN",
+			Params:      []model.Param{{Name: "text", Type: model.TypeString}},
+			Returns:     model.TypeInteger,
+			Description: "Number of characters of the given text",
+			Examples:    []string{"$LEN('ABC-123')"},
+		},
+		fLen,
+	},
+	{
+		model.FunctionSignature{
+			Name:        "$UPPER",
+			Params:      []model.Param{{Name: "text", Type: model.TypeString}},
+			Returns:     model.TypeString,
+			Description: "The given text in upper case",
+			Examples:    []string{"$UPPER('abc')"},
+		},
+		fUpper,
+	},
+	{
+		model.FunctionSignature{
+			Name:        "$LOWER",
+			Params:      []model.Param{{Name: "text", Type: model.TypeString}},
+			Returns:     model.TypeString,
+			Description: "The given text in lower case",
+			Examples:    []string{"$LOWER('ABC')"},
+		},
+		fLower,
+	},
+	{
+		model.FunctionSignature{
+			Name:        "$TRIM",
+			Params:      []model.Param{{Name: "text", Type: model.TypeString}},
+			Returns:     model.TypeString,
+			Description: "The given text without leading and trailing spaces, and with single spaces between words",
+			Examples:    []string{"$TRIM('  John   Smith ')"},
+		},
+		fTrim,
+	},
+	{
+		model.FunctionSignature{
+			Name: "$SUBSTITUTE",
+			Params: []model.Param{
+				{Name: "text", Type: model.TypeString},
+				{Name: "old", Type: model.TypeString},
+				{Name: "new", Type: model.TypeString},
+				{Name: "instance", Type: model.TypeInteger, Optional: true},
+			},
+			Returns:     model.TypeString,
+			Description: "Replacing old texts in the given text by the new one, only the given instance (1 is the first one) is replaced if it's given",
+			Examples:    []string{"$SUBSTITUTE('a-b-c', '-', '/')", "$SUBSTITUTE('a-b-c', '-', '/', 2)"},
+		},
+		fSubstitute,
+	},
+	{
+		model.FunctionSignature{
+			Name:        "$SPLIT",
+			Params:      []model.Param{{Name: "text", Type: model.TypeString}, {Name: "separator", Type: model.TypeString}},
+			Returns:     model.TypeArray,
+			Description: "An array of parts of the given text separated by the given separator, an empty separator splits into characters",
+			Examples:    []string{"$SPLIT('a,b,c', ',')"},
+		},
+		fSplit,
+	},
+	{
+		model.FunctionSignature{
+			Name: "$PAD",
+			Params: []model.Param{
+				{Name: "text", Type: model.TypeString},
+				{Name: "length", Type: model.TypeInteger},
+				{Name: "padding", Type: model.TypeString, Optional: true},
+				{Name: "side", Type: model.TypeString, Optional: true},
+			},
+			Returns:     model.TypeString,
+			Description: "Padding the given text by the padding (a space by default) on the left (by default) or right side up to the given length, a longer text is returned as it is",
+			Examples:    []string{"$PAD(42, 6, '0')", "$PAD(name, 20, ' ', 'right')"},
+		},
+		fPad,
+	},
+	{
+		model.FunctionSignature{
+			Name:        "$MATCHES",
+			Params:      []model.Param{{Name: "text", Type: model.TypeString}, {Name: "pattern", Type: model.TypeString}},
+			Returns:     model.TypeBoolean,
+			Description: "Telling if the given text contains a match of the given regular expression (RE2 syntax), use ^ and $ to match the whole text",
+			Examples:    []string{"$MATCHES(email, '^[^@]+@[^@]+$')"},
+		},
+		fMatches,
+	},
+	{
+		model.FunctionSignature{
+			Name: "$EXTRACT",
+			Params: []model.Param{
+				{Name: "text", Type: model.TypeString},
+				{Name: "pattern", Type: model.TypeString},
+				{Name: "group", Type: model.TypeInteger, Optional: true},
+			},
+			Returns:     model.TypeString,
+			Description: "The first match (or its given capturing group) of the given regular expression (RE2 syntax) in the given text, an empty string if there's no match",
+			Examples:    []string{"$EXTRACT('Order #12345', '[0-9]+')", "$EXTRACT(email, '@(.+)$', 1)"},
+		},
+		fExtract,
+	},
+	{
+		model.FunctionSignature{
+			Name:        "$TEXT",
+			Params:      []model.Param{{Name: "value", Type: model.TypeAny}, {Name: "format", Type: model.TypeString}},
+			Returns:     model.TypeString,
+			Description: "Formatting the given number or date by an Excel-style format e.g., #,##0.00, 0.0%, $#,##0;($#,##0), dd/mm/yyyy or d mmmm yyyy h:mm AM/PM",
+			Examples:    []string{"$TEXT(1234.5, '#,##0.00')", "$TEXT($TODAY(), 'dd mmm yyyy')"},
+		},
+		fText,
+	},
+}
+
+func fConcat(fs DefaultBuiltInFunctions, vm VM, funcDef interface{}) interface{} {
+
+	var sb strings.Builder
+
+	for i := 0; i < vm.GetFuncArgsCount(funcDef); i++ {
+
+		elements := []interface{}{vm.GetFuncArgAsIs(funcDef, i)}
+		elements = flattenArray(vm, i, elements)
+
+		for _, element := range elements {
+
+			if vm.IsNull(element) || vm.IsUndefined(element) {
+				continue
+			}
+
+			s, err := vm.ToString(element)
+			if err != nil {
+				panic(newJSTypeError(i, err))
+			}
+
+			sb.WriteString(s)
+		}
+	}
+
+	return vm.ToVMValue(sb.String())
+}
+
+//getCount getting the (optional) argument at the given index as
+//a non-negative number of characters
+func getCount(funcName string, vm VM, funcDef interface{}, index int, defaultCount int) int {
+
+	if index >= vm.GetFuncArgsCount(funcDef) {
+		return defaultCount
+	}
+
+	count := vm.GetFuncArgAsInt(funcDef, index)
+	if count < 0 {
+		panic(model.NewFormulaError(funcName, index, model.ErrorKindRange, "count should not be negative"))
+	}
+	if count > int64(maxTextLength) {
+		count = int64(maxTextLength)
+	}
+
+	return int(count)
+}
+
+//maxTextLength the limit of lengths of texts built by string functions
+const maxTextLength = 1 << 20
+
+func fLeft(fs DefaultBuiltInFunctions, vm VM, funcDef interface{}) interface{} {
+
+	text := []rune(vm.GetFuncArgAsString(funcDef, 0))
+	count := getCount("$LEFT", vm, funcDef, 1, 1)
+
+	if count < len(text) {
+		text = text[:count]
+	}
+
+	return vm.ToVMValue(string(text))
+}
+
+func fRight(fs DefaultBuiltInFunctions, vm VM, funcDef interface{}) interface{} {
+
+	text := []rune(vm.GetFuncArgAsString(funcDef, 0))
+	count := getCount("$RIGHT", vm, funcDef, 1, 1)
+
+	if count < len(text) {
+		text = text[len(text)-count:]
+	}
+
+	return vm.ToVMValue(string(text))
+}
+
+func fMid(fs DefaultBuiltInFunctions, vm VM, funcDef interface{}) interface{} {
+
+	text := []rune(vm.GetFuncArgAsString(funcDef, 0))
+
+	start := vm.GetFuncArgAsInt(funcDef, 1)
+	if start < 1 {
+		panic(model.NewFormulaError("$MID", 1, model.ErrorKindRange, "start should be at least 1"))
+	}
+
+	count := getCount("$MID", vm, funcDef, 2, 0)
+
+	if start > int64(len(text)) {
+		return vm.ToVMValue("")
+	}
+
+	text = text[start-1:]
+	if count < len(text) {
+		text = text[:count]
+	}
+
+	return vm.ToVMValue(string(text))
+}
+
+func fLen(fs DefaultBuiltInFunctions, vm VM, funcDef interface{}) interface{} {
+
+	return vm.ToVMValue(utf8.RuneCountInString(vm.GetFuncArgAsString(funcDef, 0)))
+}
+
+func fUpper(fs DefaultBuiltInFunctions, vm VM, funcDef interface{}) interface{} {
+
+	return vm.ToVMValue(strings.ToUpper(vm.GetFuncArgAsString(funcDef, 0)))
+}
+
+func fLower(fs DefaultBuiltInFunctions, vm VM, funcDef interface{}) interface{} {
+
+	return vm.ToVMValue(strings.ToLower(vm.GetFuncArgAsString(funcDef, 0)))
+}
+
+func fTrim(fs DefaultBuiltInFunctions, vm VM, funcDef interface{}) interface{} {
+
+	return vm.ToVMValue(strings.Join(strings.Fields(vm.GetFuncArgAsString(funcDef, 0)), " "))
+}
+
+func fSubstitute(fs DefaultBuiltInFunctions, vm VM, funcDef interface{}) interface{} {
+
+	text := vm.GetFuncArgAsString(funcDef, 0)
+	oldText := vm.GetFuncArgAsString(funcDef, 1)
+	newText := vm.GetFuncArgAsString(funcDef, 2)
+
+	if oldText == "" {
+		return vm.ToVMValue(text)
+	}
+
+	if vm.GetFuncArgsCount(funcDef) < 4 {
+		return vm.ToVMValue(strings.ReplaceAll(text, oldText, newText))
+	}
+
+	instance := vm.GetFuncArgAsInt(funcDef, 3)
+	if instance < 1 {
+		panic(model.NewFormulaError("$SUBSTITUTE", 3, model.ErrorKindRange, "instance should be at least 1"))
+	}
+
+	offset := 0
+	for n := int64(1); ; n++ {
+
+		i := strings.Index(text[offset:], oldText)
+		if i < 0 {
+			return vm.ToVMValue(text)
+		}
+
+		offset += i
+		if n == instance {
+			return vm.ToVMValue(text[:offset] + newText + text[offset+len(oldText):])
+		}
+		offset += len(oldText)
+	}
+}
+
+func fSplit(fs DefaultBuiltInFunctions, vm VM, funcDef interface{}) interface{} {
+
+	text := vm.GetFuncArgAsString(funcDef, 0)
+	separator := vm.GetFuncArgAsString(funcDef, 1)
+
+	return vm.ToVMValue(strings.Split(text, separator))
+}
+
+func fPad(fs DefaultBuiltInFunctions, vm VM, funcDef interface{}) interface{} {
+
+	text := vm.GetFuncArgAsString(funcDef, 0)
+	length := getCount("$PAD", vm, funcDef, 1, 0)
+
+	padding := " "
+	if vm.GetFuncArgsCount(funcDef) > 2 {
+		padding = vm.GetFuncArgAsString(funcDef, 2)
+	}
+	if padding == "" {
+		panic(model.NewFormulaError("$PAD", 2, model.ErrorKindRange, "padding should not be empty"))
+	}
+
+	left := true
+	if vm.GetFuncArgsCount(funcDef) > 3 {
+		switch side := strings.ToLower(vm.GetFuncArgAsString(funcDef, 3)); side {
+		case "left":
+		case "right":
+			left = false
+		default:
+			errMsg := fmt.Sprintf("unknown side %q (expecting left or right)", side)
+			panic(model.NewFormulaError("$PAD", 3, model.ErrorKindRange, errMsg))
+		}
+	}
+
+	missing := length - utf8.RuneCountInString(text)
+	if missing <= 0 {
+		return vm.ToVMValue(text)
+	}
+
+	pad := []rune(strings.Repeat(padding, missing/utf8.RuneCountInString(padding)+1))[:missing]
+	if left {
+		return vm.ToVMValue(string(pad) + text)
+	}
+
+	return vm.ToVMValue(text + string(pad))
+}
+
+//getRegexp getting the argument at the given index as a compiled regular
+//expression, panicking with *model.FormulaError if it's invalid
+func getRegexp(funcName string, vm VM, funcDef interface{}, index int) *regexp.Regexp {
+
+	re, err := regexp.Compile(vm.GetFuncArgAsString(funcDef, index))
+	if err != nil {
+		formulaErr := model.NewFormulaError(funcName, index, model.ErrorKindRange, err.Error())
+		formulaErr.Err = err
+		panic(formulaErr)
+	}
+
+	return re
+}
+
+func fMatches(fs DefaultBuiltInFunctions, vm VM, funcDef interface{}) interface{} {
+
+	text := vm.GetFuncArgAsString(funcDef, 0)
+	re := getRegexp("$MATCHES", vm, funcDef, 1)
+
+	return vm.ToVMValue(re.MatchString(text))
+}
+
+func fExtract(fs DefaultBuiltInFunctions, vm VM, funcDef interface{}) interface{} {
+
+	text := vm.GetFuncArgAsString(funcDef, 0)
+	re := getRegexp("$EXTRACT", vm, funcDef, 1)
+
+	group := 0
+	if vm.GetFuncArgsCount(funcDef) > 2 {
+		g := vm.GetFuncArgAsInt(funcDef, 2)
+		if g < 0 || g > int64(re.NumSubexp()) {
+			errMsg := fmt.Sprintf("group should be between 0 and %d", re.NumSubexp())
+			panic(model.NewFormulaError("$EXTRACT", 2, model.ErrorKindRange, errMsg))
+		}
+		group = int(g)
+	}
+
+	match := re.FindStringSubmatch(text)
+	if match == nil {
+		return vm.ToVMValue("")
+	}
+
+	return vm.ToVMValue(match[group])
+}
+
+func fText(fs DefaultBuiltInFunctions, vm VM, funcDef interface{}) interface{} {
+
+	format := vm.GetFuncArgAsString(funcDef, 1)
+
+	switch {
+	case format == "" || strings.EqualFold(format, "General"):
+		return vm.ToVMValue(vm.GetFuncArgAsString(funcDef, 0))
+	case isDateFormat(format):
+		return vm.ToVMValue(formatDateText(fs.getDate(vm, funcDef, 0), format))
+	}
+
+	text, err := formatNumberText(vm.GetFuncArgAsDecimal(funcDef, 0), format, fs.Rounding())
+	if err != nil {
+		formulaErr := model.NewFormulaError("$TEXT", 1, model.ErrorKindRange, err.Error())
+		formulaErr.Err = err
+		panic(formulaErr)
+	}
+
+	return vm.ToVMValue(text)
+}
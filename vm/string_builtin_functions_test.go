@@ -0,0 +1,79 @@
+package vm_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lertrel/goforit/builder"
+	"github.com/lertrel/goforit/model"
+	"github.com/lertrel/goforit/parse"
+)
+
+func TestStringFunctions(t *testing.T) {
+
+	loc := time.FixedZone("ICT", 7*60*60)
+	clock := model.FixedClock(time.Date(2020, 12, 31, 23, 5, 9, 0, loc))
+	//Parsing by syntax tree, so that $ in formats isn't taken as a function
+	f := builder.NewFormulaBuilder().SetClock(clock).SetLocation(loc).SetParser(parse.NewASTParser()).Get()
+
+	runScriptTests(t, f, []scriptTest{
+		{"$CONCAT('Dear ', 'Mr. ', ['John', [' '], 'Smith'], null, 1.5)", "Dear Mr. John Smith1.5"},
+		{"$CONCAT()", ""},
+		{"$LEFT('ABC-123', 3)", "ABC"},
+		{"$LEFT('ABC')", "A"},
+		{"$LEFT('AB', 5)", "AB"},
+		{"$RIGHT('ABC-123', 3)", "123"},
+		{"$RIGHT('สวัสดี', 2)", "ดี"},
+		{"$MID('ABC-123', 5, 2)", "12"},
+		{"$MID('ABC', 5, 2)", ""},
+		{"$LEN('สวัสดี')", "6"},
+		{"$LEN(12345)", "5"},
+		{"$UPPER('abc')", "ABC"},
+		{"$LOWER('ABC')", "abc"},
+		{"$TRIM('  John   Smith ')", "John Smith"},
+		{"$SUBSTITUTE('a-b-c', '-', '/')", "a/b/c"},
+		{"$SUBSTITUTE('a-b-c', '-', '/', 2)", "a-b/c"},
+		{"$SUBSTITUTE('a-b-c', '-', '/', 3)", "a-b-c"},
+		{"$SPLIT('a,b,c', ',').length", "3"},
+		{"$SPLIT('a,b,c', ',')[2]", "c"},
+		{"$PAD(42, 6, '0')", "000042"},
+		{"$PAD('ab', 5, 'xy', 'right')", "abxyx"},
+		{"$PAD('abcdef', 3)", "abcdef"},
+		{"$MATCHES('john@example.com', '^[^@]+@[^@]+$')", "true"},
+		{"$MATCHES('john', '^[^@]+@[^@]+$')", "false"},
+		{"$EXTRACT('Order #12345', '[0-9]+')", "12345"},
+		{"$EXTRACT('john@example.com', '@(.+)$', 1)", "example.com"},
+		{"$EXTRACT('none', '[0-9]+')", ""},
+		{"$TEXT(1234.5, '#,##0.00')", "1,234.50"},
+		{"$TEXT(-1234567.891, '#,##0.00')", "-1,234,567.89"},
+		{"$TEXT(0.125, '0.0%')", "12.5%"},
+		{"$TEXT(0.5, '#.##')", ".5"},
+		{"$TEXT(42, '000000')", "000042"},
+		{"$TEXT(-1500, '$#,##0;($#,##0)')", "($1,500)"},
+		{"$TEXT(0, '0.00;(0.00);\"-\"')", "-"},
+		{"$TEXT(-0.001, '0.00')", "0.00"},
+		{"$TEXT(1234567, '#,##0,\" K\"')", "1,235 K"},
+		{"$TEXT(2.5, '0')", "3"},
+		{"$TEXT('1234.565', '#,##0.00 \"THB\"')", "1,234.57 THB"},
+		{"$TEXT(12.5, 'General')", "12.5"},
+		{"$TEXT('2020-03-05', 'dd/mm/yyyy')", "05/03/2020"},
+		{"$TEXT('2020-03-05', 'd mmm yy')", "5 Mar 20"},
+		{"$TEXT('2020-03-05', 'dddd, mmmm d, yyyy')", "Thursday, March 5, 2020"},
+		{"$TEXT($NOW(), 'yyyy-mm-dd hh:mm:ss')", "2020-12-31 23:05:09"},
+		{"$TEXT($NOW(), 'h:mm AM/PM')", "11:05 PM"},
+		{"$TEXT('2020-12-31T10:00:00Z', 'hh:mm \"ICT\"')", "17:00 ICT"},
+	})
+
+	runErrorTests(t, f, []errorTest{
+		{"$LEFT('abc', -1)", model.ErrorKindRange},
+		{"$MID('abc', 0, 1)", model.ErrorKindRange},
+		{"$SUBSTITUTE('abc', 'b', 'x', 0)", model.ErrorKindRange},
+		{"$PAD('abc', 5, '')", model.ErrorKindRange},
+		{"$PAD('abc', 5, ' ', 'middle')", model.ErrorKindRange},
+		{"$MATCHES('abc', '(')", model.ErrorKindRange},
+		{"$EXTRACT('abc', 'b', 1)", model.ErrorKindRange},
+		{"$TEXT('abc', '0.00')", model.ErrorKindType},
+		{"$TEXT(1, '0\"-\"0')", model.ErrorKindRange},
+		{"$LEN()", model.ErrorKindArity},
+	})
+}
@@ -0,0 +1,276 @@
+package vm
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+//Table a read-only table of named columns (e.g., a rate card or tax
+//brackets) queried by lookup functions ($VLOOKUP, $BRACKET, $INDEX,
+//$MATCH and $TABLE), values are float64, string, bool or nil
+type Table struct {
+	columns []string
+	index   map[string]int
+	rows    [][]interface{}
+}
+
+//NewTable creating a Table of the given columns and rows, every row
+//must have a value for each column
+func NewTable(columns []string, rows [][]interface{}) (*Table, error) {
+
+	if len(columns) == 0 {
+		return nil, errors.New("table has no column")
+	}
+
+	t := &Table{
+		columns: append([]string(nil), columns...),
+		index:   make(map[string]int),
+		rows:    make([][]interface{}, len(rows)),
+	}
+
+	for i, column := range columns {
+		if _, found := t.index[column]; found {
+			return nil, fmt.Errorf("duplicate column %q", column)
+		}
+		t.index[column] = i
+	}
+
+	for i, row := range rows {
+		if len(row) != len(columns) {
+			return nil, fmt.Errorf("row %d has %d values (expecting %d)", i+1, len(row), len(columns))
+		}
+		for j, value := range row {
+			switch value.(type) {
+			case nil, float64, string, bool:
+			default:
+				return nil, fmt.Errorf("row %d, column %q has unsupported value %v", i+1, columns[j], value)
+			}
+		}
+		t.rows[i] = append([]interface{}(nil), row...)
+	}
+
+	return t, nil
+}
+
+//Columns getting names of columns
+func (t *Table) Columns() []string {
+
+	return append([]string(nil), t.columns...)
+}
+
+//Column getting the (0-based) index of the given column
+func (t *Table) Column(name string) (int, bool) {
+
+	i, found := t.index[name]
+
+	return i, found
+}
+
+//Len getting number of rows
+func (t *Table) Len() int {
+
+	return len(t.rows)
+}
+
+//Value getting the value at the given (0-based) row and column
+func (t *Table) Value(row int, column int) interface{} {
+
+	return t.rows[row][column]
+}
+
+//LoadTableFile loading a Table from a CSV (.csv) or JSON (.json) file
+//(see LoadTableCSV and LoadTableJSON)
+func LoadTableFile(path string) (*Table, error) {
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var t *Table
+
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".csv":
+		t, err = LoadTableCSV(file)
+	case ".json":
+		t, err = LoadTableJSON(file)
+	default:
+		return nil, fmt.Errorf("%s - unsupported table file (expecting .csv or .json)", path)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("%s - %w", path, err)
+	}
+
+	return t, nil
+}
+
+//LoadTableCSV loading a Table from CSV having a header line of column
+//names, lines starting with # are skipped, numbers are read as numbers,
+//true and false as booleans, and empty values as nil
+//
+//Ex.
+//
+//		plan,age,rate
+//		# Rates since 2021
+//		A,20,1.5
+//		A,30,1.8
+//
+func LoadTableCSV(r io.Reader) (*Table, error) {
+
+	reader := csv.NewReader(r)
+	reader.Comment = '#'
+	reader.TrimLeadingSpace = true
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, errors.New("missing header line")
+	}
+
+	columns := make([]string, len(records[0]))
+	for i, name := range records[0] {
+		columns[i] = strings.TrimSpace(name)
+	}
+
+	rows := make([][]interface{}, len(records)-1)
+	for i, record := range records[1:] {
+		rows[i] = make([]interface{}, len(record))
+		for j, value := range record {
+			rows[i][j] = parseTableValue(strings.TrimSpace(value))
+		}
+	}
+
+	return NewTable(columns, rows)
+}
+
+func parseTableValue(s string) interface{} {
+
+	switch s {
+	case "":
+		return nil
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return f
+	}
+
+	return s
+}
+
+//tableJSON a Table in JSON of columns and rows of values
+type tableJSON struct {
+	Columns []string        `json:"columns"`
+	Rows    [][]interface{} `json:"rows"`
+}
+
+//LoadTableJSON loading a Table from JSON, which is either an object of
+//columns and rows of values, or an array of objects (columns are ordered
+//by their first appearance, and missing values are nil)
+//
+//Ex.
+//
+//		{"columns": ["plan", "age", "rate"], "rows": [["A", 20, 1.5], ["A", 30, 1.8]]}
+//
+//		[{"plan": "A", "age": 20, "rate": 1.5}, {"plan": "A", "age": 30, "rate": 1.8}]
+//
+func LoadTableJSON(r io.Reader) (*Table, error) {
+
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '[' {
+		return loadTableJSONObjects(data)
+	}
+
+	var config tableJSON
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, err
+	}
+
+	return NewTable(config.Columns, config.Rows)
+}
+
+//loadTableJSONObjects loading a Table from JSON array of objects,
+//which are decoded token by token for keeping order of columns
+func loadTableJSONObjects(data []byte) (*Table, error) {
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+
+	//[
+	if _, err := decoder.Token(); err != nil {
+		return nil, err
+	}
+
+	var columns []string
+	index := make(map[string]int)
+	var objects []map[string]interface{}
+
+	for decoder.More() {
+
+		//{
+		if t, err := decoder.Token(); err != nil {
+			return nil, err
+		} else if t != json.Delim('{') {
+			return nil, fmt.Errorf("row %d is not an object", len(objects)+1)
+		}
+
+		object := make(map[string]interface{})
+
+		for decoder.More() {
+
+			t, err := decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+
+			key := t.(string)
+			if _, found := index[key]; !found {
+				index[key] = len(columns)
+				columns = append(columns, key)
+			}
+
+			var value interface{}
+			if err := decoder.Decode(&value); err != nil {
+				return nil, err
+			}
+			object[key] = value
+		}
+
+		//}
+		if _, err := decoder.Token(); err != nil {
+			return nil, err
+		}
+
+		objects = append(objects, object)
+	}
+
+	rows := make([][]interface{}, len(objects))
+	for i, object := range objects {
+		rows[i] = make([]interface{}, len(columns))
+		for key, value := range object {
+			rows[i][index[key]] = value
+		}
+	}
+
+	return NewTable(columns, rows)
+}
@@ -0,0 +1,104 @@
+package vm
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+//TableRepository repository of named tables queried by lookup functions
+//($VLOOKUP, $BRACKET, $INDEX, $MATCH and $TABLE), tables are shared
+//(read-only) by all contexts of a Formula rather than being copied into VMs
+type TableRepository interface {
+
+	//GetTable getting the table of the given name, false if not found
+	GetTable(name string) (*Table, bool)
+}
+
+//DefaultTableRepository default implementation of TableRepository,
+//which is safe for registering tables while formulas are running
+type DefaultTableRepository struct {
+	mutex  sync.RWMutex
+	tables map[string]*Table
+}
+
+//NewTableRepository is a public function to obtain an empty
+//DefaultTableRepository
+func NewTableRepository() *DefaultTableRepository {
+
+	return &DefaultTableRepository{tables: make(map[string]*Table)}
+}
+
+//LoadTableRepository loading a DefaultTableRepository from CSV (.csv) and
+//JSON (.json) files of the given directory (see LoadTableFile), tables are
+//named by their file names without extension e.g., rates.csv is rates
+func LoadTableRepository(dir string) (*DefaultTableRepository, error) {
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	r := NewTableRepository()
+
+	for _, file := range files {
+
+		ext := strings.ToLower(filepath.Ext(file.Name()))
+		if file.IsDir() || (ext != ".csv" && ext != ".json") {
+			continue
+		}
+
+		t, err := LoadTableFile(filepath.Join(dir, file.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		r.RegisterTable(strings.TrimSuffix(file.Name(), filepath.Ext(file.Name())), t)
+	}
+
+	return r, nil
+}
+
+//RegisterTable registering the given table under the given name,
+//true if it's replacing a registered one
+func (r *DefaultTableRepository) RegisterTable(name string, t *Table) bool {
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	_, found := r.tables[name]
+
+	r.tables[name] = t
+
+	return found
+}
+
+//GetTable getting the table of the given name, false if not found
+func (r *DefaultTableRepository) GetTable(name string) (*Table, bool) {
+
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	t, found := r.tables[name]
+
+	return t, found
+}
+
+//TableNames getting names of all registered tables
+func (r *DefaultTableRepository) TableNames() []string {
+
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	names := make([]string, 0, len(r.tables))
+
+	for name := range r.tables {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
@@ -0,0 +1,453 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/lertrel/goforit/model"
+)
+
+//numberFormat a section of an Excel-style number format e.g., #,##0.00
+type numberFormat struct {
+	prefix       string
+	suffix       string
+	digits       bool
+	intZeros     int
+	fracZeros    int
+	fracHashes   int
+	decimalPoint bool
+	grouping     bool
+	percent      int
+	thousands    int
+}
+
+//isDateFormat telling if the given Excel-style format is for dates
+//(having y, m, d, h or s but no digit placeholders)
+func isDateFormat(format string) bool {
+
+	date := false
+
+	for _, token := range formatTokens(format) {
+		if token.literal {
+			continue
+		}
+		switch strings.ToLower(token.text)[0] {
+		case '0', '#', '?':
+			return false
+		case 'y', 'm', 'd', 'h', 's':
+			date = true
+		}
+	}
+
+	return date
+}
+
+//formatToken a literal text (quoted or escaped) or a character of
+//an Excel-style format
+type formatToken struct {
+	text    string
+	literal bool
+}
+
+func formatTokens(format string) []formatToken {
+
+	var tokens []formatToken
+	runes := []rune(format)
+
+	for i := 0; i < len(runes); i++ {
+		switch runes[i] {
+		case '"':
+			end := i + 1
+			for end < len(runes) && runes[end] != '"' {
+				end++
+			}
+			tokens = append(tokens, formatToken{string(runes[i+1 : end]), true})
+			i = end
+		case '\\':
+			if i+1 < len(runes) {
+				i++
+				tokens = append(tokens, formatToken{string(runes[i]), true})
+			}
+		case '_':
+			//Padding by the width of the next character
+			if i+1 < len(runes) {
+				i++
+				tokens = append(tokens, formatToken{" ", true})
+			}
+		case '*':
+			//Filling by the next character isn't applicable to texts
+			i++
+		default:
+			tokens = append(tokens, formatToken{string(runes[i]), false})
+		}
+	}
+
+	return tokens
+}
+
+//splitFormatSections splitting an Excel-style format into its sections
+//(positive;negative;zero) by semicolons outside of literals
+func splitFormatSections(format string) []string {
+
+	var sections []string
+	var section strings.Builder
+	quoted := false
+
+	for i := 0; i < len(format); i++ {
+
+		c := format[i]
+
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case c == '\\' && !quoted && i+1 < len(format):
+			section.WriteByte(c)
+			i++
+			c = format[i]
+		case c == ';' && !quoted:
+			sections = append(sections, section.String())
+			section.Reset()
+			continue
+		}
+
+		section.WriteByte(c)
+	}
+
+	return append(sections, section.String())
+}
+
+func parseNumberFormat(section string) (numberFormat, error) {
+
+	var f numberFormat
+	var prefix, suffix strings.Builder
+	tokens := formatTokens(section)
+
+	isPlaceholder := func(t formatToken) bool {
+		return !t.literal && (t.text == "0" || t.text == "#" || t.text == "?")
+	}
+
+	for i, token := range tokens {
+
+		literal := token.text
+
+		switch {
+		case isPlaceholder(token):
+			if suffix.Len() > 0 {
+				return f, errors.New("literals between digit placeholders are not supported")
+			}
+			f.digits = true
+			switch {
+			case f.decimalPoint && token.text == "0":
+				f.fracZeros++
+			case f.decimalPoint:
+				f.fracHashes++
+			case token.text == "0":
+				f.intZeros++
+			}
+			continue
+
+		case token.literal:
+			//Written as it is
+
+		case token.text == "." && !f.decimalPoint && (f.digits || i+1 < len(tokens) && isPlaceholder(tokens[i+1])):
+			f.decimalPoint = true
+			f.digits = true
+			continue
+
+		case token.text == "," && f.digits && suffix.Len() == 0:
+			//A comma followed by digit placeholders groups thousands,
+			//trailing commas scale the number by thousands
+			j := i + 1
+			for j < len(tokens) && !tokens[j].literal && tokens[j].text == "," {
+				j++
+			}
+			if j < len(tokens) && isPlaceholder(tokens[j]) && !f.decimalPoint {
+				f.grouping = true
+			} else {
+				f.thousands++
+			}
+			continue
+
+		case token.text == "%":
+			f.percent++
+		}
+
+		if f.digits {
+			suffix.WriteString(literal)
+		} else {
+			prefix.WriteString(literal)
+		}
+	}
+
+	f.prefix = prefix.String()
+	f.suffix = suffix.String()
+
+	return f, nil
+}
+
+//format formatting the absolute value of the given number, telling also
+//if the formatted number is zero
+func (f numberFormat) format(d *big.Rat, mode model.RoundingMode) (string, bool) {
+
+	if !f.digits {
+		return f.prefix + f.suffix, true
+	}
+
+	v := new(big.Rat).Abs(d)
+	for i := 0; i < f.percent; i++ {
+		v.Mul(v, big.NewRat(100, 1))
+	}
+	for i := 0; i < f.thousands; i++ {
+		v.Quo(v, big.NewRat(1000, 1))
+	}
+
+	rounded := model.RoundDecimal(v, f.fracZeros+f.fracHashes, mode)
+	digits := model.FormatDecimalScale(rounded, f.fracZeros+f.fracHashes, mode)
+
+	intPart, fracPart := digits, ""
+	if i := strings.IndexByte(digits, '.'); i >= 0 {
+		intPart, fracPart = digits[:i], digits[i+1:]
+	}
+
+	for len(fracPart) > f.fracZeros && strings.HasSuffix(fracPart, "0") {
+		fracPart = fracPart[:len(fracPart)-1]
+	}
+
+	if intPart == "0" && f.intZeros == 0 {
+		intPart = ""
+	}
+	if len(intPart) < f.intZeros {
+		intPart = strings.Repeat("0", f.intZeros-len(intPart)) + intPart
+	}
+	if f.grouping {
+		intPart = groupThousands(intPart)
+	}
+
+	var sb strings.Builder
+	sb.WriteString(f.prefix)
+	sb.WriteString(intPart)
+	if f.decimalPoint {
+		sb.WriteByte('.')
+		sb.WriteString(fracPart)
+	}
+	sb.WriteString(f.suffix)
+
+	return sb.String(), rounded.Sign() == 0
+}
+
+func groupThousands(digits string) string {
+
+	if len(digits) <= 3 {
+		return digits
+	}
+
+	var sb strings.Builder
+	head := len(digits) % 3
+	if head > 0 {
+		sb.WriteString(digits[:head])
+	}
+
+	for i := head; i < len(digits); i += 3 {
+		if sb.Len() > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(digits[i : i+3])
+	}
+
+	return sb.String()
+}
+
+//formatNumberText formatting the given number by an Excel-style number
+//format having up to 3 sections (positive;negative;zero)
+//
+//Ex.
+//	formatNumberText(big.NewRat(-12345, 10), "#,##0.00", model.RoundHalfUp) // "-1,234.50"
+//	formatNumberText(big.NewRat(-5, 1), "0;(0)", model.RoundHalfUp) // "(5)"
+func formatNumberText(d *big.Rat, format string, mode model.RoundingMode) (string, error) {
+
+	sections := splitFormatSections(format)
+	if len(sections) > 4 {
+		return "", fmt.Errorf("too many sections in format %q", format)
+	}
+
+	section, signed := sections[0], d.Sign() < 0
+	switch {
+	case d.Sign() == 0 && len(sections) > 2:
+		section = sections[2]
+	case d.Sign() < 0 && len(sections) > 1:
+		section, signed = sections[1], false
+	}
+
+	f, err := parseNumberFormat(section)
+	if err != nil {
+		return "", err
+	}
+
+	s, zero := f.format(d, mode)
+	if signed && !zero {
+		s = "-" + s
+	}
+
+	return s, nil
+}
+
+var (
+	monthNames   = [...]string{"January", "February", "March", "April", "May", "June", "July", "August", "September", "October", "November", "December"}
+	weekdayNames = [...]string{"Sunday", "Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday"}
+)
+
+//formatDateText formatting the given time by an Excel-style date format
+//
+//Ex.
+//	formatDateText(t, "dd/mm/yyyy") // "31/12/2020"
+//	formatDateText(t, "d mmmm yyyy h:mm AM/PM") // "31 December 2020 11:59 PM"
+func formatDateText(t time.Time, format string) string {
+
+	tokens := formatTokens(format)
+
+	twelveHours := false
+	for i := range tokens {
+		if isAmPm(tokens, i) > 0 {
+			twelveHours = true
+		}
+	}
+
+	var sb strings.Builder
+	lastDatePart := byte(0)
+
+	for i := 0; i < len(tokens); i++ {
+
+		token := tokens[i]
+		if token.literal {
+			sb.WriteString(token.text)
+			continue
+		}
+
+		if n := isAmPm(tokens, i); n > 0 {
+			marker := "AM"
+			if t.Hour() >= 12 {
+				marker = "PM"
+			}
+			if n == 3 {
+				marker = marker[:1]
+			}
+			if token.text == strings.ToLower(token.text) {
+				marker = strings.ToLower(marker)
+			}
+			sb.WriteString(marker)
+			i += n - 1
+			continue
+		}
+
+		c := strings.ToLower(token.text)[0]
+		if !strings.ContainsRune("ymdhs", rune(c)) {
+			sb.WriteString(token.text)
+			continue
+		}
+
+		count := 1
+		for i+count < len(tokens) && !tokens[i+count].literal && strings.ToLower(tokens[i+count].text)[0] == c {
+			count++
+		}
+		i += count - 1
+
+		switch c {
+		case 'y':
+			if count > 2 {
+				sb.WriteString(fmt.Sprintf("%04d", t.Year()))
+			} else {
+				sb.WriteString(fmt.Sprintf("%02d", t.Year()%100))
+			}
+		case 'm':
+			//m right after hours or right before seconds is minutes
+			if count <= 2 && (lastDatePart == 'h' || nextDatePart(tokens, i+1) == 's') {
+				sb.WriteString(padNumber(t.Minute(), count))
+				break
+			}
+			switch {
+			case count <= 2:
+				sb.WriteString(padNumber(int(t.Month()), count))
+			case count == 3:
+				sb.WriteString(monthNames[t.Month()-1][:3])
+			case count == 4:
+				sb.WriteString(monthNames[t.Month()-1])
+			default:
+				sb.WriteString(monthNames[t.Month()-1][:1])
+			}
+		case 'd':
+			switch {
+			case count <= 2:
+				sb.WriteString(padNumber(t.Day(), count))
+			case count == 3:
+				sb.WriteString(weekdayNames[t.Weekday()][:3])
+			default:
+				sb.WriteString(weekdayNames[t.Weekday()])
+			}
+		case 'h':
+			hour := t.Hour()
+			if twelveHours {
+				hour = (hour+11)%12 + 1
+			}
+			sb.WriteString(padNumber(hour, count))
+		case 's':
+			sb.WriteString(padNumber(t.Second(), count))
+		}
+
+		lastDatePart = c
+	}
+
+	return sb.String()
+}
+
+//isAmPm number of tokens of AM/PM (5) or A/P (3) at the given index, 0 if none
+func isAmPm(tokens []formatToken, i int) int {
+
+	for _, marker := range []string{"am/pm", "a/p"} {
+
+		n := len(marker)
+		if i+n > len(tokens) {
+			continue
+		}
+
+		var sb strings.Builder
+		for _, token := range tokens[i : i+n] {
+			if token.literal {
+				break
+			}
+			sb.WriteString(token.text)
+		}
+
+		if strings.EqualFold(sb.String(), marker) {
+			return n
+		}
+	}
+
+	return 0
+}
+
+//nextDatePart the next date part (y, m, d, h or s) from the given index
+func nextDatePart(tokens []formatToken, from int) byte {
+
+	for _, token := range tokens[from:] {
+		if token.literal {
+			continue
+		}
+		if c := strings.ToLower(token.text)[0]; strings.ContainsRune("ymdhs", rune(c)) {
+			return c
+		}
+	}
+
+	return 0
+}
+
+func padNumber(n int, width int) string {
+
+	if width >= 2 {
+		return fmt.Sprintf("%02d", n)
+	}
+
+	return fmt.Sprint(n)
+}
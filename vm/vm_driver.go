@@ -1,6 +1,12 @@
 package vm
 
-import "github.com/lertrel/goforit/model"
+import (
+	"context"
+	"math/big"
+	"time"
+
+	"github.com/lertrel/goforit/model"
+)
 
 //Driver An interface for implementing driver
 //for specific VM/scripting implementation
@@ -13,6 +19,11 @@ type Driver interface {
 	//another VM to reduce constructing overhead
 	SetTemplate(vm VM)
 
+	//Compile parsing the given script/formula once into a program
+	//(specific to each scripting/VM engine e.g., *otto.Script for otto),
+	//which can be run by any VM of this driver through VM.RunCompiled
+	Compile(formulaString string) (interface{}, error)
+
 	//ExtractFunctionNames extracting functions names
 	//from the given script/formular so that the function can be loaded
 	//by Formula.LoadContext() before being executed, otherwise the
@@ -31,14 +42,66 @@ type VM interface {
 	//Run for running a given script/formual
 	Run(formulaString string) (model.Value, error)
 
+	//RunContext for running a given script/formula, the execution has to be
+	//interrupted with *model.InterruptedError once the given ctx is done
+	//
+	//The VM must remain usable after being interrupted
+	RunContext(ctx context.Context, formulaString string) (model.Value, error)
+
+	//RunCompiled the same as RunContext, but running a program
+	//compiled by Driver.Compile, or a syntax tree of parse package
+	//(e.g., of parse.ThunkLazyArguments)
+	RunCompiled(ctx context.Context, program interface{}) (model.Value, error)
+
+	//Context getting ctx given to the current run (RunContext or RunCompiled),
+	//so built-in functions can read values carried by it (e.g., model.AsOf),
+	//context.Background() if it's not running
+	Context() context.Context
+
+	//SetLimits setting resource budgets applied to every subsequent run,
+	//a run hitting any of the limits has to be aborted with *model.LimitError
+	SetLimits(limits model.Limits)
+
+	//Limits getting resource budgets applied to every run
+	Limits() model.Limits
+
+	//Copy cloning the VM including variables and loaded functions, so a VM
+	//can be used as a template of others (e.g., by a pool of contexts)
+	Copy() (VM, error)
+
+	//SetDeterministic making every subsequent run reproducible, random
+	//numbers (Math.random and Random) have to be drawn from a PRNG seeded
+	//per run by the seed carried by ctx (model.WithSeed) or a newly
+	//generated one, and the current time (Date.now and new Date()) has to
+	//be read from the given clock
+	SetDeterministic(clock model.Clock) error
+
+	//Seed getting the random seed of the current (or the last) run,
+	//zero if the VM isn't deterministic
+	Seed() int64
+
+	//Random getting the next random number in [0, 1) of the current run
+	Random() float64
+
 	//Get getting value of a variable out of scripting context
 	Get(varname string) (model.Value, error)
 
 	//Set setting value of a valiable inside scripting context
+	//(*big.Rat has to be set as a decimal string, and time.Time as a date-time string)
 	Set(varname string, value interface{}) error
 
+	//Globals getting names of all (user-visible) global variables
+	//inside scripting context, including loaded functions
+	Globals() ([]string, error)
+
+	//Unset removing the given global variables from scripting context
+	Unset(varnames ...string) error
+
 	//ValidateFuncArguments validting if a given scripting function has
 	//number of arguments equal to the given cnt
+	//
+	//This method and GetFuncArgAs* panic with *model.FormulaError
+	//when the arguments are invalid
 	ValidateFuncArguments(funcName string, cnt int, funcDef interface{})
 
 	//GetFuncArgsCount getting function arguments count
@@ -56,11 +119,35 @@ type VM interface {
 	//GetFuncArgAsBoolean getting function argument refering by the index as boolean
 	GetFuncArgAsBoolean(funcDef interface{}, index int) bool
 
+	//GetFuncArgAsDecimal getting function argument refering by the index
+	//as an exact number (see ToDecimal)
+	GetFuncArgAsDecimal(funcDef interface{}, index int) *big.Rat
+
+	//GetFuncArgAsTime getting function argument refering by the index
+	//as time (see ToTime)
+	GetFuncArgAsTime(funcDef interface{}, index int, loc *time.Location) time.Time
+
+	//GetFuncArgAsArray getting function argument refering by the index
+	//as elements of an array (raw types as GetFuncArgAsIs), panicking with
+	//*model.FormulaError if the argument is not an array
+	GetFuncArgAsArray(funcDef interface{}, index int) []interface{}
+
 	//GetFuncArgAsIs getting function argument refering by the index as raw type
 	//depending on each scripting/VM engine e.g., otto.Value for otto
 	GetFuncArgAsIs(funcDef interface{}, index int) interface{}
 
+	//EvaluateFuncArg the same as GetFuncArgAsIs, but an error raised while
+	//evaluating a lazy argument (see model.Param.Lazy) is returned rather
+	//than propagated, e.g., for $IFERROR
+	//
+	//GetFuncArgAs* evaluate a lazy argument (once) when it's first got,
+	//so a lazy argument which is never got is never evaluated
+	EvaluateFuncArg(funcDef interface{}, index int) (interface{}, error)
+
 	//ToVMValue converting go variable into scriing/VM value e.g., otto.Value for otto
+	//
+	//*big.Rat has to be converted into a decimal string (see model.FormatDecimal),
+	//and time.Time into a date-time string (see model.FormatDateTime)
 	ToVMValue(goValue interface{}) interface{}
 
 	//GetBuiltInFunc getting a function for registering / connecting
@@ -130,6 +217,9 @@ type VM interface {
 	//IsFunction check if the current JS value is function
 	IsFunction(vmValue interface{}) bool
 
+	//IsArray check if the current JS value is array
+	IsArray(vmValue interface{}) bool
+
 	//ToBoolean get value as bool
 	ToBoolean(vmValue interface{}) (bool, error)
 
@@ -142,6 +232,19 @@ type VM interface {
 	//ToString get value as string
 	ToString(vmValue interface{}) (string, error)
 
+	//ToArray get elements of an array (raw types as GetFuncArgAsIs)
+	ToArray(vmValue interface{}) ([]interface{}, error)
+
+	//ToDecimal get value as an exact number, a number is taken by its
+	//shortest decimal representation (e.g., 0.1 is exactly 1/10) and
+	//a string is parsed by model.ParseDecimal
+	ToDecimal(vmValue interface{}) (*big.Rat, error)
+
+	//ToTime get value as time, a date or a date-time string is parsed by
+	//model.ParseTime in the given location, a JS Date or a number (of
+	//milliseconds since epoch) is converted into the given location
+	ToTime(vmValue interface{}, loc *time.Location) (time.Time, error)
+
 	//Export js value to Go value type as specified in a given interface
 	Export(vmValue interface{}) (interface{}, error)
 }